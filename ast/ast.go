@@ -22,6 +22,11 @@ type Statement interface {
 	statementNode()
 }
 
+// Positioned nodes know where they start in the source, every node does
+type Positioned interface {
+	Pos() token.Position
+}
+
 // Expressions produce values(think of `add(1, 2);`)
 type Expression interface {
 	Node
@@ -39,6 +44,14 @@ func (p *Program) TokenLiteral() string {
 		return ""
 	}
 }
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		if positioned, ok := p.Statements[0].(Positioned); ok {
+			return positioned.Pos()
+		}
+	}
+	return token.Position{}
+}
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -53,15 +66,21 @@ type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
 	Value Expression
+	// Exported is set by `export let`, making the binding visible to modules which import this one
+	Exported bool
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
+	if ls.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	out.WriteString(ls.Name.Declaration())
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -73,6 +92,20 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// ImportStatement evaluates the file at Path as a module, binding it to the file's name without its extension, e.g.
+// `import "lib/math.monkey"` binds `math`
+type ImportStatement struct {
+	Token token.Token
+	Path  *StringLiteral
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " \"" + is.Path.Value + "\";"
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
@@ -80,6 +113,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -94,6 +128,51 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+	Label string      // the label of the loop to break out of, empty for the innermost one
+	Value Expression  // what the loop evaluates to, nil for a plain `break`
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(bs.TokenLiteral())
+
+	if bs.Label != "" {
+		out.WriteString(" ")
+		out.WriteString(bs.Label)
+	}
+
+	if bs.Value != nil {
+		out.WriteString(" ")
+		out.WriteString(bs.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+	Label string      // the label of the loop to continue, empty for the innermost one
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string {
+	if cs.Label != "" {
+		return cs.TokenLiteral() + " " + cs.Label + ";"
+	}
+
+	return cs.TokenLiteral() + ";"
+}
+
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression, so in `x + 10;` that would be `x`
 	Expression Expression
@@ -101,6 +180,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -108,13 +188,17 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
+// BlockStatement is both a statement, the body of an if, a loop or a function, and an expression when it's written on
+// its own, `let x = { let y = 2; y * 3 }`, either way its value is the value of its last statement
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
 }
 
 func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) expressionNode()      {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -136,14 +220,26 @@ func (bs *BlockStatement) String() string {
 type Identifier struct {
 	Token token.Token
 	Value string
+	// Annotation is the type a let's name or a parameter is declared with, e.g. `int` in `let x: int = 5`, nil when it
+	// isn't annotated. The evaluator ignores it, it's only there for the type checker
+	Annotation *Identifier
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string {
 	return i.Value
 }
 
+// Declaration is the identifier as it's declared, with its annotation when it has one, e.g. `x: int`
+func (i *Identifier) Declaration() string {
+	if i.Annotation == nil {
+		return i.Value
+	}
+	return i.Value + ": " + i.Annotation.Value
+}
+
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
@@ -151,6 +247,7 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 type Boolean struct {
@@ -160,8 +257,18 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
+type Null struct {
+	Token token.Token
+}
+
+func (n *Null) expressionNode()      {}
+func (n *Null) TokenLiteral() string { return n.Token.Literal }
+func (n *Null) Pos() token.Position  { return n.Token.Pos }
+func (n *Null) String() string       { return n.Token.Literal }
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -169,6 +276,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 type PrefixExpression struct {
@@ -179,6 +287,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -190,6 +299,20 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// PostfixExpression is `i++` or `i--`, which updates the variable and evaluates to its value from before the update
+type PostfixExpression struct {
+	Token    token.Token // The operator token, e.g. ++
+	Target   *Identifier
+	Operator string
+}
+
+func (pe *PostfixExpression) expressionNode()      {}
+func (pe *PostfixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PostfixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PostfixExpression) String() string {
+	return "(" + pe.Target.String() + pe.Operator + ")"
+}
+
 type InfixExpression struct {
 	Token    token.Token // The operator token, e.g. +
 	Left     Expression
@@ -199,6 +322,7 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Pos() token.Position  { return oe.Token.Pos }
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -220,6 +344,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -236,6 +361,106 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// labelPrefix is how a loop's label is written before it, `label: `
+func labelPrefix(label string) string {
+	if label == "" {
+		return ""
+	}
+
+	return label + ": "
+}
+
+type WhileExpression struct {
+	Token     token.Token // The 'while' token
+	Label     string      // empty when the loop isn't labeled
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (we *WhileExpression) expressionNode()      {}
+func (we *WhileExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WhileExpression) Pos() token.Position  { return we.Token.Pos }
+func (we *WhileExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(labelPrefix(we.Label))
+	out.WriteString("while")
+	out.WriteString(we.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(we.Body.String())
+
+	return out.String()
+}
+
+// DoWhileExpression is `do { body } while (condition)`, unlike a while loop the body always runs at least once
+type DoWhileExpression struct {
+	Token     token.Token // The 'do' token
+	Label     string      // empty when the loop isn't labeled
+	Body      *BlockStatement
+	Condition Expression
+}
+
+func (dw *DoWhileExpression) expressionNode()      {}
+func (dw *DoWhileExpression) TokenLiteral() string { return dw.Token.Literal }
+func (dw *DoWhileExpression) Pos() token.Position  { return dw.Token.Pos }
+func (dw *DoWhileExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(labelPrefix(dw.Label))
+	out.WriteString("do ")
+	out.WriteString(dw.Body.String())
+	out.WriteString("while")
+	out.WriteString(dw.Condition.String())
+
+	return out.String()
+}
+
+// LoopExpression is `loop { body }`, which runs forever until a `break`, it evaluates to the break's value or null
+type LoopExpression struct {
+	Token token.Token // The 'loop' token
+	Label string      // empty when the loop isn't labeled
+	Body  *BlockStatement
+}
+
+func (le *LoopExpression) expressionNode()      {}
+func (le *LoopExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LoopExpression) Pos() token.Position  { return le.Token.Pos }
+func (le *LoopExpression) String() string {
+	return labelPrefix(le.Label) + "loop " + le.Body.String()
+}
+
+// ForInExpression is `for v in xs { body }`, which runs body once per element of xs with v bound to the element, or
+// `for i, v in xs { body }`, which binds the element's index to i as well
+type ForInExpression struct {
+	Token    token.Token // The 'for' token
+	Label    string      // empty when the loop isn't labeled
+	IndexVar *Identifier // nil when only the value is bound
+	ValueVar *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fi *ForInExpression) expressionNode()      {}
+func (fi *ForInExpression) TokenLiteral() string { return fi.Token.Literal }
+func (fi *ForInExpression) Pos() token.Position  { return fi.Token.Pos }
+func (fi *ForInExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(labelPrefix(fi.Label))
+	out.WriteString("for ")
+	if fi.IndexVar != nil {
+		out.WriteString(fi.IndexVar.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fi.ValueVar.String())
+	out.WriteString(" in ")
+	out.WriteString(fi.Iterable.String())
+	out.WriteString(" ")
+	out.WriteString(fi.Body.String())
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
 	Token      token.Token // The 'fn' token
 	Parameters []*Identifier
@@ -244,12 +469,13 @@ type FunctionLiteral struct {
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	var params []string
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		params = append(params, p.Declaration())
 	}
 
 	out.WriteString(fl.TokenLiteral())
@@ -269,6 +495,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -292,6 +519,7 @@ type ArrayLiteral struct {
 
 func (arr *ArrayLiteral) expressionNode()      {}
 func (arr *ArrayLiteral) TokenLiteral() string { return arr.Token.Literal }
+func (arr *ArrayLiteral) Pos() token.Position  { return arr.Token.Pos }
 func (arr *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -315,6 +543,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -335,6 +564,7 @@ type RangeExpression struct {
 
 func (ra *RangeExpression) expressionNode()      {}
 func (ra *RangeExpression) TokenLiteral() string { return ra.Token.Literal }
+func (ra *RangeExpression) Pos() token.Position  { return ra.Token.Pos }
 func (ra *RangeExpression) String() string {
 	var out bytes.Buffer
 
@@ -345,19 +575,26 @@ func (ra *RangeExpression) String() string {
 	return out.String()
 }
 
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
 type HashLiteral struct {
 	Token token.Token // the '{' token
-	Pairs map[Expression]Expression
+	// Pairs are kept in the order they were written, rather than in a map, so they're evaluated left to right
+	Pairs []HashPair
 }
 
 func (h *HashLiteral) expressionNode()      {}
 func (h *HashLiteral) TokenLiteral() string { return h.Token.Literal }
+func (h *HashLiteral) Pos() token.Position  { return h.Token.Pos }
 func (h *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range h.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
 	}
 
 	out.WriteString("{")
@@ -366,3 +603,142 @@ func (h *HashLiteral) String() string {
 
 	return out.String()
 }
+
+type AssignExpression struct {
+	Token  token.Token // the '=' token
+	Target Expression  // either an *Identifier or an *IndexExpression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// PipeExpression is `value |> fn`, which calls fn with value, when fn is a call itself, e.g. `value |> add(1)`, the
+// value gets passed as the first argument, `add(value, 1)`
+type PipeExpression struct {
+	Token token.Token // the '|>' token
+	Left  Expression
+	Right Expression
+}
+
+func (pe *PipeExpression) expressionNode()      {}
+func (pe *PipeExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PipeExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PipeExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(pe.Left.String())
+	out.WriteString(" |> ")
+	out.WriteString(pe.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// MethodCallExpression is `receiver.method(args)`, sugar for `method(receiver, args)`, when Optional, i.e.
+// `receiver?.method(args)`, a null receiver evaluates to null rather than calling the method, skipping the rest of the
+// chain like DotExpression does
+type MethodCallExpression struct {
+	Token     token.Token // the '.' or '?.' token
+	Receiver  Expression
+	Method    *Identifier
+	Arguments []Expression
+	Optional  bool
+}
+
+func (mc *MethodCallExpression) expressionNode()      {}
+func (mc *MethodCallExpression) TokenLiteral() string { return mc.Token.Literal }
+func (mc *MethodCallExpression) Pos() token.Position  { return mc.Token.Pos }
+func (mc *MethodCallExpression) String() string {
+	var out bytes.Buffer
+
+	var args []string
+	for _, a := range mc.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(mc.Receiver.String())
+	out.WriteString(mc.Token.Literal)
+	out.WriteString(mc.Method.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// DotExpression is `h.key`, sugar for `h["key"]` on hashes, when Optional, i.e. `h?.key`, a null h evaluates to null
+// rather than erroring, and so does the rest of the chain after it, e.g. `h?.key.other`
+type DotExpression struct {
+	Token    token.Token // the '.' or '?.' token
+	Left     Expression
+	Key      *Identifier
+	Optional bool
+}
+
+func (de *DotExpression) expressionNode()      {}
+func (de *DotExpression) TokenLiteral() string { return de.Token.Literal }
+func (de *DotExpression) Pos() token.Position  { return de.Token.Pos }
+func (de *DotExpression) String() string {
+	return de.Left.String() + de.Token.Literal + de.Key.String()
+}
+
+// CoalesceExpression is `value ?? fallback`, which is value unless it's null, fallback is only evaluated when needed
+type CoalesceExpression struct {
+	Token token.Token // the '??' token
+	Left  Expression
+	Right Expression
+}
+
+func (ce *CoalesceExpression) expressionNode()      {}
+func (ce *CoalesceExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CoalesceExpression) Pos() token.Position  { return ce.Token.Pos }
+func (ce *CoalesceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ce.Left.String())
+	out.WriteString(" ?? ")
+	out.WriteString(ce.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// ComparisonChain is `a < b < c`, which holds when every comparison does, i.e. `a < b && b < c`, each operand is only
+// evaluated once. Operators[i] compares Operands[i] with Operands[i+1]
+type ComparisonChain struct {
+	Token     token.Token // the first comparison token
+	Operands  []Expression
+	Operators []string
+}
+
+func (cc *ComparisonChain) expressionNode()      {}
+func (cc *ComparisonChain) TokenLiteral() string { return cc.Token.Literal }
+func (cc *ComparisonChain) Pos() token.Position  { return cc.Token.Pos }
+func (cc *ComparisonChain) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(cc.Operands[0].String())
+	for i, operator := range cc.Operators {
+		out.WriteString(" " + operator + " ")
+		out.WriteString(cc.Operands[i+1].String())
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
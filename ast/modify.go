@@ -0,0 +1,102 @@
+package ast
+
+type ModifierFunc func(Node) Node
+
+// Modify walks the tree depth first, replacing every node with what modifier returns for it, children are modified
+// before their parents so modifier always sees an already modified subtree. Nodes are modified in place
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+	case *BlockStatement:
+		for i, statement := range node.Statements {
+			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+		}
+	case *ExpressionStatement:
+		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+	case *LetStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *BreakStatement:
+		if node.Value != nil {
+			node.Value, _ = Modify(node.Value, modifier).(Expression)
+		}
+	case *ReturnStatement:
+		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+	case *PrefixExpression:
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *PostfixExpression:
+		node.Target, _ = Modify(node.Target, modifier).(*Identifier)
+	case *InfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *IfExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Alternative != nil {
+			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+	case *WhileExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *DoWhileExpression:
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+	case *LoopExpression:
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *ForInExpression:
+		// the loop variables are bound rather than resolved, like a let's name, so they aren't visited
+		node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *FunctionLiteral:
+		for i := range node.Parameters {
+			node.Parameters[i], _ = Modify(node.Parameters[i], modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i, arg := range node.Arguments {
+			node.Arguments[i], _ = Modify(arg, modifier).(Expression)
+		}
+	case *ArrayLiteral:
+		for i, element := range node.Elements {
+			node.Elements[i], _ = Modify(element, modifier).(Expression)
+		}
+	case *IndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+	case *RangeExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *HashLiteral:
+		for i, pair := range node.Pairs {
+			node.Pairs[i].Key, _ = Modify(pair.Key, modifier).(Expression)
+			node.Pairs[i].Value, _ = Modify(pair.Value, modifier).(Expression)
+		}
+	case *AssignExpression:
+		node.Target, _ = Modify(node.Target, modifier).(Expression)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *PipeExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *MethodCallExpression:
+		node.Receiver, _ = Modify(node.Receiver, modifier).(Expression)
+		node.Method, _ = Modify(node.Method, modifier).(*Identifier)
+		for i, arg := range node.Arguments {
+			node.Arguments[i], _ = Modify(arg, modifier).(Expression)
+		}
+	case *DotExpression:
+		// the key is a field name rather than an identifier which gets resolved, so it isn't visited
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+	case *ComparisonChain:
+		for i, operand := range node.Operands {
+			node.Operands[i], _ = Modify(operand, modifier).(Expression)
+		}
+	case *CoalesceExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	}
+
+	return modifier(node)
+}
@@ -0,0 +1,100 @@
+package ast
+
+// Walk visits the tree depth first, parents before their children, the children of a node are skipped when visit
+// returns false for it. Like Modify, a let's name, a for loop's variables and a dot expression's key aren't visited
+// since they're not identifiers which get resolved
+func Walk(node Node, visit func(Node) bool) {
+	// nil for fields left empty, like the value of a plain `break`
+	if node == nil || !visit(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, statement := range node.Statements {
+			Walk(statement, visit)
+		}
+	case *BlockStatement:
+		for _, statement := range node.Statements {
+			Walk(statement, visit)
+		}
+	case *ExpressionStatement:
+		Walk(node.Expression, visit)
+	case *LetStatement:
+		Walk(node.Value, visit)
+	case *BreakStatement:
+		Walk(node.Value, visit)
+	case *ReturnStatement:
+		Walk(node.ReturnValue, visit)
+	case *PrefixExpression:
+		Walk(node.Right, visit)
+	case *PostfixExpression:
+		Walk(node.Target, visit)
+	case *InfixExpression:
+		Walk(node.Left, visit)
+		Walk(node.Right, visit)
+	case *IfExpression:
+		Walk(node.Condition, visit)
+		Walk(node.Consequence, visit)
+		if node.Alternative != nil {
+			Walk(node.Alternative, visit)
+		}
+	case *WhileExpression:
+		Walk(node.Condition, visit)
+		Walk(node.Body, visit)
+	case *DoWhileExpression:
+		Walk(node.Body, visit)
+		Walk(node.Condition, visit)
+	case *LoopExpression:
+		Walk(node.Body, visit)
+	case *ForInExpression:
+		Walk(node.Iterable, visit)
+		Walk(node.Body, visit)
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			Walk(param, visit)
+		}
+		Walk(node.Body, visit)
+	case *CallExpression:
+		Walk(node.Function, visit)
+		for _, arg := range node.Arguments {
+			Walk(arg, visit)
+		}
+	case *ArrayLiteral:
+		for _, element := range node.Elements {
+			Walk(element, visit)
+		}
+	case *IndexExpression:
+		Walk(node.Left, visit)
+		Walk(node.Index, visit)
+	case *RangeExpression:
+		Walk(node.Left, visit)
+		Walk(node.Right, visit)
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			Walk(pair.Key, visit)
+			Walk(pair.Value, visit)
+		}
+	case *AssignExpression:
+		Walk(node.Target, visit)
+		Walk(node.Value, visit)
+	case *PipeExpression:
+		Walk(node.Left, visit)
+		Walk(node.Right, visit)
+	case *MethodCallExpression:
+		Walk(node.Receiver, visit)
+		Walk(node.Method, visit)
+		for _, arg := range node.Arguments {
+			Walk(arg, visit)
+		}
+	case *DotExpression:
+		Walk(node.Left, visit)
+	case *ComparisonChain:
+		for _, operand := range node.Operands {
+			Walk(operand, visit)
+		}
+	case *CoalesceExpression:
+		Walk(node.Left, visit)
+		Walk(node.Right, visit)
+	}
+}
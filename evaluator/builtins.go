@@ -1,84 +1,2324 @@
 package evaluator
 
 import (
+	"container/list"
+	"encoding/base64"
 	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"waiig/lexer"
 	"waiig/object"
+	"waiig/parser"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
+// startTime is the reference point for `clock`, time.Since reads Go's monotonic clock so it's unaffected by changes
+// to the wall clock
+var startTime = time.Now()
 
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
+// regexps caches the patterns compiled by the regex builtins, so matching the same pattern in a loop compiles it once.
+// It keeps the maxRegexps most recently used ones, regexpsOrder has them from the most recent to the least
+var (
+	regexps      = map[string]*list.Element{}
+	regexpsOrder = list.New()
+	regexpsMu    sync.Mutex
+)
+
+const maxRegexps = 128
+
+// BuiltinNames returns the names of all the builtin functions, sorted
+func BuiltinNames() []string {
+	builtins := New().builtins
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// readFileBuiltin is `readFile`, it returns the contents of the file at the given path
+var readFileBuiltin = &object.Builtin{
+	Name: "readFile",
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `readFile`. got=%d, want=1", len(args))
+		}
+
+		path, ok := args[0].(*object.String)
+		if !ok {
+			return newError("argument to `readFile` must be STRING, got %s", args[0].Type())
+		}
+
+		data, err := os.ReadFile(path.Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+
+		return &object.String{Value: string(data)}
 	},
-	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
-					len(args))
-			}
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s",
-					args[0].Type())
-			}
+}
 
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
+// writeFileBuiltin is `writeFile`, it replaces the contents of the file at the given path, creating it if it doesn't
+// exist
+var writeFileBuiltin = &object.Builtin{
+	Name: "writeFile",
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments to `writeFile`. got=%d, want=2", len(args))
+		}
 
-			newElements := make([]object.Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
+		path, ok := args[0].(*object.String)
+		if !ok {
+			return newError("first argument to `writeFile` must be STRING, got %s", args[0].Type())
+		}
 
-			return &object.Array{Elements: newElements}
-		},
+		content, ok := args[1].(*object.String)
+		if !ok {
+			return newError("second argument to `writeFile` must be STRING, got %s", args[1].Type())
+		}
+
+		if err := os.WriteFile(path.Value, []byte(content.Value), 0o644); err != nil {
+			return newError("%s", err)
+		}
+
+		return NULL
 	},
-	"println": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) < 1 {
-				return newError("wrong number of arguments. got=%d, want at least 1",
-					len(args))
-			}
-			if args[0].Type() != object.STRING_OBJ {
-				return newError("first argument to `println` must be STRING, got %s",
-					args[0].Type())
-			}
+}
+
+// exitBuiltin is `exit`, it stops the program, exit() with status 0 and exit(code) with the given one
+var exitBuiltin = &object.Builtin{
+	Name: "exit",
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) > 1 {
+			return newError("wrong number of arguments to `exit`. got=%d, want=0 or 1", len(args))
+		}
+
+		if len(args) == 0 {
+			return &object.Exit{Code: 0}
+		}
+
+		code, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+		}
+
+		return &object.Exit{Code: code.Value}
+	},
+}
 
-			str := args[0].(*object.String).Value
+// evalBuiltin is `eval`, applyFunction runs it in the interpreter applying it, Fn is for hosts calling it directly
+var evalBuiltin = &object.Builtin{Name: "eval"}
 
-			var evaluatedArgs []any
-			for _, arg := range args[1:] {
-				var raw any
-				switch obj := arg.(type) {
+// evalBuiltin.Fn is assigned in init rather than at declaration because it goes through New, which references
+// evalBuiltin again, and Go doesn't allow that kind of initialization cycle
+func init() {
+	evalBuiltin.Fn = func(args ...object.Object) object.Object {
+		return New().evalSource(args, object.NewEnvironment())
+	}
+}
+
+// newBuiltins returns the builtin functions of in, the ones calling back into applyFunction evaluate in it
+func (in *Interpreter) newBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"len": &object.Builtin{
+			Name: "len",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `len`. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
 				case *object.String:
-					raw = obj.Value
-				case *object.Integer:
-					raw = obj.Value
+					return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 				case *object.Array:
-					raw = obj.Elements
-				case *object.Boolean:
-					raw = obj.Value
-				case *object.Range:
-					raw = obj.Inspect()
-				case *object.Null:
-					raw = nil
-				}
-				evaluatedArgs = append(evaluatedArgs, raw)
-			}
+					return &object.Integer{Value: int64(len(arg.Elements))}
+				case *object.Set:
+					return &object.Integer{Value: int64(len(arg.Elements))}
+				case *object.Queue:
+					return &object.Integer{Value: int64(len(arg.Elements))}
+				case *object.Stack:
+					return &object.Integer{Value: int64(len(arg.Elements))}
+				default:
+					return newError("argument to `len` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+		"type": &object.Builtin{
+			Name: "type",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `type`. got=%d, want=1", len(args))
+				}
 
-			fmt.Printf(str, evaluatedArgs...)
+				return &object.String{Value: string(args[0].Type())}
+			},
+		},
+		"push": &object.Builtin{
+			Name: "push",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `push`. got=%d, want=2",
+						len(args))
+				}
+				if args[0].Type() != object.ARRAY_OBJ {
+					return newError("argument to `push` must be ARRAY, got %s",
+						args[0].Type())
+				}
+
+				arr := args[0].(*object.Array)
+				length := len(arr.Elements)
 
-			return nil
+				newElements := make([]object.Object, length+1, length+1)
+				copy(newElements, arr.Elements)
+				newElements[length] = args[1]
+
+				return &object.Array{Elements: newElements}
+			},
 		},
-	},
+		"println": &object.Builtin{
+			Name: "println",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 {
+					return newError("wrong number of arguments to `println`. got=%d, want at least 1",
+						len(args))
+				}
+				if args[0].Type() != object.STRING_OBJ {
+					return newError("first argument to `println` must be STRING, got %s",
+						args[0].Type())
+				}
+
+				str := args[0].(*object.String).Value
+
+				var evaluatedArgs []any
+				for _, arg := range args[1:] {
+					var raw any
+					switch obj := arg.(type) {
+					case *object.String:
+						raw = obj.Value
+					case *object.Integer:
+						raw = obj.Value
+					case *object.Array:
+						raw = obj.Elements
+					case *object.Boolean:
+						raw = obj.Value
+					case *object.Range:
+						raw = obj.Inspect()
+					case *object.Null:
+						raw = nil
+					}
+					evaluatedArgs = append(evaluatedArgs, raw)
+				}
+
+				fmt.Printf(str, evaluatedArgs...)
+
+				return nil
+			},
+		},
+		// now returns the current Unix time in milliseconds
+		"now": &object.Builtin{
+			Name: "now",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments to `now`. got=%d, want=0", len(args))
+				}
+
+				return &object.Integer{Value: time.Now().UnixMilli()}
+			},
+		},
+		// clock returns the milliseconds elapsed since the interpreter started, prefer it over `now` to time code
+		"clock": &object.Builtin{
+			Name: "clock",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments to `clock`. got=%d, want=0", len(args))
+				}
+
+				return &object.Integer{Value: time.Since(startTime).Milliseconds()}
+			},
+		},
+		// sleep pauses execution for the given amount of milliseconds
+		"sleep": &object.Builtin{
+			Name: "sleep",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `sleep`. got=%d, want=1", len(args))
+				}
+
+				ms, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("argument to `sleep` must be INTEGER, got %s", args[0].Type())
+				}
+				if ms.Value < 0 {
+					return newError("argument to `sleep` must not be negative, got %d", ms.Value)
+				}
+				if ms.Value > math.MaxInt64/int64(time.Millisecond) {
+					return newError("argument to `sleep` is too large, got %d", ms.Value)
+				}
+
+				return in.sleep(time.Duration(ms.Value) * time.Millisecond)
+			},
+		},
+		// rand returns a random non-negative integer, or one in [0, n) when called as rand(n)
+		"rand": &object.Builtin{
+			Name: "rand",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments to `rand`. got=%d, want=0 or 1", len(args))
+				}
+
+				if len(args) == 0 {
+					return &object.Integer{Value: in.rng.Int63()}
+				}
+
+				n, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("argument to `rand` must be INTEGER, got %s", args[0].Type())
+				}
+				if n.Value <= 0 {
+					return newError("argument to `rand` must be greater than 0, got %d", n.Value)
+				}
+
+				return &object.Integer{Value: in.rng.Int63n(n.Value)}
+			},
+		},
+		"seed": &object.Builtin{
+			Name: "seed",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `seed`. got=%d, want=1", len(args))
+				}
+
+				n, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("argument to `seed` must be INTEGER, got %s", args[0].Type())
+				}
+
+				in.rng.Seed(n.Value)
+
+				return NULL
+			},
+		},
+		// sqrt returns the integer square root, rounded down, as there are no floats yet
+		"sqrt": &object.Builtin{
+			Name: "sqrt",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `sqrt`. got=%d, want=1", len(args))
+				}
+
+				n, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("argument to `sqrt` must be INTEGER, got %s", args[0].Type())
+				}
+				if n.Value < 0 {
+					return newError("argument to `sqrt` must not be negative, got %d", n.Value)
+				}
+
+				// math.Sqrt works on float64 which loses precision for big integers, so nudge the result into place
+				root := int64(math.Sqrt(float64(n.Value)))
+				// compared by dividing since squaring near the int64 limit overflows
+				for root > 0 && root > n.Value/root {
+					root--
+				}
+				for root+1 <= n.Value/(root+1) {
+					root++
+				}
+
+				return &object.Integer{Value: root}
+			},
+		},
+		"pow": &object.Builtin{
+			Name: "pow",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `pow`. got=%d, want=2", len(args))
+				}
+
+				base, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("first argument to `pow` must be INTEGER, got %s", args[0].Type())
+				}
+				exp, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError("second argument to `pow` must be INTEGER, got %s", args[1].Type())
+				}
+				if exp.Value < 0 {
+					return newError("second argument to `pow` must not be negative, got %d", exp.Value)
+				}
+
+				result := int64(1)
+				b := base.Value
+				for e := exp.Value; e > 0; e >>= 1 {
+					if e&1 == 1 {
+						if multiplyOverflows(result, b) {
+							return newError("result of `pow` is too large, got pow(%d, %d)", base.Value, exp.Value)
+						}
+						result *= b
+					}
+					if e > 1 {
+						if multiplyOverflows(b, b) {
+							return newError("result of `pow` is too large, got pow(%d, %d)", base.Value, exp.Value)
+						}
+						b *= b
+					}
+				}
+
+				return &object.Integer{Value: result}
+			},
+		},
+		"abs": &object.Builtin{
+			Name: "abs",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `abs`. got=%d, want=1", len(args))
+				}
+
+				n, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("argument to `abs` must be INTEGER, got %s", args[0].Type())
+				}
+
+				if n.Value < 0 {
+					return &object.Integer{Value: -n.Value}
+				}
+
+				return n
+			},
+		},
+		"sign": &object.Builtin{
+			Name: "sign",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `sign`. got=%d, want=1", len(args))
+				}
+
+				n, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("argument to `sign` must be INTEGER, got %s", args[0].Type())
+				}
+
+				switch {
+				case n.Value < 0:
+					return &object.Integer{Value: -1}
+				case n.Value > 0:
+					return &object.Integer{Value: 1}
+				default:
+					return &object.Integer{Value: 0}
+				}
+			},
+		},
+		"max": &object.Builtin{
+			Name: "max",
+			Fn: func(args ...object.Object) object.Object {
+				return extreme("max", args, 1)
+			},
+		},
+		"min": &object.Builtin{
+			Name: "min",
+			Fn: func(args ...object.Object) object.Object {
+				return extreme("min", args, -1)
+			},
+		},
+		"max_of": &object.Builtin{
+			Name: "max_of",
+			Fn: func(args ...object.Object) object.Object {
+				return extremeOf("max_of", args, 1)
+			},
+		},
+		"min_of": &object.Builtin{
+			Name: "min_of",
+			Fn: func(args ...object.Object) object.Object {
+				return extremeOf("min_of", args, -1)
+			},
+		},
+		// floor, ceil and round are no-ops on integers, they only make a difference for floats which aren't supported
+		// yet, but having them means numeric scripts don't need to special case integers
+		"floor": &object.Builtin{
+			Name: "floor",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `floor`. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != object.INTEGER_OBJ {
+					return newError("argument to `floor` must be INTEGER, got %s", args[0].Type())
+				}
+
+				return args[0]
+			},
+		},
+		"ceil": &object.Builtin{
+			Name: "ceil",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `ceil`. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != object.INTEGER_OBJ {
+					return newError("argument to `ceil` must be INTEGER, got %s", args[0].Type())
+				}
+
+				return args[0]
+			},
+		},
+		"round": &object.Builtin{
+			Name: "round",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `round`. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != object.INTEGER_OBJ {
+					return newError("argument to `round` must be INTEGER, got %s", args[0].Type())
+				}
+
+				return args[0]
+			},
+		},
+		"slice": &object.Builtin{
+			Name: "slice",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 || len(args) > 3 {
+					return newError("wrong number of arguments to `slice`. got=%d, want=1 to 3", len(args))
+				}
+
+				var start, end object.Object = NULL, NULL
+				if len(args) > 1 {
+					start = args[1]
+				}
+				if len(args) > 2 {
+					end = args[2]
+				}
+
+				switch arg := args[0].(type) {
+				case *object.Array:
+					from, to, err := sliceBounds(int64(len(arg.Elements)), start, end)
+					if err != nil {
+						return err
+					}
+
+					elements := make([]object.Object, to-from)
+					copy(elements, arg.Elements[from:to])
+
+					return &object.Array{Elements: elements}
+				case *object.String:
+					runes := []rune(arg.Value)
+
+					from, to, err := sliceBounds(int64(len(runes)), start, end)
+					if err != nil {
+						return err
+					}
+
+					return &object.String{Value: string(runes[from:to])}
+				default:
+					return newError("first argument to `slice` must be ARRAY or STRING, got %s", args[0].Type())
+				}
+			},
+		},
+		"parseInt": &object.Builtin{
+			Name: "parseInt",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `parseInt`. got=%d, want=1 or 2", len(args))
+				}
+
+				str, ok := args[0].(*object.String)
+				if !ok {
+					return newError("first argument to `parseInt` must be STRING, got %s", args[0].Type())
+				}
+
+				base := int64(10)
+				if len(args) == 2 {
+					b, ok := args[1].(*object.Integer)
+					if !ok {
+						return newError("second argument to `parseInt` must be INTEGER, got %s", args[1].Type())
+					}
+					if b.Value < 2 || b.Value > 36 {
+						return newError("base of `parseInt` must be between 2 and 36, got %d", b.Value)
+					}
+					base = b.Value
+				}
+
+				value, err := strconv.ParseInt(str.Value, int(base), 64)
+				if err != nil {
+					return newError("could not parse %q as integer in base %d", str.Value, base)
+				}
+
+				return &object.Integer{Value: value}
+			},
+		},
+		"chars": &object.Builtin{
+			Name: "chars",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `chars`. got=%d, want=1", len(args))
+				}
+
+				str, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `chars` must be STRING, got %s", args[0].Type())
+				}
+
+				runes := []rune(str.Value)
+				elements := make([]object.Object, len(runes))
+				for i, r := range runes {
+					elements[i] = &object.String{Value: string(r)}
+				}
+
+				return &object.Array{Elements: elements}
+			},
+		},
+		"bytes": &object.Builtin{
+			Name: "bytes",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `bytes`. got=%d, want=1", len(args))
+				}
+
+				str, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `bytes` must be STRING, got %s", args[0].Type())
+				}
+
+				elements := make([]object.Object, len(str.Value))
+				for i := 0; i < len(str.Value); i++ {
+					elements[i] = &object.Integer{Value: int64(str.Value[i])}
+				}
+
+				return &object.Array{Elements: elements}
+			},
+		},
+		"from_chars": &object.Builtin{
+			Name: "from_chars",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `from_chars`. got=%d, want=1", len(args))
+				}
+
+				arr, ok := args[0].(*object.Array)
+				if !ok {
+					return newError("argument to `from_chars` must be ARRAY, got %s", args[0].Type())
+				}
+
+				var out strings.Builder
+				for i, el := range arr.Elements {
+					char, ok := el.(*object.String)
+					if !ok {
+						return newError("element %d of `from_chars` must be STRING, got %s", i, el.Type())
+					}
+					if utf8.RuneCountInString(char.Value) != 1 {
+						return newError("element %d of `from_chars` must be a single character, got %q", i, char.Value)
+					}
+					out.WriteString(char.Value)
+				}
+
+				return &object.String{Value: out.String()}
+			},
+		},
+		"join": &object.Builtin{
+			Name: "join",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `join`. got=%d, want=2", len(args))
+				}
+
+				arr, ok := args[0].(*object.Array)
+				if !ok {
+					return newError("first argument to `join` must be ARRAY, got %s", args[0].Type())
+				}
+				sep, ok := args[1].(*object.String)
+				if !ok {
+					return newError("second argument to `join` must be STRING, got %s", args[1].Type())
+				}
+
+				parts := make([]string, len(arr.Elements))
+				for i, el := range arr.Elements {
+					str, ok := el.(*object.String)
+					if !ok {
+						return newError("element %d of `join` must be STRING, got %s", i, el.Type())
+					}
+					parts[i] = str.Value
+				}
+
+				return &object.String{Value: strings.Join(parts, sep.Value)}
+			},
+		},
+		"trim": &object.Builtin{
+			Name: "trim",
+			Fn:   trimBuiltin("trim", strings.TrimSpace, strings.Trim),
+		},
+		"trim_left": &object.Builtin{
+			Name: "trim_left",
+			Fn: trimBuiltin("trim_left", func(s string) string {
+				return strings.TrimLeftFunc(s, unicode.IsSpace)
+			}, strings.TrimLeft),
+		},
+		"trim_right": &object.Builtin{
+			Name: "trim_right",
+			Fn: trimBuiltin("trim_right", func(s string) string {
+				return strings.TrimRightFunc(s, unicode.IsSpace)
+			}, strings.TrimRight),
+		},
+		"enumerate": &object.Builtin{
+			Name: "enumerate",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `enumerate`. got=%d, want=1", len(args))
+				}
+
+				arr, ok := args[0].(*object.Array)
+				if !ok {
+					return newError("argument to `enumerate` must be ARRAY, got %s", args[0].Type())
+				}
+
+				pairs := make([]object.Object, len(arr.Elements))
+				for i, el := range arr.Elements {
+					pairs[i] = &object.Array{Elements: []object.Object{&object.Integer{Value: int64(i)}, el}}
+				}
+
+				return &object.Array{Elements: pairs}
+			},
+		},
+		"replace": &object.Builtin{
+			Name: "replace",
+			Fn: func(args ...object.Object) object.Object {
+				strs, err := stringArgs("replace", args, 3)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: strings.Replace(strs[0], strs[1], strs[2], 1)}
+			},
+		},
+		"replace_all": &object.Builtin{
+			Name: "replace_all",
+			Fn: func(args ...object.Object) object.Object {
+				strs, err := stringArgs("replace_all", args, 3)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+			},
+		},
+		"starts_with": &object.Builtin{
+			Name: "starts_with",
+			Fn:   stringPredicate("starts_with", strings.HasPrefix),
+		},
+		"ends_with": &object.Builtin{
+			Name: "ends_with",
+			Fn:   stringPredicate("ends_with", strings.HasSuffix),
+		},
+		// startsWith and endsWith are the camelCase spellings of starts_with and ends_with, matching contains and the
+		// rest of the newer builtins
+		"startsWith": &object.Builtin{
+			Name: "startsWith",
+			Fn:   stringPredicate("startsWith", strings.HasPrefix),
+		},
+		"endsWith": &object.Builtin{
+			Name: "endsWith",
+			Fn:   stringPredicate("endsWith", strings.HasSuffix),
+		},
+		"contains": &object.Builtin{
+			Name: "contains",
+			Fn:   stringPredicate("contains", strings.Contains),
+		},
+		"zip": &object.Builtin{
+			Name: "zip",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 2 {
+					return newError("wrong number of arguments to `zip`. got=%d, want at least 2", len(args))
+				}
+
+				arrays := make([]*object.Array, len(args))
+				length := -1
+				for i, arg := range args {
+					arr, ok := arg.(*object.Array)
+					if !ok {
+						return newError("arguments to `zip` must be ARRAY, got %s", arg.Type())
+					}
+					arrays[i] = arr
+
+					if length == -1 || len(arr.Elements) < length {
+						length = len(arr.Elements)
+					}
+				}
+
+				tuples := make([]object.Object, length)
+				for i := range tuples {
+					tuple := make([]object.Object, len(arrays))
+					for j, arr := range arrays {
+						tuple[j] = arr.Elements[i]
+					}
+					tuples[i] = &object.Array{Elements: tuple}
+				}
+
+				return &object.Array{Elements: tuples}
+			},
+		},
+		// the case builtins use x/text/cases rather than the strings package since it implements the full unicode case
+		// mappings, e.g. upper("ß") is "SS", where strings.ToUpper only maps rune to rune
+		"upper": &object.Builtin{
+			Name: "upper",
+			Fn: func(args ...object.Object) object.Object {
+				strs, err := stringArgs("upper", args, 1)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: cases.Upper(language.Und).String(strs[0])}
+			},
+		},
+		"lower": &object.Builtin{
+			Name: "lower",
+			Fn: func(args ...object.Object) object.Object {
+				strs, err := stringArgs("lower", args, 1)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: cases.Lower(language.Und).String(strs[0])}
+			},
+		},
+		"title": &object.Builtin{
+			Name: "title",
+			Fn: func(args ...object.Object) object.Object {
+				strs, err := stringArgs("title", args, 1)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: cases.Title(language.Und).String(strs[0])}
+			},
+		},
+		"base64Encode": &object.Builtin{
+			Name: "base64Encode",
+			Fn: func(args ...object.Object) object.Object {
+				strs, err := stringArgs("base64Encode", args, 1)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: base64.StdEncoding.EncodeToString([]byte(strs[0]))}
+			},
+		},
+		"base64Decode": &object.Builtin{
+			Name: "base64Decode",
+			Fn: func(args ...object.Object) object.Object {
+				strs, err := stringArgs("base64Decode", args, 1)
+				if err != nil {
+					return err
+				}
+
+				decoded, decodeErr := base64.StdEncoding.DecodeString(strs[0])
+				if decodeErr != nil {
+					return newError("could not decode %q as base64", strs[0])
+				}
+
+				return &object.String{Value: string(decoded)}
+			},
+		},
+		"regexMatch": &object.Builtin{
+			Name: "regexMatch",
+			Fn: func(args ...object.Object) object.Object {
+				re, strs, err := regexArgs("regexMatch", args, 2)
+				if err != nil {
+					return err
+				}
+
+				return nativeBooleanToObject(re.MatchString(strs[0]))
+			},
+		},
+		// regexFind(pattern, s) returns the leftmost match of pattern in s, or null when there's none
+		"regexFind": &object.Builtin{
+			Name: "regexFind",
+			Fn: func(args ...object.Object) object.Object {
+				re, strs, err := regexArgs("regexFind", args, 2)
+				if err != nil {
+					return err
+				}
+
+				loc := re.FindStringIndex(strs[0])
+				if loc == nil {
+					return NULL
+				}
+
+				return &object.String{Value: strs[0][loc[0]:loc[1]]}
+			},
+		},
+		// regexReplace(pattern, s, repl) replaces every match of pattern in s, repl can refer to the match's groups
+		// as $1, or ${1} when followed by more of a name, like `regexp.ReplaceAllString`
+		"regexReplace": &object.Builtin{
+			Name: "regexReplace",
+			Fn: func(args ...object.Object) object.Object {
+				re, strs, err := regexArgs("regexReplace", args, 3)
+				if err != nil {
+					return err
+				}
+
+				return &object.String{Value: re.ReplaceAllString(strs[0], strs[1])}
+			},
+		},
+		// regexSplit(pattern, s) returns the pieces of s between the matches of pattern
+		"regexSplit": &object.Builtin{
+			Name: "regexSplit",
+			Fn: func(args ...object.Object) object.Object {
+				re, strs, err := regexArgs("regexSplit", args, 2)
+				if err != nil {
+					return err
+				}
+
+				pieces := re.Split(strs[0], -1)
+				elements := make([]object.Object, len(pieces))
+				for i, piece := range pieces {
+					elements[i] = &object.String{Value: piece}
+				}
+
+				return &object.Array{Elements: elements}
+			},
+		},
+		"index_of": &object.Builtin{
+			Name: "index_of",
+			Fn: func(args ...object.Object) object.Object {
+				return in.indexOf("index_of", args, false, false)
+			},
+		},
+		"last_index_of": &object.Builtin{
+			Name: "last_index_of",
+			Fn: func(args ...object.Object) object.Object {
+				return in.indexOf("last_index_of", args, true, false)
+			},
+		},
+		// indexOf is the string only form of index_of, but the rune index of the first occurrence of sub in s, or -1
+		"indexOf": &object.Builtin{
+			Name: "indexOf",
+			Fn: func(args ...object.Object) object.Object {
+				if _, err := stringArgs("indexOf", args, 2); err != nil {
+					return err
+				}
+
+				return in.indexOf("indexOf", args, false, true)
+			},
+		},
+		// substring(s, start, end) returns the runes of s from start up to, not including, end. Unlike slice the
+		// bounds aren't clamped, they're checked like `s[start:end]` checks them
+		"substring": &object.Builtin{
+			Name: "substring",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 3 {
+					return newError("wrong number of arguments to `substring`. got=%d, want=3", len(args))
+				}
+
+				str, ok := args[0].(*object.String)
+				if !ok {
+					return newError("first argument to `substring` must be STRING, got %s", args[0].Type())
+				}
+
+				bounds := make([]int64, 2)
+				for i, arg := range args[1:] {
+					integer, ok := arg.(*object.Integer)
+					if !ok {
+						return newError("bounds of `substring` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+
+				runes := []rune(str.Value)
+				start, end := bounds[0], bounds[1]
+				if start < 0 || end < start || end > int64(len(runes)) {
+					return newError("range index out of bounds, index=%d:%d len=%d", start, end, len(runes))
+				}
+
+				return &object.String{Value: string(runes[start:end])}
+			},
+		},
+		// flatten flattens a single level of nesting by default, or up to the given depth, where -1 means all the way
+		"flatten": &object.Builtin{
+			Name: "flatten",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `flatten`. got=%d, want=1 or 2", len(args))
+				}
+
+				arr, ok := args[0].(*object.Array)
+				if !ok {
+					return newError("first argument to `flatten` must be ARRAY, got %s", args[0].Type())
+				}
+
+				depth := int64(1)
+				if len(args) == 2 {
+					d, ok := args[1].(*object.Integer)
+					if !ok {
+						return newError("second argument to `flatten` must be INTEGER, got %s", args[1].Type())
+					}
+					if d.Value < -1 {
+						return newError("depth of `flatten` must be -1 or greater, got %d", d.Value)
+					}
+					depth = d.Value
+				}
+
+				return &object.Array{Elements: flatten(arr.Elements, depth)}
+			},
+		},
+		"repeat": &object.Builtin{
+			Name: "repeat",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `repeat`. got=%d, want=2", len(args))
+				}
+
+				n, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError("second argument to `repeat` must be INTEGER, got %s", args[1].Type())
+				}
+				if n.Value < 0 {
+					return newError("second argument to `repeat` must not be negative, got %d", n.Value)
+				}
+
+				switch arg := args[0].(type) {
+				case *object.String:
+					if repeatTooLong(len(arg.Value), n.Value) {
+						return newError("second argument to `repeat` is too large, got %d", n.Value)
+					}
+
+					return &object.String{Value: strings.Repeat(arg.Value, int(n.Value))}
+				case *object.Array:
+					if repeatTooLong(len(arg.Elements), n.Value) {
+						return newError("second argument to `repeat` is too large, got %d", n.Value)
+					}
+					// the count can be huge when there's nothing to repeat, don't loop over it
+					if len(arg.Elements) == 0 {
+						return &object.Array{Elements: []object.Object{}}
+					}
+
+					elements := make([]object.Object, 0, len(arg.Elements)*int(n.Value))
+					for i := int64(0); i < n.Value; i++ {
+						elements = append(elements, arg.Elements...)
+					}
+
+					return &object.Array{Elements: elements}
+				default:
+					return newError("first argument to `repeat` must be STRING or ARRAY, got %s", args[0].Type())
+				}
+			},
+		},
+		"unique": &object.Builtin{
+			Name: "unique",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `unique`. got=%d, want=1", len(args))
+				}
+
+				arr, ok := args[0].(*object.Array)
+				if !ok {
+					return newError("argument to `unique` must be ARRAY, got %s", args[0].Type())
+				}
+
+				seen := make(map[object.HashKey]bool)
+				var unhashable []object.Object
+				elements := []object.Object{}
+
+			outer:
+				for _, el := range arr.Elements {
+					// hashable elements can be looked up by their HashKey, anything else falls back to comparing
+					// with == against the unhashable elements seen so far
+					if hashable, ok := el.(object.Hashable); ok {
+						key := hashable.HashKey()
+						if seen[key] {
+							continue
+						}
+						seen[key] = true
+					} else {
+						for _, u := range unhashable {
+							if in.evalInfixExpression("==", u, el) == TRUE {
+								continue outer
+							}
+						}
+						unhashable = append(unhashable, el)
+					}
+
+					elements = append(elements, el)
+				}
+
+				return &object.Array{Elements: elements}
+			},
+		},
+		"find": &object.Builtin{
+			Name: "find",
+			Fn: func(args ...object.Object) object.Object {
+				index, found := in.findIndex("find", args)
+				if isError(found) {
+					return found
+				}
+				if index == -1 {
+					return NULL
+				}
+
+				return found
+			},
+		},
+		"findIndex": &object.Builtin{
+			Name: "findIndex",
+			Fn: func(args ...object.Object) object.Object {
+				index, found := in.findIndex("findIndex", args)
+				if isError(found) {
+					return found
+				}
+
+				return &object.Integer{Value: int64(index)}
+			},
+		},
+		"all": &object.Builtin{
+			Name: "all",
+			Fn: func(args ...object.Object) object.Object {
+				return in.matchAll("all", args, false)
+			},
+		},
+		"any": &object.Builtin{
+			Name: "any",
+			Fn: func(args ...object.Object) object.Object {
+				return in.matchAll("any", args, true)
+			},
+		},
+		"sum": &object.Builtin{
+			Name: "sum",
+			Fn: func(args ...object.Object) object.Object {
+				return fold("sum", args, 0, func(acc, n int64) int64 { return acc + n })
+			},
+		},
+		"product": &object.Builtin{
+			Name: "product",
+			Fn: func(args ...object.Object) object.Object {
+				return fold("product", args, 1, func(acc, n int64) int64 { return acc * n })
+			},
+		},
+		"apply": &object.Builtin{
+			Name: "apply",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `apply`. got=%d, want=2", len(args))
+				}
+				if !isCallable(args[0]) {
+					return newError("first argument to `apply` must be FUNCTION or BUILTIN, got %s", args[0].Type())
+				}
+
+				arr, ok := args[1].(*object.Array)
+				if !ok {
+					return newError("second argument to `apply` must be ARRAY, got %s", args[1].Type())
+				}
+
+				return in.applyFunction(args[0], arr.Elements)
+			},
+		},
+		// delete returns a copy of the hash without the given key, the hash itself is left untouched
+		"delete": &object.Builtin{
+			Name: "delete",
+			Fn: func(args ...object.Object) object.Object {
+				hash, key, err := hashKeyArgs("delete", args)
+				if err != nil {
+					return err
+				}
+
+				if _, ok := hash.Pairs[key]; !ok {
+					return hash
+				}
+
+				pairs := make(map[object.HashKey]object.HashPair, len(hash.Pairs)-1)
+				for k, pair := range hash.Pairs {
+					if k != key {
+						pairs[k] = pair
+					}
+				}
+
+				return &object.Hash{Pairs: pairs}
+			},
+		},
+		// merge combines hashes left to right into a new hash, so on duplicate keys the rightmost value wins
+		"merge": &object.Builtin{
+			Name: "merge",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 2 {
+					return newError("wrong number of arguments to `merge`. got=%d, want at least 2", len(args))
+				}
+
+				pairs := make(map[object.HashKey]object.HashPair)
+				for _, arg := range args {
+					hash, ok := arg.(*object.Hash)
+					if !ok {
+						return newError("arguments to `merge` must be HASH, got %s", arg.Type())
+					}
+
+					for key, pair := range hash.Pairs {
+						pairs[key] = pair
+					}
+				}
+
+				return &object.Hash{Pairs: pairs}
+			},
+		},
+		// get looks up a key like indexing does, but returns the default, if given, rather than NULL for missing keys
+		"get": &object.Builtin{
+			Name: "get",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 && len(args) != 3 {
+					return newError("wrong number of arguments to `get`. got=%d, want=2 or 3", len(args))
+				}
+
+				hash, key, err := hashKeyArgs("get", args[:2])
+				if err != nil {
+					return err
+				}
+
+				if pair, ok := hash.Pairs[key]; ok {
+					return pair.Value
+				}
+
+				if len(args) == 3 {
+					return args[2]
+				}
+
+				return NULL
+			},
+		},
+		"has_key": &object.Builtin{
+			Name: "has_key",
+			Fn: func(args ...object.Object) object.Object {
+				hash, key, err := hashKeyArgs("has_key", args)
+				if err != nil {
+					return err
+				}
+
+				_, ok := hash.Pairs[key]
+				return nativeBooleanToObject(ok)
+			},
+		},
+		// set(arr) returns a set of the array's elements without duplicates, set() an empty one, sets never change,
+		// setAdd, setRemove and the set algebra builtins all return new sets
+		"set": &object.Builtin{
+			Name: "set",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments to `set`. got=%d, want=0 or 1", len(args))
+				}
+
+				set := &object.Set{Elements: map[object.HashKey]object.Object{}}
+				if len(args) == 0 {
+					return set
+				}
+
+				arr, ok := args[0].(*object.Array)
+				if !ok {
+					return newError("argument to `set` must be ARRAY, got %s", args[0].Type())
+				}
+
+				for _, el := range arr.Elements {
+					hashable, ok := el.(object.Hashable)
+					if !ok {
+						return newError("unusable as set element: %s", el.Type())
+					}
+					set.Elements[hashable.HashKey()] = el
+				}
+
+				return set
+			},
+		},
+		"setAdd": &object.Builtin{
+			Name: "setAdd",
+			Fn: func(args ...object.Object) object.Object {
+				set, key, err := setElementArgs("setAdd", args)
+				if err != nil {
+					return err
+				}
+
+				if _, ok := set.Elements[key]; ok {
+					return set
+				}
+
+				added := copySet(set)
+				added.Elements[key] = args[1]
+				return added
+			},
+		},
+		"setHas": &object.Builtin{
+			Name: "setHas",
+			Fn: func(args ...object.Object) object.Object {
+				set, key, err := setElementArgs("setHas", args)
+				if err != nil {
+					return err
+				}
+
+				_, ok := set.Elements[key]
+				return nativeBooleanToObject(ok)
+			},
+		},
+		"setRemove": &object.Builtin{
+			Name: "setRemove",
+			Fn: func(args ...object.Object) object.Object {
+				set, key, err := setElementArgs("setRemove", args)
+				if err != nil {
+					return err
+				}
+
+				if _, ok := set.Elements[key]; !ok {
+					return set
+				}
+
+				removed := copySet(set)
+				delete(removed.Elements, key)
+				return removed
+			},
+		},
+		"union": &object.Builtin{
+			Name: "union",
+			Fn: func(args ...object.Object) object.Object {
+				a, b, err := setPairArgs("union", args)
+				if err != nil {
+					return err
+				}
+
+				union := copySet(a)
+				for key, el := range b.Elements {
+					union.Elements[key] = el
+				}
+				return union
+			},
+		},
+		"intersection": &object.Builtin{
+			Name: "intersection",
+			Fn: func(args ...object.Object) object.Object {
+				a, b, err := setPairArgs("intersection", args)
+				if err != nil {
+					return err
+				}
+
+				intersection := &object.Set{Elements: map[object.HashKey]object.Object{}}
+				for key, el := range a.Elements {
+					if _, ok := b.Elements[key]; ok {
+						intersection.Elements[key] = el
+					}
+				}
+				return intersection
+			},
+		},
+		"difference": &object.Builtin{
+			Name: "difference",
+			Fn: func(args ...object.Object) object.Object {
+				a, b, err := setPairArgs("difference", args)
+				if err != nil {
+					return err
+				}
+
+				difference := &object.Set{Elements: map[object.HashKey]object.Object{}}
+				for key, el := range a.Elements {
+					if _, ok := b.Elements[key]; !ok {
+						difference.Elements[key] = el
+					}
+				}
+				return difference
+			},
+		},
+		"queue": &object.Builtin{
+			Name: "queue",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments to `queue`. got=%d, want=0", len(args))
+				}
+
+				return &object.Queue{Elements: []object.Object{}}
+			},
+		},
+		"enqueue": &object.Builtin{
+			Name: "enqueue",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `enqueue`. got=%d, want=2", len(args))
+				}
+
+				queue, ok := args[0].(*object.Queue)
+				if !ok {
+					return newError("first argument to `enqueue` must be QUEUE, got %s", args[0].Type())
+				}
+
+				return &object.Queue{Elements: appendElement(queue.Elements, args[1])}
+			},
+		},
+		// dequeue(q) returns [front, rest], where rest is a queue of everything behind front
+		"dequeue": &object.Builtin{
+			Name: "dequeue",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `dequeue`. got=%d, want=1", len(args))
+				}
+
+				queue, ok := args[0].(*object.Queue)
+				if !ok {
+					return newError("argument to `dequeue` must be QUEUE, got %s", args[0].Type())
+				}
+				if len(queue.Elements) == 0 {
+					return newError("cannot dequeue from an empty queue")
+				}
+
+				rest := &object.Queue{Elements: queue.Elements[1:]}
+				return &object.Array{Elements: []object.Object{queue.Elements[0], rest}}
+			},
+		},
+		"stack": &object.Builtin{
+			Name: "stack",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments to `stack`. got=%d, want=0", len(args))
+				}
+
+				return &object.Stack{Elements: []object.Object{}}
+			},
+		},
+		"push_stack": &object.Builtin{
+			Name: "push_stack",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `push_stack`. got=%d, want=2", len(args))
+				}
+
+				stack, ok := args[0].(*object.Stack)
+				if !ok {
+					return newError("first argument to `push_stack` must be STACK, got %s", args[0].Type())
+				}
+
+				return &object.Stack{Elements: appendElement(stack.Elements, args[1])}
+			},
+		},
+		// pop_stack(s) returns [top, rest], where rest is a stack of everything below top
+		"pop_stack": &object.Builtin{
+			Name: "pop_stack",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `pop_stack`. got=%d, want=1", len(args))
+				}
+
+				stack, ok := args[0].(*object.Stack)
+				if !ok {
+					return newError("argument to `pop_stack` must be STACK, got %s", args[0].Type())
+				}
+				if len(stack.Elements) == 0 {
+					return newError("cannot pop from an empty stack")
+				}
+
+				top := len(stack.Elements) - 1
+				rest := &object.Stack{Elements: stack.Elements[:top]}
+				return &object.Array{Elements: []object.Object{stack.Elements[top], rest}}
+			},
+		},
+		// builderNew() returns an empty string builder, builderAppend adds to it in place, which unlike `s = s + x`
+		// doesn't copy the whole string each time, and builderString returns what it holds
+		"builderNew": &object.Builtin{
+			Name: "builderNew",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments to `builderNew`. got=%d, want=0", len(args))
+				}
+
+				return &object.StringBuilder{}
+			},
+		},
+		// builderAppend(b, x) appends x to b and returns b, like `+` values other than strings are appended as
+		// they're inspected
+		"builderAppend": &object.Builtin{
+			Name: "builderAppend",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `builderAppend`. got=%d, want=2", len(args))
+				}
+
+				builder, ok := args[0].(*object.StringBuilder)
+				if !ok {
+					return newError("first argument to `builderAppend` must be STRING_BUILDER, got %s", args[0].Type())
+				}
+
+				if str, ok := args[1].(*object.String); ok {
+					builder.Builder.WriteString(str.Value)
+				} else {
+					builder.Builder.WriteString(args[1].Inspect())
+				}
+
+				return builder
+			},
+		},
+		"builderString": &object.Builtin{
+			Name: "builderString",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `builderString`. got=%d, want=1", len(args))
+				}
+
+				builder, ok := args[0].(*object.StringBuilder)
+				if !ok {
+					return newError("argument to `builderString` must be STRING_BUILDER, got %s", args[0].Type())
+				}
+
+				return &object.String{Value: builder.Builder.String()}
+			},
+		},
+		// lazyRange(start, end, step) returns an iterator over the integers from start up to, not including, end, or down
+		// to it when step is negative, step defaults to 1. Unlike a range they're only produced as they're needed
+		"lazyRange": &object.Builtin{
+			Name: "lazyRange",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 && len(args) != 3 {
+					return newError("wrong number of arguments to `lazyRange`. got=%d, want=2 or 3", len(args))
+				}
+
+				bounds := []int64{0, 0, 1}
+				for i, arg := range args {
+					integer, ok := arg.(*object.Integer)
+					if !ok {
+						return newError("arguments to `lazyRange` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+
+				current, end, step := bounds[0], bounds[1], bounds[2]
+				if step == 0 {
+					return newError("step of `lazyRange` must not be 0")
+				}
+
+				done := false
+				return &object.Iterator{Next: func() (object.Object, bool) {
+					if done || (step > 0 && current >= end) || (step < 0 && current <= end) {
+						return nil, false
+					}
+
+					// stepping past end can overflow near the int64 limits, so it's the distance left to end that's
+					// compared to step, unsigned since it can be larger than the largest int64
+					value := current
+					if step > 0 {
+						done = uint64(end)-uint64(current) <= uint64(step)
+					} else {
+						done = uint64(current)-uint64(end) <= -uint64(step)
+					}
+					if !done {
+						current += step
+					}
+
+					return &object.Integer{Value: value}, true
+				}}
+			},
+		},
+		// lazyMap(xs, f) returns an iterator over f applied to each value of xs, which can be anything a for loop can
+		// iterate over, f is only called when the next value is asked for
+		"lazyMap": &object.Builtin{
+			Name: "lazyMap",
+			Fn: func(args ...object.Object) object.Object {
+				next, f, err := lazyArgs("lazyMap", args)
+				if err != nil {
+					return err
+				}
+
+				return &object.Iterator{Next: func() (object.Object, bool) {
+					value, ok := next()
+					if !ok || isError(value) {
+						return value, ok
+					}
+					return in.applyFunction(f, []object.Object{value}), true
+				}}
+			},
+		},
+		// lazyFilter(xs, f) returns an iterator over the values of xs for which f is truthy
+		"lazyFilter": &object.Builtin{
+			Name: "lazyFilter",
+			Fn: func(args ...object.Object) object.Object {
+				next, f, err := lazyArgs("lazyFilter", args)
+				if err != nil {
+					return err
+				}
+
+				return &object.Iterator{Next: func() (object.Object, bool) {
+					for {
+						value, ok := next()
+						if !ok || isError(value) {
+							return value, ok
+						}
+
+						keep := in.applyFunction(f, []object.Object{value})
+						if isError(keep) {
+							return keep, true
+						}
+						if isTruthy(keep) {
+							return value, true
+						}
+					}
+				}}
+			},
+		},
+		// next(it), or it.next(), returns the iterator's next value, null once it has none left
+		"next": &object.Builtin{
+			Name: "next",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `next`. got=%d, want=1", len(args))
+				}
+
+				iterator, ok := args[0].(*object.Iterator)
+				if !ok {
+					return newError("argument to `next` must be ITERATOR, got %s", args[0].Type())
+				}
+
+				value, ok := iterator.Next()
+				if !ok {
+					return NULL
+				}
+				return value
+			},
+		},
+		// compose(f, g) returns a function equivalent to fn(x) { f(g(x)) }
+		"compose": &object.Builtin{
+			Name: "compose",
+			Fn: func(args ...object.Object) object.Object {
+				fns := make([]object.Object, len(args))
+				for i, arg := range args {
+					fns[len(args)-1-i] = arg
+				}
+
+				return in.chainFunctions("compose", fns)
+			},
+		},
+		// pipe(f, g) returns a function equivalent to fn(x) { g(f(x)) }
+		"pipe": &object.Builtin{
+			Name: "pipe",
+			Fn: func(args ...object.Object) object.Object {
+				return in.chainFunctions("pipe", args)
+			},
+		},
+		"curry": &object.Builtin{
+			Name: "curry",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 {
+					return newError("wrong number of arguments to `curry`. got=%d, want at least 1",
+						len(args))
+				}
+				if !isCallable(args[0]) {
+					return newError("first argument to `curry` must be FUNCTION or BUILTIN, got %s",
+						args[0].Type())
+				}
+
+				fn := args[0]
+				partialArgs := args[1:]
+
+				if len(partialArgs) == 0 {
+					return fn
+				}
+
+				// builtins don't declare their arity so only functions can be over-applied
+				if function, ok := fn.(*object.Function); ok && len(partialArgs) > len(function.Parameters) {
+					return in.applyFunction(fn, partialArgs)
+				}
+
+				return &object.Builtin{
+					Fn: func(args ...object.Object) object.Object {
+						curriedArgs := make([]object.Object, 0, len(partialArgs)+len(args))
+						curriedArgs = append(curriedArgs, partialArgs...)
+						curriedArgs = append(curriedArgs, args...)
+
+						return in.applyFunction(fn, curriedArgs)
+					},
+				}
+			},
+		},
+		"memoize": &object.Builtin{
+			Name: "memoize",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `memoize`. got=%d, want=1", len(args))
+				}
+				if !isCallable(args[0]) {
+					return newError("argument to `memoize` must be FUNCTION or BUILTIN, got %s",
+						args[0].Type())
+				}
+
+				fn := args[0]
+				cache := make(map[string]object.Object)
+
+				return &object.Builtin{
+					Fn: func(args ...object.Object) object.Object {
+						// calls with arguments which can't be hashed, like arrays, aren't cached at all
+						key, ok := memoKey(args)
+						if !ok {
+							return in.applyFunction(fn, args)
+						}
+
+						if result, ok := cache[key]; ok {
+							return result
+						}
+
+						result := in.applyFunction(fn, args)
+						// errors aren't cached so that a failed call can be retried
+						if !isError(result) {
+							cache[key] = result
+						}
+
+						return result
+					},
+				}
+			},
+		},
+		"once": &object.Builtin{
+			Name: "once",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `once`. got=%d, want=1", len(args))
+				}
+				if !isCallable(args[0]) {
+					return newError("argument to `once` must be FUNCTION or BUILTIN, got %s",
+						args[0].Type())
+				}
+
+				fn := args[0]
+
+				// not using sync.Once since a failed first call must not count as the one call, errors are retried
+				var mu sync.Mutex
+				var result object.Object
+				var calling bool
+
+				return &object.Builtin{
+					Name: "once",
+					Fn: func(args ...object.Object) object.Object {
+						mu.Lock()
+						if result != nil {
+							mu.Unlock()
+							return result
+						}
+						// the lock isn't held while fn runs, a call from inside fn would wait on itself forever
+						if calling {
+							mu.Unlock()
+							return newError("function passed to `once` was called again before its first call returned")
+						}
+						calling = true
+						mu.Unlock()
+
+						evaluated := in.applyFunction(fn, args)
+
+						mu.Lock()
+						defer mu.Unlock()
+
+						calling = false
+						if !isError(evaluated) {
+							result = evaluated
+						}
+
+						return evaluated
+					},
+				}
+			},
+		},
+		"readFile":  readFileBuiltin,
+		"writeFile": writeFileBuiltin,
+		"exit":      exitBuiltin,
+		// `assert` is for tests written in Monkey, a failed assertion is an error so it stops the script
+		"assert": &object.Builtin{
+			Name: "assert",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments to `assert`. got=%d, want=1 or 2", len(args))
+				}
+
+				if isTruthy(args[0]) {
+					return NULL
+				}
+
+				if len(args) == 1 {
+					return newError("assertion failed")
+				}
+
+				message, ok := args[1].(*object.String)
+				if !ok {
+					return newError("second argument to `assert` must be STRING, got %s", args[1].Type())
+				}
+
+				return newError("assertion failed: %s", message.Value)
+			},
+		},
+		// error(msg) makes an error value, unlike the errors evaluation fails with it's passed around like any other
+		// value, and its message is `err.Message`
+		"error": &object.Builtin{
+			Name: "error",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `error`. got=%d, want=1", len(args))
+				}
+
+				msg, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `error` must be STRING, got %s", args[0].Type())
+				}
+
+				return &object.Error{Message: msg.Value, Value: true}
+			},
+		},
+		// wrap_error(err, msg) adds context to err, returning a new error whose message is prefixed by msg and which
+		// remembers err as the one it wraps. Wrapping an error value made by `error` gives an error value too
+		"wrap_error": &object.Builtin{
+			Name: "wrap_error",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `wrap_error`. got=%d, want=2", len(args))
+				}
+
+				err, ok := args[0].(*object.Error)
+				if !ok {
+					return newError("first argument to `wrap_error` must be ERROR, got %s", args[0].Type())
+				}
+				msg, ok := args[1].(*object.String)
+				if !ok {
+					return newError("second argument to `wrap_error` must be STRING, got %s", args[1].Type())
+				}
+
+				return &object.Error{Message: msg.Value + ": " + err.Message, Pos: err.Pos, Wrapped: err, Value: err.Value}
+			},
+		},
+		"unwrap_error": &object.Builtin{
+			Name: "unwrap_error",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `unwrap_error`. got=%d, want=1", len(args))
+				}
+
+				err, ok := args[0].(*object.Error)
+				if !ok {
+					return newError("argument to `unwrap_error` must be ERROR, got %s", args[0].Type())
+				}
+
+				if err.Wrapped == nil {
+					return NULL
+				}
+				return err.Wrapped
+			},
+		},
+		// only direct calls see the caller's variables, Eval handles those, when it's passed around like `apply(eval, [src])` the
+		// source runs in an environment of its own
+		"eval": evalBuiltin,
+	}
+}
+
+// sleep waits for d to pass, or for the interpreter's context to be done so that a deadline or a cancel doesn't have
+// to wait for the sleep to finish
+func (in *Interpreter) sleep(d time.Duration) object.Object {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return NULL
+	case <-in.ctx.Done():
+		return in.checkContext()
+	}
+}
+
+// memoKey is the `memoize` cache key of args, built from their hash keys, which include the type, so neither 1 and "1"
+// nor one argument and several can be mixed up. It reports false when an argument isn't hashable
+func memoKey(args []object.Object) (string, bool) {
+	var key strings.Builder
+	for _, arg := range args {
+		hashable, ok := arg.(object.Hashable)
+		if !ok {
+			return "", false
+		}
+
+		hashKey := hashable.HashKey()
+		fmt.Fprintf(&key, "%s:%d;", hashKey.Type, hashKey.Value)
+	}
+
+	return key.String(), true
+}
+
+// evalSource is `eval`, it parses its STRING argument as a program and evaluates it in env
+func (in *Interpreter) evalSource(args []object.Object, env *object.Environment) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `eval`. got=%d, want=1", len(args))
+	}
+
+	source, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `eval` must be STRING, got %s", args[0].Type())
+	}
+
+	p := parser.New(lexer.New(source.Value))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("cannot eval, the source has parser errors: %s", strings.Join(p.Errors(), ", "))
+	}
+
+	// an empty program or one ending in a let has no value
+	if result := in.evalNode(program, env); result != nil {
+		return result
+	}
+	return NULL
+}
+
+// sliceBounds resolves `slice` bounds Python style, NULL means the start or end of the collection, negative indexes
+// count from the end, and anything out of range is clamped rather than reported as an error
+func sliceBounds(length int64, start, end object.Object) (int64, int64, *object.Error) {
+	from, err := sliceBound(length, start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	to, err := sliceBound(length, end, length)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if to < from {
+		to = from
+	}
+
+	return from, to, nil
+}
+
+func sliceBound(length int64, bound object.Object, fallback int64) (int64, *object.Error) {
+	switch bound := bound.(type) {
+	case *object.Null:
+		return fallback, nil
+	case *object.Integer:
+		index := bound.Value
+		if index < 0 {
+			index += length
+		}
+
+		return min(max(index, 0), length), nil
+	default:
+		return 0, newError("bounds of `slice` must be INTEGER or NULL, got %s", bound.Type())
+	}
+}
+
+// stringPredicate builds a builtin testing two strings with pred, like `starts_with(s, prefix)`
+func stringPredicate(name string, pred func(s, substr string) bool) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		strs, err := stringArgs(name, args, 2)
+		if err != nil {
+			return err
+		}
+
+		return nativeBooleanToObject(pred(strs[0], strs[1]))
+	}
+}
+
+// trimBuiltin builds the `trim` family of builtins, which trim whitespace when given only a string, or the characters
+// in the cutset when given one as a second argument
+func trimBuiltin(
+	name string,
+	trimSpace func(s string) string,
+	trimCutset func(s, cutset string) string,
+) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1 or 2", name, len(args))
+		}
+
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return newError("first argument to `%s` must be STRING, got %s", name, args[0].Type())
+		}
+
+		if len(args) == 1 {
+			return &object.String{Value: trimSpace(str.Value)}
+		}
+
+		cutset, ok := args[1].(*object.String)
+		if !ok {
+			return newError("second argument to `%s` must be STRING, got %s", name, args[1].Type())
+		}
+
+		return &object.String{Value: trimCutset(str.Value, cutset.Value)}
+	}
+}
+
+// stringArgs checks that a builtin got exactly `want` arguments, all of them strings, and unwraps them
+func stringArgs(name string, args []object.Object, want int) ([]string, *object.Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments to `%s`. got=%d, want=%d", name, len(args), want)
+	}
+
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("arguments to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		strs[i] = str.Value
+	}
+
+	return strs, nil
+}
+
+// regexArgs checks the string arguments of the regex builtins, the pattern followed by want-1 others, and compiles the
+// pattern, or takes it from the cache when it's been compiled before
+func regexArgs(name string, args []object.Object, want int) (*regexp.Regexp, []string, *object.Error) {
+	strs, err := stringArgs(name, args, want)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	regexpsMu.Lock()
+	defer regexpsMu.Unlock()
+
+	if cached, ok := regexps[strs[0]]; ok {
+		regexpsOrder.MoveToFront(cached)
+		return cached.Value.(*regexp.Regexp), strs[1:], nil
+	}
+
+	re, compileErr := regexp.Compile(strs[0])
+	if compileErr != nil {
+		return nil, nil, newError("could not compile pattern %q: %s", strs[0], compileErr)
+	}
+
+	regexps[strs[0]] = regexpsOrder.PushFront(re)
+	if regexpsOrder.Len() > maxRegexps {
+		oldest := regexpsOrder.Remove(regexpsOrder.Back()).(*regexp.Regexp)
+		delete(regexps, oldest.String())
+	}
+
+	return re, strs[1:], nil
+}
+
+// indexOf finds the first, or last, position of an element in an array or of a substring in a string, returning -1
+// when there's none. Positions in strings are byte indexes, or rune indexes, which can be used to index the string,
+// when runes is set
+func (in *Interpreter) indexOf(name string, args []object.Object, last bool, runes bool) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `%s`. got=%d, want=2", name, len(args))
+	}
+
+	switch collection := args[0].(type) {
+	case *object.Array:
+		for i := range collection.Elements {
+			if last {
+				i = len(collection.Elements) - 1 - i
+			}
+			if in.evalInfixExpression("==", collection.Elements[i], args[1]) == TRUE {
+				return &object.Integer{Value: int64(i)}
+			}
+		}
+
+		return &object.Integer{Value: -1}
+	case *object.String:
+		substr, ok := args[1].(*object.String)
+		if !ok {
+			return newError("second argument to `%s` must be STRING, got %s", name, args[1].Type())
+		}
+
+		var byteIndex int
+		if last {
+			byteIndex = strings.LastIndex(collection.Value, substr.Value)
+		} else {
+			byteIndex = strings.Index(collection.Value, substr.Value)
+		}
+		if byteIndex == -1 || !runes {
+			return &object.Integer{Value: int64(byteIndex)}
+		}
+
+		return &object.Integer{Value: int64(utf8.RuneCountInString(collection.Value[:byteIndex]))}
+	default:
+		return newError("first argument to `%s` must be ARRAY or STRING, got %s", name, args[0].Type())
+	}
+}
+
+func flatten(elements []object.Object, depth int64) []object.Object {
+	flattened := []object.Object{}
+
+	for _, el := range elements {
+		nested, ok := el.(*object.Array)
+		if !ok || depth == 0 {
+			flattened = append(flattened, el)
+			continue
+		}
+
+		flattened = append(flattened, flatten(nested.Elements, depth-1)...)
+	}
+
+	return flattened
+}
+
+// findIndex returns the index and value of the first element for which the predicate is truthy, or -1 if there's none
+func (in *Interpreter) findIndex(name string, args []object.Object) (int, object.Object) {
+	if len(args) != 2 {
+		return -1, newError("wrong number of arguments to `%s`. got=%d, want=2", name, len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return -1, newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return -1, newError("second argument to `%s` must be FUNCTION or BUILTIN, got %s", name, args[1].Type())
+	}
+
+	for i, el := range arr.Elements {
+		result := in.applyFunction(args[1], []object.Object{el})
+		if isError(result) {
+			return -1, result
+		}
+		if isTruthy(result) {
+			return i, el
+		}
+	}
+
+	return -1, nil
+}
+
+// extreme returns the biggest of its two arguments when sign is 1, or the smallest when sign is -1
+func extreme(name string, args []object.Object, sign int) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `%s`. got=%d, want=2", name, len(args))
+	}
+
+	order, err := compareObjects(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	if order*sign >= 0 {
+		return args[0]
+	}
+
+	return args[1]
+}
+
+// extremeOf is the array counterpart of extreme, it returns NULL for an empty array
+func extremeOf(name string, args []object.Object, sign int) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `%s`. got=%d, want=1", name, len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	if len(arr.Elements) == 0 {
+		return NULL
+	}
+
+	result := arr.Elements[0]
+	for _, el := range arr.Elements[1:] {
+		order, err := compareObjects(el, result)
+		if err != nil {
+			return err
+		}
+
+		if order*sign > 0 {
+			result = el
+		}
+	}
+
+	// a single element is never compared so make sure it's something comparable
+	if _, err := compareObjects(result, result); err != nil {
+		return err
+	}
+
+	return result
+}
+
+// compareObjects orders integers numerically and strings lexicographically, returning a negative number when left is
+// smaller than right, zero if they're equal and a positive number otherwise
+func compareObjects(left, right object.Object) (int, *object.Error) {
+	comparable, ok := left.(object.Comparable)
+	if !ok {
+		return 0, newError("unable to compare %s", left.Type())
+	}
+
+	result, err := comparable.Compare(right)
+	if err != nil {
+		return 0, newError("type mismatch: %s and %s are not comparable", left.Type(), right.Type())
+	}
+
+	return result, nil
+}
+
+// matchAll backs `all` and `any`, it stops at the first element whose predicate result is `stopOn`, which is when
+// the outcome is already known, returning stopOn if there was one and !stopOn otherwise
+func (in *Interpreter) matchAll(name string, args []object.Object, stopOn bool) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `%s`. got=%d, want=2", name, len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError("second argument to `%s` must be FUNCTION or BUILTIN, got %s", name, args[1].Type())
+	}
+
+	for _, el := range arr.Elements {
+		result := in.applyFunction(args[1], []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) == stopOn {
+			return nativeBooleanToObject(stopOn)
+		}
+	}
+
+	return nativeBooleanToObject(!stopOn)
+}
+
+// multiplyOverflows reports whether a * b doesn't fit in an int64
+func multiplyOverflows(a, b int64) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return true
+	}
+
+	return a*b/b != a
+}
+
+// fold reduces an array of integers into a single integer, starting from initial
+func fold(name string, args []object.Object, initial int64, f func(acc, n int64) int64) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `%s`. got=%d, want=1", name, len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	result := initial
+	for i, el := range arr.Elements {
+		n, ok := el.(*object.Integer)
+		if !ok {
+			return newError("element %d of `%s` must be INTEGER, got %s", i, name, el.Type())
+		}
+		result = f(result, n.Value)
+	}
+
+	return &object.Integer{Value: result}
+}
+
+// hashKeyArgs validates the (hash, key) arguments shared by the hash builtins
+func hashKeyArgs(name string, args []object.Object) (*object.Hash, object.HashKey, *object.Error) {
+	if len(args) != 2 {
+		return nil, object.HashKey{}, newError("wrong number of arguments to `%s`. got=%d, want=2", name, len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return nil, object.HashKey{}, newError("first argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return nil, object.HashKey{}, newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	return hash, key.HashKey(), nil
+}
+
+func lazyArgs(name string, args []object.Object) (func() (object.Object, bool), object.Object, *object.Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments to `%s`. got=%d, want=2", name, len(args))
+	}
+
+	next, ok := iterate(args[0])
+	if !ok {
+		return nil, nil, newError("cannot iterate over %s", args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return nil, nil, newError("second argument to `%s` must be FUNCTION or BUILTIN, got %s", name, args[1].Type())
+	}
+
+	return next, args[1], nil
+}
+
+func setElementArgs(name string, args []object.Object) (*object.Set, object.HashKey, *object.Error) {
+	if len(args) != 2 {
+		return nil, object.HashKey{}, newError("wrong number of arguments to `%s`. got=%d, want=2", name, len(args))
+	}
+
+	set, ok := args[0].(*object.Set)
+	if !ok {
+		return nil, object.HashKey{}, newError("first argument to `%s` must be SET, got %s", name, args[0].Type())
+	}
+
+	el, ok := args[1].(object.Hashable)
+	if !ok {
+		return nil, object.HashKey{}, newError("unusable as set element: %s", args[1].Type())
+	}
+
+	return set, el.HashKey(), nil
+}
+
+func setPairArgs(name string, args []object.Object) (*object.Set, *object.Set, *object.Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments to `%s`. got=%d, want=2", name, len(args))
+	}
+
+	a, ok := args[0].(*object.Set)
+	if !ok {
+		return nil, nil, newError("arguments to `%s` must be SET, got %s", name, args[0].Type())
+	}
+
+	b, ok := args[1].(*object.Set)
+	if !ok {
+		return nil, nil, newError("arguments to `%s` must be SET, got %s", name, args[1].Type())
+	}
+
+	return a, b, nil
+}
+
+func copySet(set *object.Set) *object.Set {
+	elements := make(map[object.HashKey]object.Object, len(set.Elements))
+	for key, el := range set.Elements {
+		elements[key] = el
+	}
+
+	return &object.Set{Elements: elements}
+}
+
+// appendElement returns a copy of elements with el added at the end, leaving elements itself untouched so the queue or
+// stack it came from doesn't change
+func appendElement(elements []object.Object, el object.Object) []object.Object {
+	appended := make([]object.Object, len(elements), len(elements)+1)
+	copy(appended, elements)
+	return append(appended, el)
+}
+
+// chainFunctions returns a builtin which calls the given functions in order, each one with the result of the previous,
+// the first function gets called with whatever arguments the builtin was called with
+func (in *Interpreter) chainFunctions(name string, fns []object.Object) object.Object {
+	if len(fns) < 2 {
+		return newError("wrong number of arguments to `%s`. got=%d, want at least 2", name, len(fns))
+	}
+
+	for _, fn := range fns {
+		if !isCallable(fn) {
+			return newError("arguments to `%s` must be FUNCTION or BUILTIN, got %s", name, fn.Type())
+		}
+	}
+
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			result := in.applyFunction(fns[0], args)
+
+			for _, fn := range fns[1:] {
+				if isError(result) {
+					return result
+				}
+				result = in.applyFunction(fn, []object.Object{result})
+			}
+
+			return result
+		},
+	}
 }
@@ -1,7 +1,11 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"strings"
+	"time"
 	"waiig/ast"
 	"waiig/object"
 )
@@ -12,90 +16,329 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+// Interpreter evaluates programs, it holds the state of a run, like the context that cancels it, so programs can be
+// evaluated concurrently as long as each has its own Interpreter
+type Interpreter struct {
+	ctx      context.Context
+	builtins map[string]*object.Builtin
+
+	// stepLimit is the number of nodes a single Eval can evaluate, 0 for no limit, steps is how many the running one has
+	stepLimit int
+	steps     int
+
+	sandbox bool
+
+	// rng backs `rand`, it's seeded from the current time and can be reseeded through `seed` for reproducible runs
+	rng *rand.Rand
+
+	// callHook, when set, is called with every function right before it's applied, e.g. to profile a program
+	callHook func(fn *object.Function)
+
+	// skipped is the last link of a chain like `h?.a.b` which was skipped because a `?.` in it found null, so the link
+	// after it is skipped as well
+	skipped ast.Expression
+
+	// modules caches every module imported by its absolute path so importing it again, from anywhere, doesn't evaluate
+	// it again
+	modules map[string]*object.Module
+	// importing is the chain of modules currently being evaluated, the last one is doing the importing. Relative paths
+	// are resolved against its directory, or the working directory when it's empty
+	importing []string
+}
+
+// Option configures how an Interpreter behaves, options are passed to New
+type Option func(*Interpreter)
+
+// WithStepLimit stops each evaluation with an error once it has evaluated more than n nodes, unlike a timeout that
+// happens at the same point every time. n <= 0 means there's no limit
+func WithStepLimit(n int) Option {
+	return func(in *Interpreter) {
+		in.stepLimit = n
+	}
+}
+
+// WithSandbox is for untrusted programs, the builtins which touch the filesystem or the process return an error rather
+// than reaching outside of the interpreter, and so do imports
+func WithSandbox() Option {
+	return func(in *Interpreter) {
+		in.sandbox = true
+	}
+}
+
+// WithCallHook has hook called with every function the interpreter applies, right before it runs, e.g. to profile a
+// program. A nil hook removes the one set before
+func WithCallHook(hook func(fn *object.Function)) Option {
+	return func(in *Interpreter) {
+		in.callHook = hook
+	}
+}
+
+// New returns an Interpreter with its own builtins, the ones calling back into the evaluator run in it
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{
+		ctx:     context.Background(),
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		modules: map[string]*object.Module{},
+	}
+	in.builtins = in.newBuiltins()
+
+	for _, opt := range opts {
+		opt(in)
+	}
+
+	return in
+}
+
+// Eval evaluates node in env
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	in.steps = 0
+
+	return in.evalNode(node, env)
+}
+
+// EvalContext is Eval stopping with an error once ctx is done, loop iterations and function calls check it so runaway
+// programs can be cancelled
+func (in *Interpreter) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	previous := in.ctx
+	in.ctx = ctx
+	defer func() { in.ctx = previous }()
+
+	return in.Eval(node, env)
+}
+
+// Eval evaluates node in env with a new Interpreter
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// EvalContext is Interpreter.EvalContext with a new Interpreter
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New().EvalContext(ctx, node, env)
+}
+
+// EvalWithStepLimit is Eval with a new Interpreter stopping with an error once it has evaluated more than limit nodes,
+// see WithStepLimit
+func EvalWithStepLimit(node ast.Node, env *object.Environment, limit int) object.Object {
+	return New(WithStepLimit(limit)).Eval(node, env)
+}
+
+// sandboxed are the builtins which touch the filesystem or the process, and `eval`, which runs code that wasn't part
+// of the program that was vetted. Every Interpreter shares them, so however a program got hold of one a sandboxed
+// interpreter recognizes it when it's applied
+var sandboxed = map[*object.Builtin]bool{
+	readFileBuiltin:  true,
+	writeFileBuiltin: true,
+	exitBuiltin:      true,
+	evalBuiltin:      true,
+}
+
+// EvalSandboxed is Eval with a new sandboxed Interpreter, see WithSandbox
+func EvalSandboxed(node ast.Node, env *object.Environment) object.Object {
+	return New(WithSandbox()).Eval(node, env)
+}
+
+// checkContext returns an error once the context the interpreter runs with is done, nil otherwise
+func (in *Interpreter) checkContext() object.Object {
+	if err := in.ctx.Err(); err != nil {
+		return newError("evaluation cancelled: %s", err)
+	}
+
+	return nil
+}
+
+// RuntimeError is how Run reports a program failing, Err is the error object the evaluation ended with
+type RuntimeError struct {
+	Err *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Err.Pos.Line == 0 {
+		return e.Err.Message
+	}
+	return e.Err.Pos.String() + ": " + e.Err.Message
+}
+
+// ExitError is how Run reports a program calling `exit`, Code is the status it exited with
+type ExitError struct {
+	Code int64
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Run is Eval for embedding the interpreter, a program failing comes back as a *RuntimeError rather than as an
+// *object.Error result, and one calling `exit` as an *ExitError
+func (in *Interpreter) Run(node ast.Node, env *object.Environment) (object.Object, error) {
+	evaluated := in.Eval(node, env)
+
+	switch evaluated := evaluated.(type) {
+	case *object.Error:
+		if !evaluated.Value {
+			return nil, &RuntimeError{Err: evaluated}
+		}
+	case *object.Exit:
+		return nil, &ExitError{Code: evaluated.Code}
+	}
+
+	return evaluated, nil
+}
+
+// Run is Interpreter.Run with a new Interpreter
+func Run(node ast.Node, env *object.Environment) (object.Object, error) {
+	return New().Run(node, env)
+}
+
+// evalNode evaluates node in env, errors are located at the innermost node they came out of
+func (in *Interpreter) evalNode(node ast.Node, env *object.Environment) object.Object {
+	var evaluated object.Object
+	if in.stepLimit > 0 && in.steps >= in.stepLimit {
+		evaluated = newError("step limit exceeded")
+	} else {
+		in.steps++
+		evaluated = in.eval(node, env)
+	}
+
+	if err, ok := evaluated.(*object.Error); ok && !err.Value && err.Pos.Line == 0 {
+		return newErrorAt(node, err)
+	}
+
+	return evaluated
+}
+
+func (in *Interpreter) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return in.evalProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return in.evalNode(node.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBooleanToObject(node.Value)
+	case *ast.Null:
+		return NULL
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := in.evalNode(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := in.evalNode(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := in.evalNode(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return in.evalInfixExpression(node.Operator, left, right)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return in.evalBlockStatement(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return in.evalIfExpression(node, env)
+	case *ast.WhileExpression:
+		return in.evalWhileExpression(node, env)
+	case *ast.DoWhileExpression:
+		return in.evalDoWhileExpression(node, env)
+	case *ast.LoopExpression:
+		return in.evalLoopExpression(node, env)
+	case *ast.ForInExpression:
+		return in.evalForInExpression(node, env)
+	case *ast.BreakStatement:
+		if node.Value == nil {
+			return &object.Break{Label: node.Label}
+		}
+
+		// the parser can't tell `break outr` from breaking with a variable, so a lone name that's neither is taken as a
+		// mistyped label, like it is for continue
+		if ident, ok := node.Value.(*ast.Identifier); ok && node.Label == "" {
+			if _, bound := env.Get(ident.Value); !bound && in.builtins[ident.Value] == nil {
+				return newError("unknown label %s", ident.Value)
+			}
+		}
+
+		value := in.evalNode(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		return &object.Break{Label: node.Label, Value: value}
+	case *ast.ImportStatement:
+		return in.evalImportStatement(node, env)
+	case *ast.ContinueStatement:
+		return &object.Continue{Label: node.Label}
 	case *ast.ReturnStatement:
-		value := Eval(node.ReturnValue, env)
+		value := in.evalNode(node.ReturnValue, env)
 		if isError(value) {
 			return value
 		}
 		return &object.ReturnValue{Value: value}
 	case *ast.LetStatement:
-		value := Eval(node.Value, env)
+		value := in.evalNode(node.Value, env)
 		if isError(value) {
 			return value
 		}
 
+		// a return or a break in the value, like `let x = { return 1 }`, leaves the let unfinished and is passed on
+		switch value.(type) {
+		case *object.ReturnValue, *object.Break, *object.Continue:
+			return value
+		}
+
+		if function, ok := value.(*object.Function); ok && function.Name == "" {
+			function.Name = node.Name.Value
+		}
+
 		env.Set(node.Name.Value, value)
+		if node.Exported {
+			env.Export(node.Name.Value)
+		}
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return in.evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
 		return &object.Function{Parameters: params, Body: body, Env: env}
-	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-
-		return applyFunction(function, args)
+	case *ast.CallExpression, *ast.IndexExpression, *ast.DotExpression, *ast.MethodCallExpression:
+		return in.evalChainLink(node.(ast.Expression), env)
 	case *ast.ArrayLiteral:
-		return evalArrayLiteral(node, env)
-	case *ast.IndexExpression:
-		return evalIndexExpression(node, env)
+		return in.evalArrayLiteral(node, env)
 	case *ast.RangeExpression:
-		return evalRangeExpression(node, env)
+		return in.evalRangeExpression(node, env)
 	case *ast.HashLiteral:
-		return evalHashExpression(node, env)
+		return in.evalHashExpression(node, env)
+	case *ast.AssignExpression:
+		return in.evalAssignExpression(node, env)
+	case *ast.PipeExpression:
+		return in.evalPipeExpression(node, env)
+	case *ast.ComparisonChain:
+		return in.evalComparisonChain(node, env)
+	case *ast.PostfixExpression:
+		return evalPostfixExpression(node, env)
+	case *ast.CoalesceExpression:
+		left := in.evalNode(node.Left, env)
+		// a Go nil, e.g. from a block ending in a let, is no value at all, like null
+		if left != nil && left != NULL {
+			return left
+		}
+
+		return in.evalNode(node.Right, env)
 	}
 	return nil
 }
 
-func evalHashExpression(node *ast.HashLiteral, env *object.Environment) object.Object {
+func (in *Interpreter) evalHashExpression(node *ast.HashLiteral, env *object.Environment) object.Object {
 	hash := &object.Hash{}
 
 	pairs := make(map[object.HashKey]object.HashPair)
 
-	for key, value := range node.Pairs {
-		keyObj := Eval(key, env)
+	for _, pair := range node.Pairs {
+		keyObj := in.evalNode(pair.Key, env)
 		if isError(keyObj) {
 			return keyObj
 		}
@@ -109,7 +352,7 @@ func evalHashExpression(node *ast.HashLiteral, env *object.Environment) object.O
 
 		hashKey = hashable.HashKey()
 
-		valueObj := Eval(value, env)
+		valueObj := in.evalNode(pair.Value, env)
 		if isError(valueObj) {
 			return valueObj
 		}
@@ -122,13 +365,68 @@ func evalHashExpression(node *ast.HashLiteral, env *object.Environment) object.O
 	return hash
 }
 
-func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) object.Object {
-	left := Eval(node.Left, env)
+// evalChainLink evaluates a call, an index, or a `.` or `?.` access, links of a chain like `h?.a.b[0]()`. When a `?.`
+// finds null the rest of the chain is skipped and the whole chain evaluates to null, so `h?.a.b` is null when h is
+// rather than an error. in.skipped is how a link tells the one after it that it was skipped
+func (in *Interpreter) evalChainLink(node ast.Expression, env *object.Environment) object.Object {
+	var leftNode ast.Expression
+	optional := false
+
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		leftNode = node.Function
+	case *ast.IndexExpression:
+		leftNode = node.Left
+	case *ast.DotExpression:
+		leftNode, optional = node.Left, node.Optional
+	case *ast.MethodCallExpression:
+		leftNode, optional = node.Receiver, node.Optional
+	}
+
+	left := in.evalNode(leftNode, env)
 	if isError(left) {
 		return left
 	}
 
-	indexObj := Eval(node.Index, env)
+	if in.skipped == leftNode || (optional && left == NULL) {
+		in.skipped = node
+		return NULL
+	}
+
+	var evaluated object.Object
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		evaluated = in.evalCallExpression(node, left, env)
+	case *ast.IndexExpression:
+		evaluated = in.evalIndexExpression(node, left, env)
+	case *ast.DotExpression:
+		evaluated = in.evalDotExpression(node, left)
+	case *ast.MethodCallExpression:
+		evaluated = in.evalMethodCallExpression(node, left, env)
+	}
+
+	// whatever was skipped while evaluating the rest, e.g. in the arguments, isn't part of this chain
+	in.skipped = nil
+
+	return evaluated
+}
+
+func (in *Interpreter) evalCallExpression(node *ast.CallExpression, function object.Object, env *object.Environment) object.Object {
+	args := in.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	// called directly, `eval` runs its source in the caller's environment rather than in one of its own
+	if function == evalBuiltin && !in.sandbox {
+		return in.evalSource(args, env)
+	}
+
+	return in.applyFunction(function, args)
+}
+
+func (in *Interpreter) evalIndexExpression(node *ast.IndexExpression, left object.Object, env *object.Environment) object.Object {
+	indexObj := in.evalNode(node.Index, env)
 	if isError(indexObj) {
 		return indexObj
 	}
@@ -152,19 +450,22 @@ func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) obj
 			return newError("unknown index type: %s", indexObj.Type())
 		}
 	case *object.String:
+		// strings are indexed by unicode code point rather than by byte, so multibyte characters aren't split apart
+		runes := []rune(obj.Value)
+
 		switch index := indexObj.(type) {
 		case *object.Integer:
-			if int(index.Value) >= len(obj.Value) || index.Value < 0 {
-				return newError("index out of bounds, index=%d len=%d", index.Value, len(obj.Value))
+			if int(index.Value) >= len(runes) || index.Value < 0 {
+				return newError("index out of bounds, index=%d len=%d", index.Value, len(runes))
 			}
-			char := string(obj.Value[index.Value])
+			char := string(runes[index.Value])
 			return &object.String{Value: char}
 		case *object.Range:
-			if int(index.From) > len(obj.Value) || int(index.ToExclusive) > len(obj.Value) ||
+			if int(index.From) > len(runes) || int(index.ToExclusive) > len(runes) ||
 				index.From < 0 || index.ToExclusive < 0 {
-				return newError("range index out of bounds, index=%d:%d len=%d", index.From, index.ToExclusive, len(obj.Value))
+				return newError("range index out of bounds, index=%d:%d len=%d", index.From, index.ToExclusive, len(runes))
 			}
-			str := obj.Value[index.From:index.ToExclusive]
+			str := string(runes[index.From:index.ToExclusive])
 			return &object.String{Value: str}
 		default:
 			return newError("unknown index type: %s", indexObj.Type())
@@ -186,13 +487,254 @@ func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) obj
 	}
 }
 
-func evalRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
-	left := Eval(node.Left, env)
+func (in *Interpreter) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	value := in.evalNode(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		if !env.Assign(target.Value, value) {
+			return newError("identifier not found: " + target.Value)
+		}
+		return value
+	case *ast.IndexExpression:
+		// only the last index is assigned to, everything to the left of it, e.g. `grid[1]` in `grid[1][2] = 9`, is
+		// evaluated as a regular expression which yields the container that gets mutated
+		return in.evalIndexAssignment(target, value, env)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+func (in *Interpreter) evalIndexAssignment(node *ast.IndexExpression, value object.Object, env *object.Environment) object.Object {
+	left := in.evalNode(node.Left, env)
 	if isError(left) {
 		return left
 	}
 
-	right := Eval(node.Right, env)
+	indexObj := in.evalNode(node.Index, env)
+	if isError(indexObj) {
+		return indexObj
+	}
+
+	switch obj := left.(type) {
+	case *object.Array:
+		index, ok := indexObj.(*object.Integer)
+		if !ok {
+			return newError("unknown index type: %s", indexObj.Type())
+		}
+		if int(index.Value) >= len(obj.Elements) || index.Value < 0 {
+			return newError("index out of bounds, index=%d len=%d", index.Value, len(obj.Elements))
+		}
+
+		obj.Elements[index.Value] = value
+	case *object.Hash:
+		hashKey, ok := indexObj.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", indexObj.Type())
+		}
+
+		obj.Pairs[hashKey.HashKey()] = object.HashPair{Key: indexObj, Value: value}
+	default:
+		return newError("unknown operator: index assignment of %s", left.Type())
+	}
+
+	return value
+}
+
+func (in *Interpreter) evalPipeExpression(node *ast.PipeExpression, env *object.Environment) object.Object {
+	value := in.evalNode(node.Left, env)
+	if isError(value) {
+		return value
+	}
+
+	args := []object.Object{value}
+
+	fnNode := node.Right
+	if call, ok := node.Right.(*ast.CallExpression); ok {
+		fnNode = call.Function
+
+		callArgs := in.evalExpressions(call.Arguments, env)
+		if len(callArgs) == 1 && isError(callArgs[0]) {
+			return callArgs[0]
+		}
+
+		args = append(args, callArgs...)
+	}
+
+	function := in.evalNode(fnNode, env)
+	if isError(function) {
+		return function
+	}
+
+	return in.applyFunction(function, args)
+}
+
+func evalPostfixExpression(node *ast.PostfixExpression, env *object.Environment) object.Object {
+	value, ok := env.Get(node.Target.Value)
+	if !ok {
+		return newError("identifier not found: " + node.Target.Value)
+	}
+
+	integer, ok := value.(*object.Integer)
+	if !ok {
+		return newError("unknown operator: %s%s", value.Type(), node.Operator)
+	}
+
+	delta := int64(1)
+	if node.Operator == "--" {
+		delta = -1
+	}
+
+	env.Assign(node.Target.Value, &object.Integer{Value: integer.Value + delta})
+
+	return integer
+}
+
+func (in *Interpreter) evalComparisonChain(node *ast.ComparisonChain, env *object.Environment) object.Object {
+	left := in.evalNode(node.Operands[0], env)
+	if isError(left) {
+		return left
+	}
+
+	for i, operator := range node.Operators {
+		right := in.evalNode(node.Operands[i+1], env)
+		if isError(right) {
+			return right
+		}
+
+		result := in.evalInfixExpression(operator, left, right)
+		// stop as soon as one comparison fails, like && would, so the remaining operands are never evaluated
+		if result != TRUE {
+			return result
+		}
+
+		left = right
+	}
+
+	return TRUE
+}
+
+func (in *Interpreter) evalDotExpression(node *ast.DotExpression, left object.Object) object.Object {
+	if module, ok := left.(*object.Module); ok {
+		return evalModuleMember(module, node.Key.Value)
+	}
+
+	// errors made by `error` expose their message, `err.Message`
+	if err, ok := left.(*object.Error); ok && node.Key.Value == "Message" {
+		return &object.String{Value: err.Message}
+	}
+
+	hash, ok := left.(*object.Hash)
+	if !ok {
+		return newError("unknown operator: dot access of %s", left.Type())
+	}
+
+	key := &object.String{Value: node.Key.Value}
+	pair, ok := hash.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+func (in *Interpreter) evalMethodCallExpression(node *ast.MethodCallExpression, receiver object.Object, env *object.Environment) object.Object {
+	if function, ok := receiver.(*object.Function); ok {
+		return in.evalFunctionMethod(function, node, env)
+	}
+
+	// builtins have `b.name()` and `b.inspect()` like functions do, other methods fall back to `method(b, args)`
+	if builtin, ok := receiver.(*object.Builtin); ok && len(node.Arguments) == 0 {
+		switch node.Method.Value {
+		case "name":
+			if builtin.Name == "" {
+				return NULL
+			}
+			return &object.String{Value: builtin.Name}
+		case "inspect":
+			return &object.String{Value: builtin.Inspect()}
+		}
+	}
+
+	// `math.add(1, 2)` calls the module's own add rather than add(math, 1, 2)
+	if module, ok := receiver.(*object.Module); ok {
+		method := evalModuleMember(module, node.Method.Value)
+		if isError(method) {
+			return method
+		}
+
+		args := in.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+
+		return in.applyFunction(method, args)
+	}
+
+	method := in.evalIdentifier(node.Method, env)
+	if isError(method) {
+		return method
+	}
+
+	args := in.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	return in.applyFunction(method, append([]object.Object{receiver}, args...))
+}
+
+// evalFunctionMethod handles the methods functions have of their own, `f.bind(args)`, `f.arity()`, `f.name()`,
+// `f.params()` and `f.inspect()`, unlike other values functions don't fall back to `method(f, args)`
+func (in *Interpreter) evalFunctionMethod(function *object.Function, node *ast.MethodCallExpression, env *object.Environment) object.Object {
+	args := in.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	switch node.Method.Value {
+	case "bind":
+		return &object.Builtin{Fn: func(rest ...object.Object) object.Object {
+			bound := make([]object.Object, 0, len(args)+len(rest))
+			bound = append(bound, args...)
+			bound = append(bound, rest...)
+			return in.applyFunction(function, bound)
+		}}
+	case "arity":
+		return &object.Integer{Value: int64(len(function.Parameters))}
+	case "name":
+		if function.Name == "" {
+			return NULL
+		}
+		return &object.String{Value: function.Name}
+	case "params":
+		params := make([]object.Object, 0, len(function.Parameters))
+		for _, param := range function.Parameters {
+			params = append(params, &object.String{Value: param.Value})
+		}
+		return &object.Array{Elements: params}
+	case "inspect":
+		// the source the function was written as, reconstructed from its AST, rather than Inspect's `Fn(...)` form
+		params := make([]string, 0, len(function.Parameters))
+		for _, param := range function.Parameters {
+			params = append(params, param.Declaration())
+		}
+		return &object.String{Value: "fn(" + strings.Join(params, ", ") + ") " + function.Body.String()}
+	default:
+		return newError("unknown method: %s.%s", function.Type(), node.Method.Value)
+	}
+}
+
+func (in *Interpreter) evalRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
+	left := in.evalNode(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	right := in.evalNode(node.Right, env)
 	if isError(right) {
 		return right
 	}
@@ -217,10 +759,10 @@ func evalRangeExpression(node *ast.RangeExpression, env *object.Environment) obj
 	}
 }
 
-func evalArrayLiteral(node *ast.ArrayLiteral, env *object.Environment) object.Object {
+func (in *Interpreter) evalArrayLiteral(node *ast.ArrayLiteral, env *object.Environment) object.Object {
 	arr := &object.Array{}
 
-	elements := evalExpressions(node.Elements, env)
+	elements := in.evalExpressions(node.Elements, env)
 	if len(elements) == 1 && isError(elements[0]) {
 		return elements[0]
 	}
@@ -230,13 +772,41 @@ func evalArrayLiteral(node *ast.ArrayLiteral, env *object.Environment) object.Ob
 	return arr
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (in *Interpreter) applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch function := fn.(type) {
 	case *object.Function:
+		if err := in.checkContext(); err != nil {
+			return err
+		}
+
+		if in.callHook != nil {
+			in.callHook(function)
+		}
+
+		// extra arguments are ignored but missing ones would leave parameters unbound
+		if len(args) < len(function.Parameters) {
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), len(function.Parameters))
+		}
+
 		extendedEnv := extendFunctionEnv(function, args)
-		evaluated := Eval(function.Body, extendedEnv)
+		evaluated := in.evalNode(function.Body, extendedEnv)
+
+		// loops don't reach across function boundaries, a break in a function called from a loop doesn't stop it
+		switch evaluated.(type) {
+		case *object.Break, *object.Continue:
+			return newError("%s outside of a loop", evaluated.Inspect())
+		}
+
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
+		if in.sandbox && sandboxed[function] {
+			return newError("operation not permitted in sandbox")
+		}
+		// `eval` is shared by every interpreter, it runs in the one applying it
+		if function == evalBuiltin {
+			return in.evalSource(args, object.NewEnvironment())
+		}
+
 		return function.Fn(args...)
 	default:
 		return newError("not a function: %s", fn.Type())
@@ -264,11 +834,11 @@ func extendFunctionEnv(
 	return env
 }
 
-func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+func (in *Interpreter) evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var objects []object.Object
 
 	for _, exp := range expressions {
-		val := Eval(exp, env)
+		val := in.evalNode(exp, env)
 		if isError(val) {
 			return []object.Object{val}
 		}
@@ -279,33 +849,211 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	return objects
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (in *Interpreter) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := in.builtins[node.Value]; ok {
 		return builtin
 	}
 
 	return newError("identifier not found: " + node.Value)
 }
 
-func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(node.Condition, env)
+func (in *Interpreter) evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
+	condition := in.evalNode(node.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(node.Consequence, env)
+		return in.evalNode(node.Consequence, env)
 	} else if node.Alternative != nil {
-		return Eval(node.Alternative, env)
+		return in.evalNode(node.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+func (in *Interpreter) evalWhileExpression(node *ast.WhileExpression, env *object.Environment) object.Object {
+	var result object.Object = NULL
+
+	for {
+		condition := in.evalNode(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return result
+		}
+
+		evaluated, done := in.evalLoopBody(node.Body, node.Label, env)
+		if done {
+			return evaluated
+		}
+		if evaluated != nil {
+			result = evaluated
+		}
+	}
+}
+
+func (in *Interpreter) evalDoWhileExpression(node *ast.DoWhileExpression, env *object.Environment) object.Object {
+	var result object.Object = NULL
+
+	for {
+		evaluated, done := in.evalLoopBody(node.Body, node.Label, env)
+		if done {
+			return evaluated
+		}
+		if evaluated != nil {
+			result = evaluated
+		}
+
+		condition := in.evalNode(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return result
+		}
+	}
+}
+
+func (in *Interpreter) evalLoopExpression(node *ast.LoopExpression, env *object.Environment) object.Object {
+	for {
+		evaluated, done := in.evalLoopBody(node.Body, node.Label, env)
+		if done {
+			return evaluated
+		}
+	}
+}
+
+// evalForInExpression runs the body once per element of an array, character of a string, integer of a range or value
+// of an iterator, which are only produced as the loop gets to them. Each iteration gets its own environment holding the
+// loop variables, so they're gone after the loop and closures made in the body keep the values of their iteration,
+// lets in the body are also local to the iteration
+func (in *Interpreter) evalForInExpression(node *ast.ForInExpression, env *object.Environment) object.Object {
+	iterable := in.evalNode(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	next, ok := iterate(iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	var result object.Object = NULL
+
+	for i := int64(0); ; i++ {
+		value, ok := next()
+		if !ok {
+			break
+		}
+		if isError(value) {
+			return value
+		}
+
+		iterationEnv := object.NewEnclosedEnvironment(env)
+		if node.IndexVar != nil {
+			iterationEnv.Set(node.IndexVar.Value, &object.Integer{Value: i})
+		}
+		iterationEnv.Set(node.ValueVar.Value, value)
+
+		evaluated, done := in.evalLoopBody(node.Body, node.Label, iterationEnv)
+		if done {
+			return evaluated
+		}
+		if evaluated != nil {
+			result = evaluated
+		}
+	}
+
+	return result
+}
+
+// iterate returns a function producing the values of iterable one by one, like an Iterator's Next, the elements of an
+// array, the characters of a string or the integers of a range. It reports false for anything else
+func iterate(iterable object.Object) (func() (object.Object, bool), bool) {
+	switch iterable := iterable.(type) {
+	case *object.Iterator:
+		return iterable.Next, true
+	case *object.Array:
+		i := 0
+		return func() (object.Object, bool) {
+			if i >= len(iterable.Elements) {
+				return nil, false
+			}
+			i++
+			return iterable.Elements[i-1], true
+		}, true
+	case *object.String:
+		runes := []rune(iterable.Value)
+		i := 0
+		return func() (object.Object, bool) {
+			if i >= len(runes) {
+				return nil, false
+			}
+			i++
+			return &object.String{Value: string(runes[i-1])}, true
+		}, true
+	case *object.Range:
+		i := iterable.From
+		return func() (object.Object, bool) {
+			if i >= iterable.ToExclusive {
+				return nil, false
+			}
+			i++
+			return &object.Integer{Value: i - 1}, true
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+// evalLoopBody runs a single iteration of a loop, returning the body's value, or nil on continue. done means the loop
+// has to stop, either because of a break, which makes the loop evaluate to the break's value or null, or because a
+// return, an error or a break/continue aimed at an outer loop has to keep bubbling up, in which case that's returned
+func (in *Interpreter) evalLoopBody(body *ast.BlockStatement, label string, env *object.Environment) (object.Object, bool) {
+	if err := in.checkContext(); err != nil {
+		return err, true
+	}
+
+	evaluated := in.evalNode(body, env)
+
+	switch evaluated := evaluated.(type) {
+	case *object.Break:
+		if evaluated.Label != "" && evaluated.Label != label {
+			return evaluated, true
+		}
+		if evaluated.Value == nil {
+			return NULL, true
+		}
+		return evaluated.Value, true
+	case *object.Continue:
+		if evaluated.Label != "" && evaluated.Label != label {
+			return evaluated, true
+		}
+		return nil, false
+	case *object.ReturnValue, *object.Error, *object.Exit:
+		return evaluated, true
+	default:
+		return evaluated, false
+	}
+}
+
+func isCollection(obj object.Object) bool {
+	switch obj.Type() {
+	case object.ARRAY_OBJ, object.HASH_OBJ, object.SET_OBJ, object.QUEUE_OBJ, object.STACK_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case TRUE:
@@ -319,15 +1067,34 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func evalInfixExpression(
+func (in *Interpreter) evalInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
 	switch {
+	// `f >> g` calls f and then g with f's result, `f << g` the other way around
+	case operator == ">>" && isCallable(left) && isCallable(right):
+		return in.chainFunctions(">>", []object.Object{left, right})
+	case operator == "<<" && isCallable(left) && isCallable(right):
+		return in.chainFunctions("<<", []object.Object{right, left})
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case operator == "*" && left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalStringRepeat(left.(*object.String), right.(*object.Integer))
+	case operator == "*" && left.Type() == object.INTEGER_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringRepeat(right.(*object.String), left.(*object.Integer))
+	// `+` with a string on only one side converts the other side to a string with Inspect, so `"n: " + 1` is "n: 1",
+	// that's the one implicit conversion, other operators still report a type mismatch, e.g. `"n: " - 1`
+	case operator == "+" && left.Type() == object.STRING_OBJ:
+		return &object.String{Value: left.(*object.String).Value + right.Inspect()}
+	case operator == "+" && right.Type() == object.STRING_OBJ:
+		return &object.String{Value: left.Inspect() + right.(*object.String).Value}
+	// arrays, hashes, sets, queues and stacks compare by their contents, recursively, rather than by identity, so
+	// `[1, [2]] == [1, [2]]`
+	case (operator == "==" || operator == "!=") && left.Type() == right.Type() && isCollection(left):
+		return nativeBooleanToObject(object.Equal(left, right) == (operator == "=="))
 	case operator == "==":
 		// using pointer comparison here since boolean object are shared
 		return nativeBooleanToObject(left == right)
@@ -340,6 +1107,26 @@ func evalInfixExpression(
 	}
 }
 
+// maxRepeatLength caps the length of what repetition builds, far beyond what a script reasonably needs but low enough
+// that a runaway count is an error rather than a failed allocation taking the whole process down
+const maxRepeatLength = 1 << 28
+
+// repeatTooLong reports whether repeating something of the given length count times goes past maxRepeatLength
+func repeatTooLong(length int, count int64) bool {
+	return length > 0 && count > maxRepeatLength/int64(length)
+}
+
+func evalStringRepeat(str *object.String, count *object.Integer) object.Object {
+	if count.Value < 0 {
+		return newError("negative repeat count: %s * %d", str.Type(), count.Value)
+	}
+	if repeatTooLong(len(str.Value), count.Value) {
+		return newError("repeat count too large: %s * %d", str.Type(), count.Value)
+	}
+
+	return &object.String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
@@ -421,17 +1208,21 @@ func evalBangOperatorExpression(operand object.Object) object.Object {
 	}
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (in *Interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, stmt := range program.Statements {
-		result = Eval(stmt, env)
+		result = in.evalNode(stmt, env)
+
+		if isError(result) {
+			return result
+		}
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
-		case *object.Error:
-			return result
+		case *object.Break, *object.Continue:
+			return newError("%s outside of a loop", result.Inspect())
 		}
 
 		if returnValue, ok := result.(*object.ReturnValue); ok {
@@ -442,15 +1233,15 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (in *Interpreter) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, stmt := range block.Statements {
-		result = Eval(stmt, env)
+		result = in.evalNode(stmt, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if isError(result) || rt == object.RETURN_VALUE_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -470,9 +1261,32 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// newErrorAt locates err at node, when node knows its position
+func newErrorAt(node ast.Node, err *object.Error) *object.Error {
+	if positioned, ok := node.(ast.Positioned); ok {
+		err.Pos = positioned.Pos()
+	}
+	return err
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+// isError reports whether obj has to stop evaluation and bubble all the way up, which an exit does just like an error
 func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+	switch obj := obj.(type) {
+	case *object.Error:
+		// errors made by `error` are values, only the others stop evaluation
+		return !obj.Value
+	case *object.Exit:
+		return true
+	default:
+		return false
 	}
-	return false
 }
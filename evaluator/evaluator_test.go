@@ -1,8 +1,14 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 	"waiig/lexer"
 	"waiig/object"
 	"waiig/parser"
@@ -64,6 +70,115 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringConcatenationConvertsOtherOperand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"val: " + 42`, "val: 42"},
+		{`42 + " is the answer"`, "42 is the answer"},
+		{`"flag: " + true`, "flag: true"},
+		{`"n: " + null`, "n: null"},
+		{`"xs: " + [1, 2]`, "xs: [1, 2]"},
+		{`"total: " + 1 + 2`, "total: 12"},
+		{`"total: " + (1 + 2)`, "total: 3"},
+		// an array holding itself prints a placeholder where it comes around again
+		{`let a = [1]; a[0] = a; "" + a`, "[[...]]"},
+		{`let h = {}; h["me"] = h; "" + h`, "{me: {...}}"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testBooleanObject(t, testEval(`"val: " + 42 == "val: 42"`), true)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`"val: " - 42`, "type mismatch: STRING - INTEGER"},
+		{`true - "a"`, "type mismatch: BOOLEAN - STRING"},
+		{`1 + true`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayAndHashEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2, 3] == [1, 2, 3]", true},
+		{"[1, 2] == [1, 3]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[] == []", true},
+		{"[[1], [2]] == [[1], [2]]", true},
+		{"[[1], [2]] == [[1], [3]]", false},
+		{`[1, "a", true, null] == [1, "a", true, null]`, true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] != [2, 1]", true},
+		{`{"a": 1} == {"a": 1}`, true},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		// arrays and hashes holding themselves don't recurse forever
+		{"let a = [1]; a[0] = a; a == a", true},
+		{"let a = [1, 2]; a[0] = a; let b = [1, 2]; b[0] = b; a == b", true},
+		{"let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; a != b", true},
+		{`let h = {"a": 1}; h["a"] = h; h == h`, true},
+		{`{"a": [1, {"b": 2}]} == {"a": [1, {"b": 2}]}`, true},
+		{`{"a": 1} != {"a": 1}`, false},
+		{`{"a": 1} != {"b": 1}`, true},
+		{`[1] == {"a": 1}`, false},
+		{`[1] != {"a": 1}`, true},
+		{"let f = fn() { 1 }; [f] == [f]", true},
+		{"[fn() { 1 }] == [fn() { 1 }]", false},
+		{"let xs = [1, 2]; let ys = xs; xs == ys", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStringRepetition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`3 * "ab"`, "ababab"},
+		{`"x" * 0`, ""},
+		{`"ab" * 3 == "ababab"`, true},
+		{`"-" * 2 + ">"`, "-->"},
+		{`"é" * 2`, "éé"},
+		{`"x" * -1`, "negative repeat count: STRING * -1"},
+		{`-2 * "x"`, "negative repeat count: STRING * -2"},
+		{`"ha" * 9223372036854775807`, "repeat count too large: STRING * 9223372036854775807"},
+		{`"ha" * 1000000000`, "repeat count too large: STRING * 1000000000"},
+		{`"" * 9223372036854775807`, ""},
+		{`"x" / 2`, "type mismatch: STRING / INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if _, ok := evaluated.(*object.Error); ok {
+				testErrorObject(t, evaluated, expected)
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -142,6 +257,13 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestNullLiteral(t *testing.T) {
+	testNullObject(t, testEval("null"))
+	testNullObject(t, testEval("let a = null; a"))
+	testBooleanObject(t, testEval("null == null"), true)
+	testBooleanObject(t, testEval("!null"), true)
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -169,6 +291,41 @@ if (10 > 1) {
 	}
 }
 
+func TestBlockExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let result = { let x = 2; x * 3 }; result", 6},
+		{"{ let x = 1; x + 2 }", 3},
+		{"{ 1; 2; 3 } * 2", 6},
+		{`{"a": 1}["a"]`, 1},
+		// blocks don't get an environment of their own, like the bodies of ifs and loops
+		{"{ let inner = 5 }; inner", 5},
+		// a return in a block returns from the function around it, and from the program at the top level
+		{"let f = fn() { let x = { return 10; 1 }; 20 }; f()", 10},
+		{"let x = { return 7 }; 8", 7},
+		{"let n = 0; while (true) { let x = { break }; n = 1 }; n", 0},
+		{"{ break }", "break outside of a loop"},
+		{"let f = fn() { let x = { break }; 1 }; f()", "break outside of a loop"},
+		{"{ continue }", "continue outside of a loop"},
+		// a label at the start is a labeled loop, not a hash key
+		{"let r = { outer: loop { break outer 1 } }; r", 1},
+		{"{ outer: while (true) { loop { break outer } }; 5 }", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -278,6 +435,10 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5 * 5; a;", 25},
 		{"let a = 5; let b = a; b;", 5},
 		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		// annotations are only for the type checker, they're not enforced at runtime
+		{"let a: int = 5; a;", 5},
+		{"let a: string = 5; a;", 5},
+		{"let add = fn(x: int, y: int) { x + y }; add(2, 3);", 5},
 	}
 
 	for _, tt := range tests {
@@ -285,268 +446,2855 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
-func TestFunctionObject(t *testing.T) {
-	input := "fn(x) { x + 2; };"
-
-	evaluated := testEval(input)
-	fn, ok := evaluated.(*object.Function)
-	if !ok {
-		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
-	}
-
-	if len(fn.Parameters) != 1 {
-		t.Fatalf("function has wrong parameters. Parameters=%+v",
-			fn.Parameters)
-	}
-
-	if fn.Parameters[0].String() != "x" {
-		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; a = a + 1", 2},
+		{"let a = 1; let b = 1; a = b = 5; a + b", 10},
+		{"let a = 1; let f = fn() { a = 10 }; f(); a", 10},
+		{"let a = 1; let f = fn(a) { a = 10 }; f(2); a", 1},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr[1]", 20},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{"let grid = [[1, 2, 3], [4, 5, 6]]; grid[1][2] = 9; grid[1][2]", 9},
+		{`let data = {"user": {"age": 20}}; data["user"]["age"] = 30; data["user"]["age"]`, 30},
+		{`let users = [{"age": 20}, {"age": 21}]; users[1]["age"] = 40; users[1]["age"] + users[0]["age"]`, 60},
+		{`let data = {"grid": [[0, 0], [0, 0]]}; data["grid"][0][1] = 7; data["grid"][0][1]`, 7},
+		{"b = 1", "identifier not found: b"},
+		{"let grid = [[1]]; grid[3][0] = 1", "index out of bounds, index=3 len=1"},
+		{"let grid = [[1]]; grid[0][3] = 1", "index out of bounds, index=3 len=1"},
+		{`let grid = [[1]]; grid[0]["a"] = 1`, "unknown index type: STRING"},
+		{`let data = {"user": {}}; data["user"][fn() {}] = 1`, "unusable as hash key: FUNCTION"},
+		{`let data = {"user": 1}; data["user"]["age"] = 1`, "unknown operator: index assignment of INTEGER"},
+		{`let s = "abc"; s[0] = "z"`, "unknown operator: index assignment of STRING"},
 	}
 
-	expectedBody := `{
-    (x + 2)
-}`
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
 
-	if fn.Body.String() != expectedBody {
-		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
 	}
 }
 
-func TestFunctionCall(t *testing.T) {
+func TestPipeExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected interface{}
 	}{
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
+		{"let inc = fn(x) { x + 1 }; 1 |> inc", 2},
+		{"let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; 3 |> inc |> double |> inc", 9},
+		{"let sub = fn(a, b) { a - b }; 10 |> sub(3)", 7},
+		{"let sub = fn(a, b) { a - b }; 10 |> sub(3) |> sub(2)", 5},
+		{`"four" |> len`, 4},
+		{"[1, 2] |> push(3) |> len", 3},
+		{"1 + 2 |> fn(x) { x * 10 }", 30},
+		{"1 |> 2", "not a function: INTEGER"},
+		{"1 |> nope", "identifier not found: nope"},
+		{"1 |> push(2 + true)", "type mismatch: INTEGER + BOOLEAN"},
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
 	}
 }
 
-func TestClosures(t *testing.T) {
-	input := `
-let newAdder = fn(x) {
-fn(y) { x + y };
-};
-let addTwo = newAdder(2);
-addTwo(2);`
-
-	testIntegerObject(t, testEval(input), 4)
-}
+func TestMethodCallExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3].len()", 3},
+		{`"  hi  ".trim().upper()`, "HI"},
+		{"[1, 2].push(3).len()", 3},
+		{"let sub = fn(a, b) { a - b }; 10.sub(3)", 7},
+		{"let arr = [1, 2, 3]; arr.index_of(3) + arr.len()", 5},
+		{"1.nope()", "identifier not found: nope"},
+		{"let x = 1; 2.x()", "not a function: INTEGER"},
+		{"[1].push(2 + true)", "type mismatch: INTEGER + BOOLEAN"},
+	}
 
-func TestArrayObject(t *testing.T) {
-	input := `
-	let test = "three";
-	[1, true, "two", test];
-`
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
 
-	expected := []object.Object{
-		&object.Integer{Value: 1},
-		&object.Boolean{Value: true},
-		&object.String{Value: "two"},
-		&object.String{Value: "three"},
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if _, ok := evaluated.(*object.Error); ok {
+				testErrorObject(t, evaluated, expected)
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
+		}
 	}
-
-	testArrayObject(t, testEval(input), expected)
 }
 
-func TestIndexExpression(t *testing.T) {
-	inputInt := "[1, 2, 3][2]"
-	inputStr := `"test"[2]`
-
-	testIntegerObject(t, testEval(inputInt), 3)
-	testStringObject(t, testEval(inputStr), "s")
-}
+func TestFunctionMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a, b) { a + b }; let addFive = add.bind(5); addFive(3) == 8", true},
+		{"let add = fn(a, b) { a + b }; add.bind(1, 2)()", 3},
+		{"let sub = fn(a, b) { a - b }; apply(sub.bind(10), [3])", 7},
+		{"let add = fn(a, b) { a + b }; add.bind(1)()", "wrong number of arguments. got=1, want=2"},
+		{"let add = fn(a, b) { a + b }; add.arity()", 2},
+		{"fn() { 1 }.arity()", 0},
+		{"let add = fn(a, b) { a + b }; add.name()", "add"},
+		{"let add = fn(a, b) { a + b }; let plus = add; plus.name()", "add"},
+		{"fn() { 1 }.name()", nil},
+		{"let add = fn(a, b) { a + b }; add.params() == [\"a\", \"b\"]", true},
+		{"fn() { 1 }.params() == []", true},
+		{"let add = fn(a, b) { a + b }; add.inspect()", "fn(a, b) {\n    (a + b)\n}"},
+		{"let f = fn() { 1 }; f.call()", "unknown method: FUNCTION.call"},
+	}
 
-func TestRangeExpression(t *testing.T) {
-	input := "[1, 2, 3][0:2]"
-	inputEmpty := "[1, 2, 3][0:0]"
-	inputSlightOutOfBounds := "[1][1:1]"
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
 
-	expected := []object.Object{
-		&object.Integer{Value: 1},
-		&object.Integer{Value: 2},
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if _, ok := evaluated.(*object.Error); ok {
+				testErrorObject(t, evaluated, expected)
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
 	}
-
-	testArrayObject(t, testEval(input), expected)
-	testArrayObject(t, testEval(inputEmpty), []object.Object{})
-	testArrayObject(t, testEval(inputSlightOutOfBounds), []object.Object{})
 }
 
-func TestStringHashKey(t *testing.T) {
-	hello1 := &object.String{Value: "Hello World"}
-	hello2 := &object.String{Value: "Hello World"}
-	diff1 := &object.String{Value: "My name is johnny"}
-	diff2 := &object.String{Value: "My name is johnny"}
-
-	if hello1.HashKey() != hello2.HashKey() {
-		t.Errorf("strings with same content have different hash keys")
+func TestBuiltinMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type(len) == "BUILTIN"`, true},
+		{"len.name()", "len"},
+		{"let size = len; size.name()", "len"},
+		{"len.inspect()", "builtin function `len`"},
+		{"let add = fn(a, b) { a + b }; curry(add, 1).inspect()", "builtin function"},
+		{"let add = fn(a, b) { a + b }; curry(add, 1).name()", nil},
+		// other methods still call the builtin of that name with the receiver first
+		{`len.apply(["abc"])`, 3},
+		{`len("a", "b")`, "wrong number of arguments to `len`. got=2, want=1"},
+		{"max_of()", "wrong number of arguments to `max_of`. got=0, want=1"},
 	}
 
-	if diff1.HashKey() != diff2.HashKey() {
-		t.Errorf("strings with same content have different hash keys")
-	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
 
-	if hello1.HashKey() == diff1.HashKey() {
-		t.Errorf("strings with different content have same hash keys")
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if _, ok := evaluated.(*object.Error); ok {
+				testErrorObject(t, evaluated, expected)
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
 	}
 }
 
-func TestHashLiterals(t *testing.T) {
-	input := `let two = "two";
-{
-	"one": 10 - 9,
-	two: 1 + 1,
-	"thr" + "ee": 6 / 2,
-	4: 4,
-	true: 5,
-	false: 6
-}`
-
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Hash)
-	if !ok {
-		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
-	}
-
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+func TestDotExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let h = {"name": "monkey"}; h.name`, "monkey"},
+		{`let h = {"age": 5}; h.age + 1`, 6},
+		{`let h = {"a": {"b": 2}}; h.a.b`, 2},
+		{`let h = {"name": "monkey"}; h.missing`, nil},
+		{`let h = {"name": "monkey"}; h.name.len()`, 6},
+		{"let x = 5; x.name", "unknown operator: dot access of INTEGER"},
+		{"nope.name", "identifier not found: nope"},
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
-	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
-		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if _, ok := evaluated.(*object.Error); ok {
+				testErrorObject(t, evaluated, expected)
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
+		case nil:
+			testNullObject(t, evaluated)
 		}
-
-		testIntegerObject(t, pair.Value, expectedValue)
 	}
 }
 
-func TestHashIndexExpressions(t *testing.T) {
+func TestOptionalChaining(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
-		{
-			`{"foo": 5}["foo"]`,
-			5,
-		},
-		{
-			`{"foo": 5}["bar"]`,
-			nil,
+		{`let user = {"address": {"city": "Lisbon"}}; user?.address?.city`, "Lisbon"},
+		{`let user = null; user?.address?.city`, nil},
+		{`let user = {"address": null}; user?.address?.city`, nil},
+		{`let user = {"name": "monkey"}; user?.address?.city`, nil},
+		{`let user = {"tags": ["a", "b"]}; user?.tags[1]`, "b"},
+		{`let user = {"address": {"city": "Lisbon"}}; user.address?.city`, "Lisbon"},
+		{`let user = null; user?.name ?? "anonymous"`, "anonymous"},
+		{`let user = {"name": "monkey"}; user?.name?.len()`, 6},
+		{`let user = {}; user.name?.len()`, nil},
+		{`let user = {"address": null}; user?.address.city`, "unknown operator: dot access of NULL"},
+		{"let x = 5; x?.name", "unknown operator: dot access of INTEGER"},
+		// a null found by `?.` skips the rest of the chain, whatever comes after it
+		{`let user = null; user?.address.city`, nil},
+		{`let user = null; user?.address.city.len()`, nil},
+		{`let user = null; user?.tags[0]`, nil},
+		{`let user = null; user?.greet.bind(1)()`, nil},
+		{`let user = null; user?.tags[0] ?? "none"`, "none"},
+		// only the chain the `?.` is in, a null coming out of a call is accessed like any other
+		{`let city = fn(user) { user?.address }; city(null).name`, "unknown operator: dot access of NULL"},
+		{`let user = null; [user?.address][0].city`, "unknown operator: dot access of NULL"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if _, ok := evaluated.(*object.Error); ok {
+				testErrorObject(t, evaluated, expected)
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { i++ }; i", 5},
+		{"let i = 0; while (i < 5) { i = i + 1; i * 10 }", 50},
+		{"while (false) { 1 }", nil},
+		{"let i = 0; while (true) { i++; if (i == 3) { break } }; i", 3},
+		{"let i = 0; while (true) { i++; if (i == 3) { break } }", nil},
+		{"let i = 0; let sum = 0; while (i < 6) { i++; if (i == 2) { continue }; sum = sum + i }; sum", 19},
+		{"let f = fn() { let i = 0; while (true) { i++; if (i > 2) { return i } } }; f()", 3},
+		{"while (1 + true) { 1 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"let i = 0; while (i < 5) { i++; i + true }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDoWhileExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; do { i++ } while (false); i", 1},
+		{"do { 42 } while (false)", 42},
+		{"let i = 0; do { i++ } while (i < 5); i", 5},
+		{"let i = 0; do { i = i + 1; i * 10 } while (i < 3)", 30},
+		{"let i = 0; do { i++; break; i = 100 } while (true); i", 1},
+		{"let i = 0; do { i++; break } while (true)", nil},
+		{"let i = 0; let odd = 0; do { i++; if (i == i / 2 * 2) { continue }; odd = odd + i } while (i < 6); odd", 9},
+		{"let f = fn() { do { return 7 } while (true) }; f()", 7},
+		{"do { 1 } while (nope)", "identifier not found: nope"},
+		{"do { nope } while (true)", "identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLoopExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; loop { i++; if (i == 10) { break } }; i", 10},
+		{"let i = 0; loop { i++; if (i == 10) { break } }", nil},
+		{"let i = 0; loop { i++; if (i == 10) { break i * 2 } }", 20},
+		{"let i = 0; let sum = 0; loop { i++; if (i > 6) { break sum }; if (i == i / 2 * 2) { continue }; sum = sum + i }", 9},
+		{"let f = fn() { loop { return 3 } }; f()", 3},
+		{"let i = 0; let found = loop { i++; if (i * i > 50) { break i } }; found", 8},
+		{"let i = 0; while (true) { i++; if (i == 4) { break i } }", 4},
+		{"do { break 5 } while (true)", 5},
+		{"loop { break nope }", "unknown label nope"},
+		{"outer: loop { loop { break outr } }", "unknown label outr"},
+		{"loop { break nope + 1 }", "identifier not found: nope"},
+		{"loop { 1 + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"break 1", "break outside of a loop"},
+		// the value has to be on the same line, otherwise it's the next statement
+		{"let i = 0; loop { i++; if (i == 3) { break\n i * 100 } }; i", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestForInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for v in [1, 2, 3] { sum = sum + v }; sum", 6},
+		{"let sum = 0; for i, v in [10, 20, 30] { sum = sum + i * v }; sum", 80},
+		{"let sum = 0; for n in 1:5 { sum = sum + n }; sum", 10},
+		{"for v in [1, 2, 3] { v * 2 }", 6},
+		{"for v in [] { v }", nil},
+		{"for v in [1, 2, 3] { if (v == 2) { break v * 10 } }", 20},
+		{"let sum = 0; for v in [1, 2, 3, 4] { if (v == 2) { continue }; sum = sum + v }; sum", 8},
+		{"let f = fn(xs) { for v in xs { if (v > 1) { return v } } }; f([1, 5, 9])", 5},
+		{"let count = 0; outer: for x in 0:3 { for y in 0:3 { if (y == 1) { continue outer }; count++ } }; count", 3},
+		{"for v in 5 { v }", "cannot iterate over INTEGER"},
+		{`for v in {"a": 1} { v }`, "cannot iterate over HASH"},
+		{"for v in [1] { v + true }", "type mismatch: INTEGER + BOOLEAN"},
+		// the loop variables only exist inside the loop
+		{"for i, v in [1] { v }; i", "identifier not found: i"},
+		{"for i, v in [1] { v }; v", "identifier not found: v"},
+		{"for v in [1] { let inner = v }; inner", "identifier not found: inner"},
+		// a variable from outside the loop is shadowed, not overwritten
+		{"let v = 7; for v in [1, 2] { v }; v", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestForInWithIndex(t *testing.T) {
+	input := `let out = []; for i, v in [10, 20, 30] { out = push(out, "" + i + ": " + v) }; out`
+
+	arr, ok := testEval(input).(*object.Array)
+	if !ok {
+		t.Fatalf("expected an array")
+	}
+
+	expected := []string{"0: 10", "1: 20", "2: 30"}
+	if len(arr.Elements) != len(expected) {
+		t.Fatalf("wrong number of lines. expected=%d, got=%d", len(expected), len(arr.Elements))
+	}
+	for i, line := range expected {
+		testStringObject(t, arr.Elements[i], line)
+	}
+
+	input = `let out = []; for i, c in "héllo" { out = push(out, c + i) }; out`
+	arr = testEval(input).(*object.Array)
+	expected = []string{"h0", "é1", "l2", "l3", "o4"}
+	for i, line := range expected {
+		testStringObject(t, arr.Elements[i], line)
+	}
+
+	// every iteration has its own environment, so closures keep their iteration's values
+	input = "let fs = []; for i, v in [5, 6] { fs = push(fs, fn() { i * 10 + v }) }; fs[0]() + fs[1]()"
+	testIntegerObject(t, testEval(input), 5+16)
+}
+
+func TestLabeledLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`
+let i = 0;
+let j = 0;
+outer: while (i < 10) {
+	j = 0;
+	while (j < 10) {
+		if (i * j == 6) { break outer }
+		j++
+	}
+	i++
+}
+i * 100 + j
+`, 106},
+		{`
+let count = 0;
+outer: loop {
+	loop {
+		count++;
+		if (count < 5) { continue outer }
+		break outer count * 10
+	}
+}
+`, 50},
+		{`
+let pairs = 0;
+let i = 0;
+outer: while (i < 3) {
+	i++;
+	let j = 0;
+	while (j < 3) {
+		j++;
+		if (j == 2) { continue outer }
+		pairs++
+	}
+}
+pairs
+`, 3},
+		{"let i = 0; outer: loop { loop { break }; i++; if (i == 3) { break outer i } }", 3},
+		{"outer: loop { do { break outer } while (true) }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDoWhileRunsBodyOnceWhenConditionIsFalse(t *testing.T) {
+	bodyCalls, conditionCalls := 0, 0
+	env := object.NewEnvironment()
+	env.Set("body", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		bodyCalls++
+		return NULL
+	}})
+	env.Set("condition", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		conditionCalls++
+		return FALSE
+	}})
+
+	testEvalWithEnv("do { body() } while (condition())", env)
+
+	if bodyCalls != 1 {
+		t.Errorf("body ran wrong number of times. expected=1, got=%d", bodyCalls)
+	}
+	if conditionCalls != 1 {
+		t.Errorf("condition evaluated wrong number of times. expected=1, got=%d", conditionCalls)
+	}
+
+	bodyCalls, conditionCalls = 0, 0
+	testEvalWithEnv("while (condition()) { body() }", env)
+
+	if bodyCalls != 0 {
+		t.Errorf("while body should not run when the condition is false. got=%d", bodyCalls)
+	}
+}
+
+func TestLoopSignalsOutsideLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break", "break outside of a loop"},
+		{"if (true) { continue }", "continue outside of a loop"},
+		{"let f = fn() { break }; while (true) { f() }", "break outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPostfixExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 5; i++", 5},
+		{"let i = 5; i++; i", 6},
+		{"let i = 5; i--", 5},
+		{"let i = 5; i--; i--; i", 3},
+		// `--` is only a decrement right after a name or an index with nothing following it
+		{"let a = 5; let b = 2; a--b", 7},
+		{"let x = 3; --x", 3},
+		{"let i = 5; let j = i--; j * 10 + i", 54},
+		{"let i = 5; i++ + i", 11},
+		{"let i = 0; let inc = fn() { i++ }; inc(); inc(); i", 2},
+		{"let i = true; i++", "unknown operator: BOOLEAN++"},
+		{`let s = "a"; s--`, "unknown operator: STRING--"},
+		{"nope++", "identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestComparisonChains(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 5; 1 < x < 10", true},
+		{"let x = 50; 1 < x < 10", false},
+		{"let x = 0; 1 < x < 10", false},
+		{"1 < 2 < 3 < 4", true},
+		{"1 < 2 < 3 < 3", false},
+		{"3 > 2 < 5", true},
+		{"1 < 2 < 3 == true", true},
+		{"1 < true < 3", "type mismatch: INTEGER < BOOLEAN"},
+		{`1 < 2 < "a"`, "type mismatch: INTEGER < STRING"},
+		// the chain stops at the first failed comparison, so the error is never reached
+		{`2 < 1 < "a"`, false},
+		// a comparison in parentheses isn't part of the chain
+		{"(3 > 2) > 1", "type mismatch: BOOLEAN > INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestComparisonChainEvaluatesOperandsOnce(t *testing.T) {
+	calls := 0
+	env := object.NewEnvironment()
+	env.Set("tick", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		calls++
+		return args[0]
+	}})
+
+	testBooleanObject(t, testEvalWithEnv("1 < tick(5) < 10", env), true)
+
+	if calls != 1 {
+		t.Errorf("middle operand evaluated wrong number of times. expected=1, got=%d", calls)
+	}
+
+	calls = 0
+	testBooleanObject(t, testEvalWithEnv("1 > 2 < tick(5)", env), false)
+
+	if calls != 0 {
+		t.Errorf("operand after a failed comparison should not be evaluated. got=%d calls", calls)
+	}
+}
+
+func TestCoalesceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null ?? 5", 5},
+		{"1 ?? 5", 1},
+		{"false ?? 5", false},
+		{`let h = {"a": 1}; h.b ?? h.a ?? 3`, 1},
+		{"[1][5 - 5] ?? 2", 1},
+		{"null ?? null", nil},
+		// a block ending in a let has no value, which counts as null
+		{"{ let x = 1 } ?? 5", 5},
+		{"let f = fn() { let x = 1 }; f() ?? 5", 5},
+		{"1 ?? nope", 1},
+		{"1 ?? (1 + true)", 1},
+		{"null ?? nope", "identifier not found: nope"},
+		{"nope ?? 1", "identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := `{
+    (x + 2)
+}`
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionCall(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionCallWrongNumberOfArguments(t *testing.T) {
+	testErrorObject(t, testEval("let add = fn(x, y) { x + y; }; add(1);"), "wrong number of arguments. got=1, want=2")
+	testErrorObject(t, testEval("fn(x) { x; }()"), "wrong number of arguments. got=0, want=1")
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+fn(y) { x + y };
+};
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestArrayObject(t *testing.T) {
+	input := `
+	let test = "three";
+	[1, true, "two", test];
+`
+
+	expected := []object.Object{
+		&object.Integer{Value: 1},
+		&object.Boolean{Value: true},
+		&object.String{Value: "two"},
+		&object.String{Value: "three"},
+	}
+
+	testArrayObject(t, testEval(input), expected)
+}
+
+func TestIndexExpression(t *testing.T) {
+	inputInt := "[1, 2, 3][2]"
+	inputStr := `"test"[2]`
+
+	testIntegerObject(t, testEval(inputInt), 3)
+	testStringObject(t, testEval(inputStr), "s")
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	input := "café"
+	if len(input) != 5 {
+		t.Fatalf("test input should be 5 bytes long. got=%d", len(input))
+	}
+
+	testIntegerObject(t, testEval(`len("café")`), 4)
+	testIntegerObject(t, testEval(`len("日本語")`), 3)
+	testStringObject(t, testEval(`"café"[3]`), "é")
+	testStringObject(t, testEval(`"café"[1:3]`), "af")
+	testStringObject(t, testEval(`"café"[2:4]`), "fé")
+	testStringObject(t, testEval(`"日本語"[1]`), "本")
+	testErrorObject(t, testEval(`"café"[4]`), "index out of bounds, index=4 len=4")
+	testErrorObject(t, testEval(`"café"[0:5]`), "range index out of bounds, index=0:5 len=4")
+}
+
+func TestRangeExpression(t *testing.T) {
+	input := "[1, 2, 3][0:2]"
+	inputEmpty := "[1, 2, 3][0:0]"
+	inputSlightOutOfBounds := "[1][1:1]"
+
+	expected := []object.Object{
+		&object.Integer{Value: 1},
+		&object.Integer{Value: 2},
+	}
+
+	testArrayObject(t, testEval(input), expected)
+	testArrayObject(t, testEval(inputEmpty), []object.Object{})
+	testArrayObject(t, testEval(inputSlightOutOfBounds), []object.Object{})
+}
+
+func TestStandaloneRange(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedFrom int64
+		expectedTo   int64
+	}{
+		{"1:5", 1, 5},
+		{"let r = 2:4; r", 2, 4},
+		{"let n = 3; n - 1:n * 2", 2, 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		rg, ok := evaluated.(*object.Range)
+		if !ok {
+			t.Errorf("input %q - object is not Range. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if rg.From != tt.expectedFrom || rg.ToExclusive != tt.expectedTo {
+			t.Errorf("input %q - wrong range. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedFrom, tt.expectedTo, rg.From, rg.ToExclusive)
+		}
+	}
+
+	testArrayObject(t, testEval("let arr = [1, 2, 3, 4, 5]; arr[2:4]"), []object.Object{
+		&object.Integer{Value: 3},
+		&object.Integer{Value: 4},
+	})
+	testBooleanObject(t, testEval(`{"ok": 1 == 1}["ok"]`), true)
+	testStringObject(t, testEval(`{1 == 1: "yes"}[true]`), "yes")
+}
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &object.String{Value: "Hello World"}
+	hello2 := &object.String{Value: "Hello World"}
+	diff1 := &object.String{Value: "My name is johnny"}
+	diff2 := &object.String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+{
+	"one": 10 - 9,
+	two: 1 + 1,
+	"thr" + "ee": 6 / 2,
+	4: 4,
+	true: 5,
+	false: 6
+}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashLiteralEvaluationOrder(t *testing.T) {
+	var logged []string
+	env := object.NewEnvironment()
+	env.Set("log", &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			logged = append(logged, args[0].Inspect())
+			return args[0]
+		},
+	})
+
+	testEvalWithEnv(`{log("k1"): log("v1"), log("k2"): log("v2"), log("k3"): log("v3"), log("k4"): log("v4")}`, env)
+
+	expected := []string{"k1", "v1", "k2", "v2", "k3", "v3", "k4", "v4"}
+	if len(logged) != len(expected) {
+		t.Fatalf("wrong number of evaluations. got=%v", logged)
+	}
+
+	for i := range expected {
+		if logged[i] != expected[i] {
+			t.Fatalf("wrong evaluation order. expected=%v, got=%v", expected, logged)
+		}
+	}
+}
+
+func TestNullHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{null: "x", 1: "y"}[null]`, "x"},
+		{`{null: "x", 1: "y"}[1]`, "y"},
+		{`let h = {}; h[null] = "set"; h[null]`, "set"},
+		{`{null: 1}[null] == 1`, true},
+		{`has_key({null: 1}, null)`, true},
+		{`get({}, null, "default")`, "default"},
+		{`let h = {null: 1, 0: 2, false: 3}; h[null] + h[0] * 10 + h[false] * 100`, 321},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`{"foo": 5}["foo"]`,
+			5,
+		},
+		{
+			`{"foo": 5}["bar"]`,
+			nil,
+		},
+		{
+			`let key = "foo"; {"foo": 5}[key]`,
+			5,
+		},
+		{
+			`{}["foo"]`,
+			nil,
+		},
+		{
+			`{5: 5}[5]`,
+			5,
+		},
+		{
+			`{true: 5}[true]`,
+			5,
+		},
+		{
+			`{false: 5}[false]`,
+			5,
+		},
+		{
+			`{null: 1}[null]`,
+			1,
+		},
+		{
+			`{0: 1}[null]`,
+			nil,
+		},
+		{
+			`{null: 1}[0]`,
+			nil,
+		},
+		{
+			`{false: 1}[null]`,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testArrayObject(t *testing.T, obj object.Object, expected []object.Object) bool {
+	result, ok := obj.(*object.Array)
+	if !ok {
+		t.Errorf("object is not Array. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	actual := result.Elements
+
+	if len(actual) != len(expected) {
+		t.Errorf("array has the wrong len. got=%d, want=%d",
+			len(actual), len(expected))
+		return false
+	}
+
+	for i := range actual {
+		if (actual[i].Type() != expected[i].Type()) ||
+			(actual[i].Inspect() != expected[i].Inspect()) {
+			t.Errorf("element is not expected. got=%v, want=%v",
+				actual[i], expected[i])
+			return false
+		}
+	}
+
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments to `len`. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"sqrt(16)", 4},
+		{"sqrt(17)", 4},
+		{"sqrt(0)", 0},
+		{"sqrt(1)", 1},
+		{"sqrt(9223372036854775807)", 3037000499},
+		{"sqrt(-4)", "argument to `sqrt` must not be negative, got -4"},
+		{`sqrt("16")`, "argument to `sqrt` must be INTEGER, got STRING"},
+		{"pow(2, 10)", 1024},
+		{"pow(-3, 3)", -27},
+		{"pow(5, 0)", 1},
+		{"pow(2, 62)", 4611686018427387904},
+		{"pow(-2, 63)", -9223372036854775808},
+		{"pow(2, 64)", "result of `pow` is too large, got pow(2, 64)"},
+		{"pow(10, 19)", "result of `pow` is too large, got pow(10, 19)"},
+		{"pow(2, -1)", "second argument to `pow` must not be negative, got -1"},
+		{"pow(2)", "wrong number of arguments to `pow`. got=1, want=2"},
+		{"abs(-5)", 5},
+		{"abs(5)", 5},
+		{"abs(0)", 0},
+		{`abs("-5")`, "argument to `abs` must be INTEGER, got STRING"},
+		{"sign(-7)", -1},
+		{"sign(0)", 0},
+		{"sign(42)", 1},
+		{`sign("1")`, "argument to `sign` must be INTEGER, got STRING"},
+		{"sign()", "wrong number of arguments to `sign`. got=0, want=1"},
+		{"floor(7)", 7},
+		{"ceil(-7)", -7},
+		{"round(3)", 3},
+		{"floor(true)", "argument to `floor` must be INTEGER, got BOOLEAN"},
+		{`ceil("1")`, "argument to `ceil` must be INTEGER, got STRING"},
+		{"round()", "wrong number of arguments to `round`. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int64
+	}{
+		{"slice([1, 2, 3, 4, 5], 1, 3)", []int64{2, 3}},
+		{"slice([1, 2, 3], -2)", []int64{2, 3}},
+		{"slice([1, 2, 3], 0, 100)", []int64{1, 2, 3}},
+		{"slice([1, 2, 3], null, 2)", []int64{1, 2}},
+		{"slice([1, 2, 3], 1, null)", []int64{2, 3}},
+		{"slice([1, 2, 3], -100, -1)", []int64{1, 2}},
+		{"slice([1, 2, 3], 2, 1)", []int64{}},
+		{"slice([1, 2, 3])", []int64{1, 2, 3}},
+		{"slice([])", []int64{}},
+	}
+
+	for _, tt := range tests {
+		expected := make([]object.Object, len(tt.expected))
+		for i, el := range tt.expected {
+			expected[i] = &object.Integer{Value: el}
+		}
+
+		testArrayObject(t, testEval(tt.input), expected)
+	}
+
+	copied := testEval("let arr = [1, 2]; let copied = slice(arr); [arr, copied]").(*object.Array)
+	if copied.Elements[0] == copied.Elements[1] {
+		t.Errorf("slice with no bounds didn't return a copy")
+	}
+
+	testErrorObject(t, testEval("slice(1, 2)"), "first argument to `slice` must be ARRAY or STRING, got INTEGER")
+	testErrorObject(t, testEval(`slice([1], "a")`), "bounds of `slice` must be INTEGER or NULL, got STRING")
+	testErrorObject(t, testEval("slice()"), "wrong number of arguments to `slice`. got=0, want=1 to 3")
+}
+
+func TestSliceString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`slice("hello", 1, 3)`, "el"},
+		{`slice("hello", 1)`, "ello"},
+		{`slice("hello", 1, null)`, "ello"},
+		{`slice("hello", -3)`, "llo"},
+		{`slice("hello", -3, -1)`, "ll"},
+		{`slice("hello", null, 2)`, "he"},
+		{`slice("hello", 0, 100)`, "hello"},
+		{`slice("café", 2)`, "fé"},
+		{`slice("日本語", -1)`, "語"},
+		{`slice("hello")`, "hello"},
+		{`slice("", 0, 1)`, ""},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(`slice("abc", true)`), "bounds of `slice` must be INTEGER or NULL, got BOOLEAN")
+}
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`parseInt("42")`, 42},
+		{`parseInt("-17")`, -17},
+		{`parseInt("ff", 16)`, 255},
+		{`parseInt("FF", 16)`, 255},
+		{`parseInt("101", 2)`, 5},
+		{`parseInt("z", 36)`, 35},
+		{`parseInt("12abc")`, "could not parse \"12abc\" as integer in base 10"},
+		{`parseInt("")`, "could not parse \"\" as integer in base 10"},
+		{`parseInt("2", 2)`, "could not parse \"2\" as integer in base 2"},
+		{`parseInt("1", 37)`, "base of `parseInt` must be between 2 and 36, got 37"},
+		{`parseInt("1", 1)`, "base of `parseInt` must be between 2 and 36, got 1"},
+		{`parseInt(1)`, "first argument to `parseInt` must be STRING, got INTEGER"},
+		{`parseInt("1", "2")`, "second argument to `parseInt` must be INTEGER, got STRING"},
+		{`parseInt()`, "wrong number of arguments to `parseInt`. got=0, want=1 or 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestCharsBuiltins(t *testing.T) {
+	testArrayObject(t, testEval(`chars("hi")`), []object.Object{
+		&object.String{Value: "h"},
+		&object.String{Value: "i"},
+	})
+	testArrayObject(t, testEval(`chars("né日")`), []object.Object{
+		&object.String{Value: "n"},
+		&object.String{Value: "é"},
+		&object.String{Value: "日"},
+	})
+	testArrayObject(t, testEval(`chars("")`), []object.Object{})
+	testArrayObject(t, testEval(`bytes("hé")`), []object.Object{
+		&object.Integer{Value: 104},
+		&object.Integer{Value: 195},
+		&object.Integer{Value: 169},
+	})
+
+	for _, str := range []string{"", "hello", "café", "日本語", "a b\tc"} {
+		testStringObject(t, testEval(`from_chars(chars("`+str+`"))`), str)
+		testStringObject(t, testEval(`join(chars("`+str+`"), "")`), str)
+	}
+
+	testStringObject(t, testEval(`join(["a", "b", "c"], ", ")`), "a, b, c")
+
+	testErrorObject(t, testEval(`chars(1)`), "argument to `chars` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`bytes([])`), "argument to `bytes` must be STRING, got ARRAY")
+	testErrorObject(t, testEval(`from_chars(["a", "bc"])`), "element 1 of `from_chars` must be a single character, got \"bc\"")
+	testErrorObject(t, testEval(`from_chars([""])`), "element 0 of `from_chars` must be a single character, got \"\"")
+	testErrorObject(t, testEval(`from_chars(["a", 1])`), "element 1 of `from_chars` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`join(["a", 1], "")`), "element 1 of `join` must be STRING, got INTEGER")
+}
+
+func TestTrimBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`trim("  hello  ")`, "hello"},
+		{"trim(\"\thello\n\")", "hello"},
+		{`trim("xxhelloxx", "x")`, "hello"},
+		{`trim("xyhelloyx", "xy")`, "hello"},
+		{`trim_left("  hi  ")`, "hi  "},
+		{`trim_left("  hi", "")`, "  hi"},
+		{`trim_left("..hi..", ".")`, "hi.."},
+		{`trim_right("  hi  ")`, "  hi"},
+		{`trim_right("hello...", ".")`, "hello"},
+		{`trim("")`, ""},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval("trim(1)"), "first argument to `trim` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`trim_left("a", 1)`), "second argument to `trim_left` must be STRING, got INTEGER")
+	testErrorObject(t, testEval("trim_right(true)"), "first argument to `trim_right` must be STRING, got BOOLEAN")
+	testErrorObject(t, testEval("trim()"), "wrong number of arguments to `trim`. got=0, want=1 or 2")
+}
+
+func TestEnumerate(t *testing.T) {
+	testArrayObject(t, testEval(`enumerate(["a", "b"])`), []object.Object{
+		&object.Array{Elements: []object.Object{&object.Integer{Value: 0}, &object.String{Value: "a"}}},
+		&object.Array{Elements: []object.Object{&object.Integer{Value: 1}, &object.String{Value: "b"}}},
+	})
+	testArrayObject(t, testEval("enumerate([])"), []object.Object{})
+
+	testErrorObject(t, testEval(`enumerate("ab")`), "argument to `enumerate` must be ARRAY, got STRING")
+	testErrorObject(t, testEval("enumerate([], [])"), "wrong number of arguments to `enumerate`. got=2, want=1")
+}
+
+func TestReplaceBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`replace("hello world", "world", "monkey")`, "hello monkey"},
+		{`replace("a-b-c", "-", "+")`, "a+b-c"},
+		{`replace_all("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("abc", "x", "y")`, "abc"},
+		{`replace("abc", "", "-")`, "-abc"},
+		{`replace_all("abc", "", "-")`, "-a-b-c-"},
+		{`replace_all("café", "é", "e")`, "cafe"},
+		{`starts_with("hello", "he")`, true},
+		{`starts_with("hello", "lo")`, false},
+		{`starts_with("hello", "")`, true},
+		{`starts_with("日本語", "日本")`, true},
+		{`ends_with("hello", "lo")`, true},
+		{`ends_with("hello", "he")`, false},
+		{`ends_with("café", "é")`, true},
+		{`startsWith("hello", "he")`, true},
+		{`startsWith("hello", "lo")`, false},
+		{`endsWith("hello", "lo")`, true},
+		{`endsWith("hello", "hel")`, false},
+		{`contains("hello", "ell")`, true},
+		{`contains("hello", "")`, true},
+		{`contains("hello", "elo")`, false},
+		{`contains("日本語", "本")`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+
+	testErrorObject(t, testEval(`replace("a", 1, "b")`), "arguments to `replace` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`replace_all("a", "b")`), "wrong number of arguments to `replace_all`. got=2, want=3")
+	testErrorObject(t, testEval(`starts_with(1, "a")`), "arguments to `starts_with` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`ends_with("a", [])`), "arguments to `ends_with` must be STRING, got ARRAY")
+	testErrorObject(t, testEval(`startsWith(1, "a")`), "arguments to `startsWith` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`endsWith("a", true)`), "arguments to `endsWith` must be STRING, got BOOLEAN")
+	testErrorObject(t, testEval(`contains(["a"], "a")`), "arguments to `contains` must be STRING, got ARRAY")
+	testErrorObject(t, testEval(`contains("a")`), "wrong number of arguments to `contains`. got=1, want=2")
+}
+
+func TestZip(t *testing.T) {
+	testArrayObject(t, testEval(`zip([1, 2], ["a", "b"])`), []object.Object{
+		&object.Array{Elements: []object.Object{&object.Integer{Value: 1}, &object.String{Value: "a"}}},
+		&object.Array{Elements: []object.Object{&object.Integer{Value: 2}, &object.String{Value: "b"}}},
+	})
+	testArrayObject(t, testEval(`zip([1, 2, 3], ["a"], [true, false])`), []object.Object{
+		&object.Array{Elements: []object.Object{&object.Integer{Value: 1}, &object.String{Value: "a"}, TRUE}},
+	})
+	testArrayObject(t, testEval(`zip([], [1, 2])`), []object.Object{})
+
+	testErrorObject(t, testEval(`zip([1], "a")`), "arguments to `zip` must be ARRAY, got STRING")
+	testErrorObject(t, testEval(`zip([1])`), "wrong number of arguments to `zip`. got=1, want at least 2")
+}
+
+func TestCaseBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`upper("hello")`, "HELLO"},
+		{`upper("abc123")`, "ABC123"},
+		{`upper("ß")`, "SS"},
+		{`upper("straße")`, "STRASSE"},
+		{`upper("café")`, "CAFÉ"},
+		{`lower("HELLO")`, "hello"},
+		{`lower("ABC123")`, "abc123"},
+		{`lower("ÀÉÎ")`, "àéî"},
+		{`title("hello world")`, "Hello World"},
+		{`title("hELLO wORLD")`, "Hello World"},
+		{`title("élan vital")`, "Élan Vital"},
+		{`upper("")`, ""},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval("upper(1)"), "arguments to `upper` must be STRING, got INTEGER")
+	testErrorObject(t, testEval("lower(1)"), "arguments to `lower` must be STRING, got INTEGER")
+	testErrorObject(t, testEval("title(1)"), "arguments to `title` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`upper("a", "b")`), "wrong number of arguments to `upper`. got=2, want=1")
+}
+
+func TestBase64Builtins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`base64Encode("hello")`, "aGVsbG8="},
+		{`base64Encode("")`, ""},
+		{`base64Decode("aGVsbG8=")`, "hello"},
+		{`base64Decode(base64Encode("héllo, wörld!"))`, "héllo, wörld!"},
+		{`base64Decode(base64Encode(""))`, ""},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(`base64Decode("not base64!")`), `could not decode "not base64!" as base64`)
+	testErrorObject(t, testEval("base64Encode(1)"), "arguments to `base64Encode` must be STRING, got INTEGER")
+	testErrorObject(t, testEval("base64Decode(true)"), "arguments to `base64Decode` must be STRING, got BOOLEAN")
+	testErrorObject(t, testEval(`base64Encode("a", "b")`), "wrong number of arguments to `base64Encode`. got=2, want=1")
+}
+
+func TestRegexBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`regexMatch("^h.llo$", "hello")`, true},
+		{`regexMatch("[0-9]+", "abc")`, false},
+		{`regexMatch("", "")`, true},
+		{`regexFind("[0-9]+", "abc 123 456")`, "123"},
+		{`regexFind("b*", "abc")`, ""},
+		{`regexFind("[0-9]+", "abc")`, nil},
+		{`let n = 0; for w in ["a1", "b", "c2"] { if (regexMatch("[0-9]", w)) { n = n + 1 } }; n`, 2},
+		{`regexReplace("(\w+)@(\w+)", "alice@home bob@work", "$2:$1")`, "home:alice work:bob"},
+		{`regexReplace("(a)", "banana", "${1}x")`, "baxnaxnax"},
+		{`regexReplace("z", "abc", "y")`, "abc"},
+		{"join(regexSplit(\"\\s+\", \"a  b\tc\n d\"), \",\")", "a,b,c,d"},
+		{`len(regexSplit(",", ""))`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	testErrorObject(t, testEval(`regexMatch("(", "a")`),
+		"could not compile pattern \"(\": error parsing regexp: missing closing ): `(`")
+	testErrorObject(t, testEval(`regexFind("[a", "a")`),
+		"could not compile pattern \"[a\": error parsing regexp: missing closing ]: `[a`")
+	testErrorObject(t, testEval(`regexMatch(1, "a")`), "arguments to `regexMatch` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`regexFind("a")`), "wrong number of arguments to `regexFind`. got=1, want=2")
+	testErrorObject(t, testEval(`regexReplace("(", "a", "b")`),
+		"could not compile pattern \"(\": error parsing regexp: missing closing ): `(`")
+	testErrorObject(t, testEval(`regexSplit("[", "a")`),
+		"could not compile pattern \"[\": error parsing regexp: missing closing ]: `[`")
+	testErrorObject(t, testEval(`regexReplace("a", "b")`), "wrong number of arguments to `regexReplace`. got=2, want=3")
+	testErrorObject(t, testEval(`regexSplit("a", 1)`), "arguments to `regexSplit` must be STRING, got INTEGER")
+}
+
+func TestRegexCacheIsBounded(t *testing.T) {
+	for i := 0; i < maxRegexps*2; i++ {
+		testBooleanObject(t, testEval(fmt.Sprintf(`regexMatch("a%d", "a%d")`, i, i)), true)
+	}
+	testEval(`regexMatch("a0", "a0")`)
+
+	if len(regexps) > maxRegexps || regexpsOrder.Len() > maxRegexps {
+		t.Errorf("expected at most %d cached patterns, got=%d", maxRegexps, len(regexps))
+	}
+	if _, ok := regexps["a0"]; !ok {
+		t.Errorf("expected the most recently used pattern to be cached")
+	}
+	if _, ok := regexps["a1"]; ok {
+		t.Errorf("expected the least recently used patterns to be evicted")
+	}
+}
+
+func TestIndexOf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"index_of([1, 2, 3, 4], 3)", 2},
+		{"index_of([1, 2, 3, 4], 5)", -1},
+		{"index_of([], 1)", -1},
+		{`index_of(["a", "b", "a"], "a")`, 0},
+		{"index_of([1, true, null], true)", 1},
+		{"index_of([1, true, null], null)", 2},
+		{`index_of([1, "1"], "1")`, 1},
+		{"last_index_of([1, 2, 1, 2], 2)", 3},
+		{"last_index_of([1, 2, 1, 2], 1)", 2},
+		{"last_index_of([1, 2], 3)", -1},
+		{`index_of("hello world", "o")`, 4},
+		{`index_of("hello world", "world")`, 6},
+		{`index_of("hello", "z")`, -1},
+		{`index_of("hello", "")`, 0},
+		{`last_index_of("hello world", "o")`, 7},
+		// strings are searched by byte index, unlike with indexOf
+		{`index_of("café au lait", "au")`, 6},
+		{`last_index_of("日本語", "語")`, 6},
+		{`index_of("a", 1)`, "second argument to `index_of` must be STRING, got INTEGER"},
+		{`index_of(1, 1)`, "first argument to `index_of` must be ARRAY or STRING, got INTEGER"},
+		{`last_index_of({}, 1)`, "first argument to `last_index_of` must be ARRAY or STRING, got HASH"},
+		{`index_of([1])`, "wrong number of arguments to `index_of`. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"flatten([1, [2, 3], [4, [5, [6]]]])", "[1, 2, 3, 4, [5, [6]]]"},
+		{"flatten([1, [2, 3], [4, [5, [6]]]], 1)", "[1, 2, 3, 4, [5, [6]]]"},
+		{"flatten([1, [2, 3], [4, [5, [6]]]], 2)", "[1, 2, 3, 4, 5, [6]]"},
+		{"flatten([1, [2, 3], [4, [5, [6]]]], -1)", "[1, 2, 3, 4, 5, 6]"},
+		{"flatten([1, [2]], 0)", "[1, [2]]"},
+		{`flatten(["a", [], [[]], true])`, "[a, [], true]"},
+		{"flatten([])", "[]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if _, ok := evaluated.(*object.Array); !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval("flatten(1)"), "first argument to `flatten` must be ARRAY, got INTEGER")
+	testErrorObject(t, testEval(`flatten([], "1")`), "second argument to `flatten` must be INTEGER, got STRING")
+	testErrorObject(t, testEval("flatten([], -2)"), "depth of `flatten` must be -1 or greater, got -2")
+}
+
+func TestSubstringIndexOf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`substring("hello world", 0, 5)`, "hello"},
+		{`substring("hello world", 6, 11)`, "world"},
+		{`substring("hello", 2, 2)`, ""},
+		{`substring("日本語です", 1, 3)`, "本語"},
+		{`indexOf("hello world", "world")`, 6},
+		{`indexOf("hello", "l")`, 2},
+		{`indexOf("hello", "")`, 0},
+		{`indexOf("日本語", "語")`, 2},
+		{`indexOf("hello", "z")`, -1},
+		{`let s = "a=b"; substring(s, indexOf(s, "=") + 1, len(s))`, "b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	testErrorObject(t, testEval(`substring("hello", 1, 10)`), "range index out of bounds, index=1:10 len=5")
+	testErrorObject(t, testEval(`substring("hello", -1, 2)`), "range index out of bounds, index=-1:2 len=5")
+	testErrorObject(t, testEval(`substring("hello", 3, 1)`), "range index out of bounds, index=3:1 len=5")
+	testErrorObject(t, testEval(`substring([1], 0, 1)`), "first argument to `substring` must be STRING, got ARRAY")
+	testErrorObject(t, testEval(`substring("a", 0, "1")`), "bounds of `substring` must be INTEGER, got STRING")
+	testErrorObject(t, testEval(`substring("a", 0)`), "wrong number of arguments to `substring`. got=2, want=3")
+	testErrorObject(t, testEval(`indexOf([1, 2], 1)`), "arguments to `indexOf` must be STRING, got ARRAY")
+	testErrorObject(t, testEval(`indexOf("a")`), "wrong number of arguments to `indexOf`. got=1, want=2")
+}
+
+func TestRepeat(t *testing.T) {
+	testStringObject(t, testEval(`repeat("ha", 3)`), "hahaha")
+	testStringObject(t, testEval(`repeat("x", 0)`), "")
+	testStringObject(t, testEval(`repeat("", 5)`), "")
+	testArrayObject(t, testEval("repeat([1, 2], 3)"), []object.Object{
+		&object.Integer{Value: 1},
+		&object.Integer{Value: 2},
+		&object.Integer{Value: 1},
+		&object.Integer{Value: 2},
+		&object.Integer{Value: 1},
+		&object.Integer{Value: 2},
+	})
+	testArrayObject(t, testEval("repeat([1, 2], 0)"), []object.Object{})
+
+	testErrorObject(t, testEval(`repeat("x", -1)`), "second argument to `repeat` must not be negative, got -1")
+	testErrorObject(t, testEval(`repeat("ha", 9223372036854775807)`),
+		"second argument to `repeat` is too large, got 9223372036854775807")
+	testErrorObject(t, testEval("repeat([1, 2], 9223372036854775807)"),
+		"second argument to `repeat` is too large, got 9223372036854775807")
+	testArrayObject(t, testEval("repeat([], 9223372036854775807)"), []object.Object{})
+	testErrorObject(t, testEval(`repeat("x", "1")`), "second argument to `repeat` must be INTEGER, got STRING")
+	testErrorObject(t, testEval("repeat(1, 1)"), "first argument to `repeat` must be STRING or ARRAY, got INTEGER")
+	testErrorObject(t, testEval(`repeat("x")`), "wrong number of arguments to `repeat`. got=1, want=2")
+}
+
+func TestUnique(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"unique([1, 2, 1, 3, 2, 1])", "[1, 2, 3]"},
+		{`unique(["b", "a", "b", "c", "a"])`, "[b, a, c]"},
+		{`unique([1, "1", 1, "1", true, true, false])`, "[1, 1, true, false]"},
+		{"unique([null, null, 1])", "[null, 1]"},
+		{"unique([])", "[]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if _, ok := evaluated.(*object.Array); !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	mixed := testEval(`unique([1, "1"])`).(*object.Array)
+	if len(mixed.Elements) != 2 || mixed.Elements[0].Type() != object.INTEGER_OBJ ||
+		mixed.Elements[1].Type() != object.STRING_OBJ {
+		t.Errorf("integer and string with the same text should be distinct. got=%+v", mixed.Elements)
+	}
+
+	testIntegerObject(t, testEval("let f = fn() {}; len(unique([f, f, fn() {}]))"), 2)
+
+	testErrorObject(t, testEval(`unique("aa")`), "argument to `unique` must be ARRAY, got STRING")
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"find([1, 5, 10, 15], fn(x) { x > 7 })", 10},
+		{"find([1, 5], fn(x) { x > 7 })", nil},
+		{"find([], fn(x) { true })", nil},
+		{"findIndex([1, 5, 10, 15], fn(x) { x > 7 })", 2},
+		{"findIndex([1, 5], fn(x) { x > 7 })", -1},
+		{"findIndex([], fn(x) { true })", -1},
+		{"find([1, 2], fn(x) { x + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"findIndex([1, 2], fn(x) { x + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"find(1, fn(x) { true })", "first argument to `find` must be ARRAY, got INTEGER"},
+		{"findIndex([1], 1)", "second argument to `findIndex` must be FUNCTION or BUILTIN, got INTEGER"},
+		{"find([1])", "wrong number of arguments to `find`. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"max(3, 5)", 5},
+		{"max(5, 3)", 5},
+		{"max(-1, -1)", -1},
+		{"min(3, 5)", 3},
+		{"min(5, 3)", 3},
+		{`min("apple", "banana")`, "apple"},
+		{`max("apple", "banana")`, "banana"},
+		{"max_of([3, 1, 4, 1, 5, 9])", 9},
+		{"min_of([3, 1, 4, 1, 5, 9])", 1},
+		{"max_of([7])", 7},
+		{`min_of(["pear", "apple", "fig"])`, "apple"},
+		{"max_of([])", nil},
+		{"min_of([])", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`max(1, "a")`, "type mismatch: INTEGER and STRING are not comparable"},
+		{`min("a", 1)`, "type mismatch: STRING and INTEGER are not comparable"},
+		{"max(true, false)", "unable to compare BOOLEAN"},
+		{`max_of([1, 2, "a", true])`, "type mismatch: STRING and INTEGER are not comparable"},
+		{"min_of([true])", "unable to compare BOOLEAN"},
+		{"max_of(1)", "argument to `max_of` must be ARRAY, got INTEGER"},
+		{"max(1)", "wrong number of arguments to `max`. got=1, want=2"},
+		{"min_of()", "wrong number of arguments to `min_of`. got=0, want=1"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAllAny(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"all([2, 4, 6], fn(x) { x > 1 })", true},
+		{"all([2, 0, 6], fn(x) { x > 1 })", false},
+		{"all([], fn(x) { false })", true},
+		{"any([0, 1, 2], fn(x) { x > 1 })", true},
+		{"any([0, 1], fn(x) { x > 1 })", false},
+		{"any([], fn(x) { true })", false},
+		{"all([1, 2], fn(x) { x + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"any([1, 2], fn(x) { x + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"all(1, fn(x) { true })", "first argument to `all` must be ARRAY, got INTEGER"},
+		{"any([], 1)", "second argument to `any` must be FUNCTION or BUILTIN, got INTEGER"},
+		{"all([])", "wrong number of arguments to `all`. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestAllAnyShortCircuit(t *testing.T) {
+	calls := 0
+	env := object.NewEnvironment()
+	env.Set("tick", &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			calls++
+			return args[0]
 		},
-		{
-			`let key = "foo"; {"foo": 5}[key]`,
-			5,
+	})
+
+	testBooleanObject(t, testEvalWithEnv("all([1, 2, 3, 4], fn(x) { tick(x) < 2 })", env), false)
+	if calls != 2 {
+		t.Errorf("`all` didn't stop at the first falsy result. calls=%d, want=2", calls)
+	}
+
+	calls = 0
+	testBooleanObject(t, testEvalWithEnv("any([1, 2, 3, 4], fn(x) { tick(x) > 2 })", env), true)
+	if calls != 3 {
+		t.Errorf("`any` didn't stop at the first truthy result. calls=%d, want=3", calls)
+	}
+}
+
+func TestSumProduct(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"sum([1, 2, 3])", 6},
+		{"sum([])", 0},
+		{"sum([-5, 5, 10])", 10},
+		{"product([1, 2, 3, 4])", 24},
+		{"product([])", 1},
+		{"product([2, 0, 3])", 0},
+		{`sum([1, "two"])`, "element 1 of `sum` must be INTEGER, got STRING"},
+		{"product([1, 2, true])", "element 2 of `product` must be INTEGER, got BOOLEAN"},
+		{`sum("123")`, "argument to `sum` must be ARRAY, got STRING"},
+		{"product([], [])", "wrong number of arguments to `product`. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"apply(fn(a, b) { a - b }, [10, 4])", 6},
+		{"apply(fn() { 1 }, [])", 1},
+		{`apply(len, ["four"])`, 4},
+		{"apply(fn(a, b) { a - b }, [10])", "wrong number of arguments. got=1, want=2"},
+		{"apply(1, [])", "first argument to `apply` must be FUNCTION or BUILTIN, got INTEGER"},
+		{"apply(len, 1)", "second argument to `apply` must be ARRAY, got INTEGER"},
+		{"apply(len)", "wrong number of arguments to `apply`. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestDeleteHasKey(t *testing.T) {
+	evaluated := testEval(`let h = {"a": 1, "b": 2}; [delete(h, "a"), h]`)
+	results, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	deleted := results.Elements[0].(*object.Hash)
+	if len(deleted.Pairs) != 1 {
+		t.Errorf("deleted hash has wrong num of pairs. got=%d", len(deleted.Pairs))
+	}
+	if pair, ok := deleted.Pairs[(&object.String{Value: "b"}).HashKey()]; !ok {
+		t.Errorf("deleted hash lost key b")
+	} else {
+		testIntegerObject(t, pair.Value, 2)
+	}
+
+	original := results.Elements[1].(*object.Hash)
+	if len(original.Pairs) != 2 {
+		t.Errorf("original hash was mutated. got=%d pairs", len(original.Pairs))
+	}
+
+	testBooleanObject(t, testEval(`let h = {"a": 1}; delete(h, "z") == h`), true)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`has_key({"x": 1}, "x")`, true},
+		{`has_key({}, "x")`, false},
+		{`has_key({1: null}, 1)`, true},
+		{`has_key(delete({"x": 1}, "x"), "x")`, false},
+		{`delete([], "x")`, "first argument to `delete` must be HASH, got ARRAY"},
+		{`delete({}, [])`, "unusable as hash key: ARRAY"},
+		{`has_key(1, "x")`, "first argument to `has_key` must be HASH, got INTEGER"},
+		{`has_key({})`, "wrong number of arguments to `has_key`. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestComposePipe(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; compose(inc, double)(5)", 11},
+		{"let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; compose(double, inc)(5)", 12},
+		{"let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; pipe(inc, double)(5)", 12},
+		{"let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; pipe(double, inc)(5)", 11},
+		{"let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; pipe(inc, double, inc)(5)", 13},
+		{"let add = fn(a, b) { a + b }; let double = fn(x) { x * 2 }; pipe(add, double)(1, 2)", 6},
+		{`compose(len, fn(s) { s + "!" })("hi")`, 3},
+		{"pipe(fn(x) { x + true }, fn(x) { x })(1)", "type mismatch: INTEGER + BOOLEAN"},
+		{"compose(fn(x) { x }, 1)", "arguments to `compose` must be FUNCTION or BUILTIN, got INTEGER"},
+		{"pipe(len)", "wrong number of arguments to `pipe`. got=1, want at least 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`get({"a": 1}, "a", 0)`, 1},
+		{`get({"a": 1}, "b", 0)`, 0},
+		{`get({"a": null}, "a", 0)`, nil},
+		{`get({"a": 1}, "a")`, 1},
+		{`get({"a": 1}, "b")`, nil},
+		{`get({1: 2}, 1, 0)`, 2},
+		{`get([], "a", 0)`, "first argument to `get` must be HASH, got ARRAY"},
+		{`get({}, fn() {}, 0)`, "unusable as hash key: FUNCTION"},
+		{`get({})`, "wrong number of arguments to `get`. got=1, want=2 or 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected map[string]int64
+	}{
+		{`merge({"a": 1}, {"b": 2})`, map[string]int64{"a": 1, "b": 2}},
+		{`merge({"a": 1}, {"a": 2})`, map[string]int64{"a": 2}},
+		{`merge({}, {})`, map[string]int64{}},
+		{`merge({"a": 1, "b": 1}, {"b": 2, "c": 2}, {"c": 3})`, map[string]int64{"a": 1, "b": 2, "c": 3}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		hash, ok := evaluated.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if len(hash.Pairs) != len(tt.expected) {
+			t.Errorf("hash has wrong num of pairs. got=%d, want=%d", len(hash.Pairs), len(tt.expected))
+		}
+
+		for key, value := range tt.expected {
+			pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+			if !ok {
+				t.Errorf("no pair for key %q in %s", key, tt.input)
+				continue
+			}
+			testIntegerObject(t, pair.Value, value)
+		}
+	}
+
+	testIntegerObject(t, testEval(`let h = {"a": 1}; merge(h, {"a": 2}); h["a"]`), 1)
+
+	testErrorObject(t, testEval(`merge({}, [])`), "arguments to `merge` must be HASH, got ARRAY")
+	testErrorObject(t, testEval(`merge({})`), "wrong number of arguments to `merge`. got=1, want at least 2")
+}
+
+func TestCurry(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let addFive = curry(fn(a, b) { a + b }, 5); addFive(3) == 8", true},
+		{"let add = fn(a, b) { a + b }; curry(add) == add", true},
+		{"let add = fn(a, b, c) { a + b + c }; curry(curry(add, 1), 2)(3)", 6},
+		{"curry(len, \"four\")()", 4},
+		{"curry(fn(a, b) { a + b }, 1, 2, 3)", 3},
+		{"curry(1, 2)", "first argument to `curry` must be FUNCTION or BUILTIN, got INTEGER"},
+		{"curry()", "wrong number of arguments to `curry`. got=0, want at least 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+
+	curriedPush := testEval("curry(push, [1])(2)")
+	testArrayObject(t, curriedPush, []object.Object{
+		&object.Integer{Value: 1},
+		&object.Integer{Value: 2},
+	})
+}
+
+func TestTimeBuiltins(t *testing.T) {
+	for _, name := range []string{"now", "clock"} {
+		evaluated := testEval("[" + name + "(), " + name + "()]")
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		first, ok := arr.Elements[0].(*object.Integer)
+		if !ok {
+			t.Fatalf("`%s` didn't return Integer. got=%T (%+v)", name, arr.Elements[0], arr.Elements[0])
+		}
+		second, ok := arr.Elements[1].(*object.Integer)
+		if !ok {
+			t.Fatalf("`%s` didn't return Integer. got=%T (%+v)", name, arr.Elements[1], arr.Elements[1])
+		}
+
+		if second.Value < first.Value {
+			t.Errorf("`%s` went backwards. first=%d, second=%d", name, first.Value, second.Value)
+		}
+
+		testErrorObject(t, testEval(name+"(1)"), "wrong number of arguments to `"+name+"`. got=1, want=0")
+	}
+}
+
+func TestOnce(t *testing.T) {
+	calls := 0
+	env := object.NewEnvironment()
+	env.Set("tick", &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			calls++
+			return NULL
 		},
-		{
-			`{}["foo"]`,
-			nil,
+	})
+
+	testEvalWithEnv("let init = once(fn(x) { tick(); x * 2 });", env)
+
+	testIntegerObject(t, testEvalWithEnv("init(1)", env), 2)
+	testIntegerObject(t, testEvalWithEnv("init(5)", env), 2)
+	testIntegerObject(t, testEvalWithEnv("init()", env), 2)
+
+	if calls != 1 {
+		t.Errorf("function called wrong number of times. got=%d, want=1", calls)
+	}
+
+	testErrorObject(t, testEval("once(1)"), "argument to `once` must be FUNCTION or BUILTIN, got INTEGER")
+	testErrorObject(t, testEval("once()"), "wrong number of arguments to `once`. got=0, want=1")
+
+	// a recursive call can't wait for the first call to finish, it fails instead of deadlocking
+	testErrorObject(t, testEval("let f = once(fn() { f() }); f()"),
+		"function passed to `once` was called again before its first call returned")
+
+	if name := testEval("once(len)").(*object.Builtin).Name; name != "once" {
+		t.Errorf("wrong builtin name. got=%q, want=%q", name, "once")
+	}
+}
+
+func TestOnceDoesNotCacheErrors(t *testing.T) {
+	calls := 0
+	env := object.NewEnvironment()
+	env.Set("flaky", &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			calls++
+			if calls == 1 {
+				return newError("flaky failure")
+			}
+			return &object.Integer{Value: int64(calls)}
 		},
-		{
-			`{5: 5}[5]`,
-			5,
+	})
+
+	testEvalWithEnv("let initFlaky = once(flaky);", env)
+
+	testErrorObject(t, testEvalWithEnv("initFlaky()", env), "flaky failure")
+	testIntegerObject(t, testEvalWithEnv("initFlaky()", env), 2)
+	testIntegerObject(t, testEvalWithEnv("initFlaky()", env), 2)
+
+	if calls != 2 {
+		t.Errorf("wrapped function called wrong number of times. got=%d, want=2", calls)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	start := time.Now()
+	testNullObject(t, testEval("sleep(5)"))
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("sleep returned too early. elapsed=%s", elapsed)
+	}
+
+	testNullObject(t, testEval("sleep(0)"))
+	testErrorObject(t, testEval("sleep(-1)"), "argument to `sleep` must not be negative, got -1")
+	testErrorObject(t, testEval("sleep(9223372036854775807)"),
+		"argument to `sleep` is too large, got 9223372036854775807")
+	testErrorObject(t, testEval(`sleep("1")`), "argument to `sleep` must be INTEGER, got STRING")
+	testErrorObject(t, testEval("sleep()"), "wrong number of arguments to `sleep`. got=0, want=1")
+}
+
+func TestRandomBuiltins(t *testing.T) {
+	input := "seed(42); [rand(), rand(10), rand(10), rand(1000)]"
+
+	first, ok := testEval(input).(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T", first)
+	}
+	second := testEval(input)
+
+	testArrayObject(t, second, first.Elements)
+
+	for _, el := range first.Elements[1:3] {
+		n, ok := el.(*object.Integer)
+		if !ok {
+			t.Fatalf("object is not Integer. got=%T (%+v)", el, el)
+		}
+		if n.Value < 0 || n.Value >= 10 {
+			t.Errorf("rand(10) out of range. got=%d", n.Value)
+		}
+	}
+
+	testErrorObject(t, testEval("rand(0)"), "argument to `rand` must be greater than 0, got 0")
+	testErrorObject(t, testEval(`rand("10")`), "argument to `rand` must be INTEGER, got STRING")
+	testErrorObject(t, testEval("rand(1, 2)"), "wrong number of arguments to `rand`. got=2, want=0 or 1")
+	testErrorObject(t, testEval("seed()"), "wrong number of arguments to `seed`. got=0, want=1")
+	testErrorObject(t, testEval("seed(true)"), "argument to `seed` must be INTEGER, got BOOLEAN")
+}
+
+func TestSeedIsPerInterpreter(t *testing.T) {
+	eval := func(in *Interpreter, input string) object.Object {
+		return in.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	}
+
+	expected := eval(New(), "seed(42); rand()")
+
+	// reseeding another interpreter in between doesn't change what the first one draws next
+	first, second := New(), New()
+	eval(first, "seed(42)")
+	eval(second, "seed(7)")
+
+	testIntegerObject(t, eval(first, "rand()"), expected.(*object.Integer).Value)
+}
+
+func TestMemoize(t *testing.T) {
+	calls := 0
+	env := object.NewEnvironment()
+	env.Set("tick", &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			calls++
+			return NULL
 		},
-		{
-			`{true: 5}[true]`,
-			5,
+	})
+
+	input := `
+let fib = memoize(fn(n) {
+	tick();
+	if (n < 2) { n } else { fib(n - 1) + fib(n - 2) }
+});
+fib(30);`
+
+	testIntegerObject(t, testEvalWithEnv(input, env), 832040)
+
+	if calls != 31 {
+		t.Errorf("memoized function called wrong number of times. got=%d, want=31", calls)
+	}
+
+	testIntegerObject(t, testEvalWithEnv("fib(30)", env), 832040)
+
+	if calls != 31 {
+		t.Errorf("memoized function called again for cached args. got=%d, want=31", calls)
+	}
+}
+
+func TestMemoizeKeysByType(t *testing.T) {
+	input := `
+let describe = memoize(fn(x) { if (x == 1) { "integer" } else { "other" } });
+[describe(1), describe("1"), describe(1)]`
+
+	testArrayObject(t, testEval(input), []object.Object{
+		&object.String{Value: "integer"},
+		&object.String{Value: "other"},
+		&object.String{Value: "integer"},
+	})
+}
+
+func TestMemoizeKeysAreUnambiguous(t *testing.T) {
+	// a single argument looking like several mustn't hit the cache entry of the call that had several
+	input := `
+let first = memoize(fn(a, b) { a });
+first("x", "y");
+first("x,STRING:y")`
+
+	testErrorObject(t, testEval(input), "wrong number of arguments. got=1, want=2")
+}
+
+func TestMemoizeSkipsUnhashableArguments(t *testing.T) {
+	calls := 0
+	env := object.NewEnvironment()
+	env.Set("tick", &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			calls++
+			return NULL
 		},
-		{
-			`{false: 5}[false]`,
-			5,
+	})
+
+	input := `
+let total = memoize(fn(xs) { tick(); sum(xs) });
+total([1, 2]);
+total([1, 2])`
+
+	testIntegerObject(t, testEvalWithEnv(input, env), 3)
+
+	if calls != 2 {
+		t.Errorf("memoized function called wrong number of times. got=%d, want=2", calls)
+	}
+}
+
+func TestMemoizeDoesNotCacheErrors(t *testing.T) {
+	calls := 0
+	env := object.NewEnvironment()
+	env.Set("flaky", &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			calls++
+			if calls == 1 {
+				return newError("flaky failure")
+			}
+			return &object.Integer{Value: 42}
 		},
+	})
+
+	testEvalWithEnv("let memoFlaky = memoize(flaky);", env)
+
+	testErrorObject(t, testEvalWithEnv("memoFlaky(1)", env), "flaky failure")
+	testIntegerObject(t, testEvalWithEnv("memoFlaky(1)", env), 42)
+	testIntegerObject(t, testEvalWithEnv("memoFlaky(1)", env), 42)
+
+	if calls != 2 {
+		t.Errorf("wrapped function called wrong number of times. got=%d, want=2", calls)
+	}
+
+	testErrorObject(t, testEval("memoize(1)"), "argument to `memoize` must be FUNCTION or BUILTIN, got INTEGER")
+}
+
+func TestStd(t *testing.T) {
+	data, err := os.ReadFile("../std/std.monkey")
+	if err != nil {
+		t.Error(err)
+	}
+
+	input := string(data)
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	Eval(program, env)
+
+	funcs := []string{
+		"first",
+		"last",
+		"rest",
+		"map",
+		"reduce",
+	}
+
+	for _, fnName := range funcs {
+		fn, ok := env.Get(fnName)
+		if !ok {
+			t.Errorf("std function `%s` not found", fnName)
+			return
+		}
+		if _, ok := fn.(*object.Function); !ok {
+			t.Errorf("std function `%s` not a Function, got=%T (%+v)", fnName, fn, fn)
+			return
+		}
+	}
+
+	// sum is a builtin, a std definition would shadow it
+	if _, ok := env.Get("sum"); ok {
+		t.Errorf("std shouldn't define `sum`")
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "math.monkey", `
+		export let square = fn(x) { x * x };
+		export let add = fn(a, b) { a + b };
+		export let answer = add(square(6), 6);
+	`)
+	writeModule(t, dir, "lib/geometry.monkey", `
+		import "../math.monkey";
+		export let area = fn(side) { math.square(side) };
+	`)
+	writeModule(t, dir, "vec2.monkey", `export let dims = 2;`)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "math.monkey"; math.add(1, 2)`, 3},
+		{`import "math.monkey"; math.answer`, 42},
+		{`import "math.monkey"; let sq = math.square; sq(5)`, 25},
+		{`import "math.monkey"; [1, 2, 3].len() + math.square(2)`, 7},
+		{`import "lib/geometry.monkey"; geometry.area(4)`, 16},
+		{`import "math.monkey"; let m = math; import "math.monkey"; m == math`, true},
+		{`import "math.monkey"; math.nope`, "module math has no binding nope"},
+		{`import "math.monkey"; math.nope(1)`, "module math has no binding nope"},
+		{`import "missing-module.monkey"`, `cannot import "missing-module.monkey": "missing-module" isn't a valid name`},
+		{`import "vec2.monkey"; vec2.dims`, 2},
+		{`import "2d.monkey"`, `cannot import "2d.monkey": "2d" isn't a valid name`},
+	}
+
+	chdir(t, dir)
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "first.monkey", `import "second.monkey"; let value = 1;`)
+	writeModule(t, dir, "second.monkey", `import "first.monkey"; let value = 2;`)
+	writeModule(t, dir, "itself.monkey", `import "itself.monkey";`)
+	writeModule(t, dir, "broken.monkey", `let = 1;`)
+	writeModule(t, dir, "failing.monkey", `let value = 1 + true;`)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "first.monkey"`, "circular import: first.monkey -> second.monkey -> first.monkey"},
+		{`import "itself.monkey"`, "circular import: itself.monkey -> itself.monkey"},
+		{`import "broken.monkey"`, "cannot import \"" + filepath.Join(dir, "broken.monkey") + "\", it has parser errors: "},
+		{`import "failing.monkey"`, "type mismatch: INTEGER + BOOLEAN"},
+		{`import "absent.monkey"`, "cannot import \"" + filepath.Join(dir, "absent.monkey") + "\": "},
+	}
+
+	chdir(t, dir)
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q - no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if !strings.HasPrefix(errObj.Message, tt.expected) {
+			t.Errorf("input %q - wrong error message. expected prefix=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestImportEvaluatesModuleOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "counter.monkey", `export let count = 0;`)
+	writeModule(t, dir, "bump.monkey", `import "counter.monkey"; let bumped = counter.count;`)
+
+	chdir(t, dir)
+
+	evaluated := testEval(`
+		import "counter.monkey";
+		let first = counter;
+		import "bump.monkey";
+		import "counter.monkey";
+		first == counter
+	`)
+
+	testBooleanObject(t, evaluated, true)
+}
+
+func TestImportCachePerInterpreter(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "config.monkey", `export let value = 1;`)
+
+	chdir(t, dir)
+
+	program := parser.New(lexer.New(`import "config.monkey"; config.value`)).ParseProgram()
+	in := New()
+	testIntegerObject(t, in.Eval(program, object.NewEnvironment()), 1)
+
+	// the interpreter keeps the module it already evaluated, another one reads the file again
+	writeModule(t, dir, "config.monkey", `export let value = 2;`)
+	testIntegerObject(t, in.Eval(program, object.NewEnvironment()), 1)
+	testIntegerObject(t, New().Eval(program, object.NewEnvironment()), 2)
+}
+
+func TestEvalContextCancelsRunawayPrograms(t *testing.T) {
+	tests := []string{
+		"loop {}",
+		"while (true) { 1 }",
+		"let i = 0; do { i++ } while (i > 0)",
+		"let f = fn() { 1 }; loop { f() }",
+		"let f = fn() { loop {} }; f()",
+		"sleep(1000000000)",
+	}
+
+	for _, input := range tests {
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		done := make(chan object.Object)
+		go func() {
+			done <- EvalContext(ctx, program, object.NewEnvironment())
+		}()
+
+		select {
+		case evaluated := <-done:
+			testErrorObject(t, evaluated, "evaluation cancelled: context deadline exceeded")
+		case <-time.After(5 * time.Second):
+			t.Fatalf("input %q - evaluation didn't stop after the deadline", input)
+		}
+
+		cancel()
+	}
+}
+
+func TestEvalContextAlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	program := parser.New(lexer.New("let add = fn(a, b) { a + b }; add(1, 2)")).ParseProgram()
+	testErrorObject(t, EvalContext(ctx, program, object.NewEnvironment()), "evaluation cancelled: context canceled")
+
+	// the cancelled context only applies to its own EvalContext call
+	testIntegerObject(t, Eval(program, object.NewEnvironment()), 3)
+	testIntegerObject(t, EvalContext(context.Background(), program, object.NewEnvironment()), 3)
+}
+
+func TestEvalContextConcurrently(t *testing.T) {
+	// a runaway program being cancelled doesn't stop one evaluated at the same time with another context
+	runaway := parser.New(lexer.New("loop {}")).ParseProgram()
+	program := parser.New(lexer.New("let i = 0; let sum = 0; while (i < 20000) { i++; sum = sum + i }; sum")).ParseProgram()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan object.Object)
+	go func() {
+		done <- EvalContext(ctx, runaway, object.NewEnvironment())
+	}()
+
+	testIntegerObject(t, EvalContext(context.Background(), program, object.NewEnvironment()), 200010000)
+
+	cancel()
+	testErrorObject(t, <-done, "evaluation cancelled: context canceled")
+}
+
+func TestEvalWithStepLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		limit    int
+		expected interface{}
+	}{
+		// the program, the expression statement, the infix expression and both integers
+		{"1 + 2", 5, 3},
+		{"1 + 2", 4, "step limit exceeded"},
+		{"1 + 2", 0, 3},
+		{"loop {}", 1000, "step limit exceeded"},
+		{"let i = 0; while (true) { i++ }", 1000, "step limit exceeded"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", 1000, "step limit exceeded"},
+		{"let i = 0; while (i < 10) { i++ }; i", 1000, 10},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithStepLimit(program, object.NewEnvironment(), tt.limit)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+
+	// the limit only applies to its own EvalWithStepLimit call
+	testIntegerObject(t, testEval("let i = 0; while (i < 1000) { i++ }; i"), 1000)
+
+	// an interpreter applies its limit to each evaluation separately
+	in := New(WithStepLimit(5))
+	program := parser.New(lexer.New("1 + 2")).ParseProgram()
+	testIntegerObject(t, in.Eval(program, object.NewEnvironment()), 3)
+	testIntegerObject(t, in.Eval(program, object.NewEnvironment()), 3)
+}
+
+func TestFileBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`writeFile("` + path + `", "hello")`, nil},
+		{`readFile("` + path + `")`, "hello"},
+		{`writeFile("` + path + `", "bye"); readFile("` + path + `")`, "bye"},
+		{`readFile(1)`, errorMessage("argument to `readFile` must be STRING, got INTEGER")},
+		{`writeFile("` + path + `", 1)`, errorMessage("second argument to `writeFile` must be STRING, got INTEGER")},
+		{`readFile("` + filepath.Join(dir, "missing") + `")`, errorMessage("open " + filepath.Join(dir, "missing") + ": no such file or directory")},
+		{`exit("now")`, errorMessage("argument to `exit` must be INTEGER, got STRING")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestEvalSandboxed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	writeModule(t, dir, "secret.txt", "top secret")
+	writeModule(t, dir, "lib.monkey", "export let x = 1;")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`readFile("` + path + `")`, errorMessage("operation not permitted in sandbox")},
+		{`writeFile("` + path + `", "gone")`, errorMessage("operation not permitted in sandbox")},
+		{`exit(0)`, errorMessage("operation not permitted in sandbox")},
+		{`eval("1 + 2")`, errorMessage("operation not permitted in sandbox")},
+		{`let read = readFile; read("` + path + `")`, errorMessage("operation not permitted in sandbox")},
+		{`apply(readFile, ["` + path + `"])`, errorMessage("operation not permitted in sandbox")},
+		{`let get = fn() { readFile }; get()("` + path + `")`, errorMessage("operation not permitted in sandbox")},
+		{`let e = eval; e("1 + 2")`, errorMessage("operation not permitted in sandbox")},
+		{`import "lib.monkey"`, errorMessage("operation not permitted in sandbox")},
+		{`len("still fine")`, 10},
+	}
+
+	chdir(t, dir)
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalSandboxed(program, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+
+	// the file is untouched and outside of the sandbox the builtins work as usual
+	testStringObject(t, testEval(`readFile("`+path+`")`), "top secret")
+
+	// a builtin bound before sandboxing, by another interpreter, is still recognized
+	env := object.NewEnvironment()
+	testEvalWithEnv(`let read = readFile; let e = eval;`, env)
+	for _, input := range []string{`read("` + path + `")`, `e("1")`} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		testErrorObject(t, EvalSandboxed(program, env), "operation not permitted in sandbox")
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// construction drops duplicates
+		{"len(set([1, 2, 2, 3, 1]))", 3},
+		{"len(set())", 0},
+		{"set([1, 2]) == set([2, 1, 1])", true},
+		{"set([1, 2]) != set([1])", true},
+		// membership
+		{"setHas(set([1, 2]), 2)", true},
+		{`setHas(set([1, 2]), "2")`, false},
+		{"let s = set([1]); setHas(setAdd(s, 5), 5)", true},
+		{"let s = set([1]); let t = setAdd(s, 5); setHas(s, 5)", false},
+		{"setHas(setRemove(set([1, 2]), 1), 1)", false},
+		{"setRemove(set([1, 2]), 3) == set([1, 2])", true},
+		// set algebra
+		{"union(set([1, 2]), set([2, 3])) == set([1, 2, 3])", true},
+		{"intersection(set([1, 2, 3]), set([2, 3, 4])) == set([2, 3])", true},
+		{"difference(set([1, 2, 3]), set([2, 4])) == set([1, 3])", true},
+		{"intersection(set([1]), set([2])) == set()", true},
+		// errors
+		{"set([[1]])", "unusable as set element: ARRAY"},
+		{"setAdd(set(), {})", "unusable as set element: HASH"},
+		{"set(1)", "argument to `set` must be ARRAY, got INTEGER"},
+		{"setHas([1], 1)", "first argument to `setHas` must be SET, got ARRAY"},
+		{"union(set(), [1])", "arguments to `union` must be SET, got ARRAY"},
+		{"difference(set())", "wrong number of arguments to `difference`. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+
+	if actual := testEval(`set([3, "a", 1, 3, true])`).Inspect(); actual != "set([true, 1, 3, a])" {
+		t.Errorf("wrong Inspect. expected=%q, got=%q", "set([true, 1, 3, a])", actual)
+	}
+}
+
+func TestQueuesAndStacks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type(queue()) == "QUEUE"`, true},
+		{`type(stack()) == "STACK"`, true},
+		// queues are first in, first out
+		{"let q = enqueue(enqueue(enqueue(queue(), 1), 2), 3); dequeue(q)[0]", 1},
+		{"let q = enqueue(enqueue(enqueue(queue(), 1), 2), 3); dequeue(dequeue(q)[1])[0]", 2},
+		{"let q = enqueue(enqueue(queue(), 1), 2); let r = dequeue(dequeue(q)[1])[1]; len(r)", 0},
+		{"let q = enqueue(queue(), 1); let r = enqueue(q, 2); len(q)", 1},
+		{"enqueue(enqueue(queue(), 1), 2) == enqueue(enqueue(queue(), 1), 2)", true},
+		// stacks are last in, first out
+		{"let s = push_stack(push_stack(push_stack(stack(), 1), 2), 3); pop_stack(s)[0]", 3},
+		{"let s = push_stack(push_stack(push_stack(stack(), 1), 2), 3); pop_stack(pop_stack(s)[1])[0]", 2},
+		{"let s = push_stack(stack(), 1); let t = pop_stack(s); len(s)", 1},
+		// popping then pushing doesn't overwrite what the original stack holds
+		{"let s = push_stack(push_stack(stack(), 1), 2); let t = push_stack(pop_stack(s)[1], 3); pop_stack(s)[0]", 2},
+		// errors
+		{"dequeue(queue())", "cannot dequeue from an empty queue"},
+		{"pop_stack(stack())", "cannot pop from an empty stack"},
+		{"enqueue([], 1)", "first argument to `enqueue` must be QUEUE, got ARRAY"},
+		{"dequeue(stack())", "argument to `dequeue` must be QUEUE, got STACK"},
+		{"push_stack(queue(), 1)", "first argument to `push_stack` must be STACK, got QUEUE"},
+		{"pop_stack(1)", "argument to `pop_stack` must be STACK, got INTEGER"},
+		{"queue(1)", "wrong number of arguments to `queue`. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+
+	testStringObject(t, testEval("type(1)"), "INTEGER")
+	if actual := testEval("enqueue(enqueue(queue(), 1), 2)").Inspect(); actual != "queue([1, 2])" {
+		t.Errorf("wrong Inspect. expected=%q, got=%q", "queue([1, 2])", actual)
+	}
+	if actual := testEval("push_stack(push_stack(stack(), 1), 2)").Inspect(); actual != "stack([1, 2])" {
+		t.Errorf("wrong Inspect. expected=%q, got=%q", "stack([1, 2])", actual)
+	}
+}
+
+func TestStringBuilder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`builderString(builderNew())`, ""},
+		{`let b = builderNew(); builderAppend(b, "ab"); builderAppend(b, "c"); builderString(b)`, "abc"},
+		{`builderString(builderAppend(builderAppend(builderNew(), "n: "), 1))`, "n: 1"},
+		{`let b = builderNew(); for i in 0:5 { builderAppend(b, i) }; builderString(b)`, "01234"},
+		// appending changes the builder itself, the strings taken from it before don't change
+		{`let b = builderNew(); builderAppend(b, "a"); let s = builderString(b); builderAppend(b, "b"); s`, "a"},
+		{`let b = builderNew(); b == b`, true},
+		{`builderNew() == builderNew()`, false},
+		{`{builderNew(): 1}`, "unusable as hash key: STRING_BUILDER"},
+		{`builderAppend("a", "b")`, "first argument to `builderAppend` must be STRING_BUILDER, got STRING"},
+		{`builderString("a")`, "argument to `builderString` must be STRING_BUILDER, got STRING"},
+		{`builderNew(1)`, "wrong number of arguments to `builderNew`. got=1, want=0"},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
 
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
-			testNullObject(t, evaluated)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if _, ok := evaluated.(*object.Error); ok {
+				testErrorObject(t, evaluated, expected)
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
 		}
 	}
 }
 
-func testArrayObject(t *testing.T, obj object.Object, expected []object.Object) bool {
-	result, ok := obj.(*object.Array)
-	if !ok {
-		t.Errorf("object is not Array. got=%T (%+v)", obj, obj)
-		return false
+func BenchmarkStringConcatenation(b *testing.B) {
+	program := parser.New(lexer.New(`let s = ""; for i in 0:10000 { s = s + "x" }; s`)).ParseProgram()
+
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
 	}
+}
 
-	actual := result.Elements
+func BenchmarkStringBuilder(b *testing.B) {
+	program := parser.New(lexer.New(`let sb = builderNew(); for i in 0:10000 { builderAppend(sb, "x") }; builderString(sb)`)).ParseProgram()
 
-	if len(actual) != len(expected) {
-		t.Errorf("array has the wrong len. got=%d, want=%d",
-			len(actual), len(expected))
-		return false
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
 	}
+}
 
-	for i := range actual {
-		if (actual[i].Type() != expected[i].Type()) ||
-			(actual[i].Inspect() != expected[i].Inspect()) {
-			t.Errorf("element is not expected. got=%v, want=%v",
-				actual[i], expected[i])
-			return false
+func TestLazyIterators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for x in lazyRange(0, 5) { sum = sum + x }; sum", 10},
+		{"let sum = 0; for x in lazyRange(10, 0, -3) { sum = sum * 100 + x }; sum", 10070401},
+		{"let out = []; for i, x in lazyRange(5, 8) { out = push(out, i * 10 + x) }; out == [5, 16, 27]", true},
+		{"let out = []; for x in lazyMap([1, 2, 3], fn(x) { x * x }) { out = push(out, x) }; out == [1, 4, 9]", true},
+		{"let out = []; for x in lazyFilter(lazyRange(0, 10), fn(x) { x / 3 * 3 == x }) { out = push(out, x) }; out == [0, 3, 6, 9]", true},
+		{`let out = ""; for c in lazyMap("abc", upper) { out = out + c }; out`, "ABC"},
+		{"let it = lazyRange(0, 2); [next(it), it.next(), next(it)] == [0, 1, null]", true},
+		// iterators are used up as they're consumed
+		{"let it = lazyRange(0, 3); for x in it { }; next(it)", nil},
+		// stepping past the end near the int64 limits doesn't wrap around
+		{"let n = 0; for x in lazyRange(9223372036854775806, 9223372036854775807, 2) { n++ }; n", 1},
+		{"let out = []; for x in lazyRange(9223372036854775805, 9223372036854775807, 1) { out = push(out, x - 9223372036854775800) }; out == [5, 6]", true},
+		{"let n = 0; for x in lazyRange(-9223372036854775807, -9223372036854775807 - 1, -5) { n++ }; n", 1},
+		{"let n = 0; for x in lazyRange(-9223372036854775807 - 1, 9223372036854775807, 9223372036854775807) { n++ }; n", 3},
+		{"lazyRange(0, 1, 0)", "step of `lazyRange` must not be 0"},
+		{`lazyRange(0, "a")`, "arguments to `lazyRange` must be INTEGER, got STRING"},
+		{"lazyMap(5, fn(x) { x })", "cannot iterate over INTEGER"},
+		{"lazyFilter([1], 1)", "second argument to `lazyFilter` must be FUNCTION or BUILTIN, got INTEGER"},
+		{"next([1])", "argument to `next` must be ITERATOR, got ARRAY"},
+		// errors in the transform stop the loop consuming the iterator
+		{"for x in lazyMap([1, true], fn(x) { -x }) { x }", "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if _, ok := evaluated.(*object.Error); ok {
+				testErrorObject(t, evaluated, expected)
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
+		case nil:
+			testNullObject(t, evaluated)
 		}
 	}
+}
 
-	return true
+func TestLazyIteratorsProduceValuesOnDemand(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedCalls int64
+	}{
+		// nothing is transformed until it's asked for
+		{"let it = lazyMap(lazyRange(0, 1000000000), double); calls", 0},
+		{"let it = lazyMap(lazyRange(0, 1000000000), double); next(it); next(it); calls", 2},
+		{"for x in lazyMap(lazyRange(0, 1000000000), double) { if (x > 6) { break } }; calls", 5},
+		{"let it = lazyFilter(lazyMap(lazyRange(0, 1000000000), double), fn(x) { x > 10 }); next(it); calls", 7},
+	}
+
+	for _, tt := range tests {
+		input := "let calls = 0; let double = fn(x) { calls = calls + 1; x * 2 }; " + tt.input
+		testIntegerObject(t, testEval(input), tt.expectedCalls)
+	}
 }
 
-func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
-		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
-		return false
+func TestCompositionOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(x) { x * 2 } >> fn(x) { x + 1 }; f(3) == 7", true},
+		{"let f = fn(x) { x * 2 } << fn(x) { x + 1 }; f(3) == 8", true},
+		{"let double = fn(x) { x * 2 }; let inc = fn(x) { x + 1 }; let doubleThenInc = double >> inc; doubleThenInc(5)", 11},
+		{"let add = fn(a, b) { a + b }; (add >> fn(x) { x * 10 })(1, 2)", 30},
+		{`(len >> fn(n) { n + 1 })("abc")`, 4},
+		{"let inc = fn(x) { x + 1 }; (inc >> inc << inc)(0)", 3},
+		{"4 |> fn(x) { x * 2 } >> fn(x) { x - 1 }", 7},
+		{"let f = fn(x) { x }; f >> 1", "type mismatch: FUNCTION >> INTEGER"},
+		{"let f = fn(x) { x }; 1 << f", "type mismatch: INTEGER << FUNCTION"},
+		{"1 >> 2", "unknown operator: INTEGER >> INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
 	}
-	return true
 }
 
-func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
-	result, ok := obj.(*object.Boolean)
+func TestErrorWrapping(t *testing.T) {
+	// the errors evaluation fails with stop it as soon as they're produced, so they're handed to the builtins directly
+	// rather than through source, error values made by `error` are covered by TestErrorValues
+	builtins := New().builtins
+	wrap, unwrap := builtins["wrap_error"].Fn, builtins["unwrap_error"].Fn
+	inner := &object.Error{Message: "inner"}
+
+	wrapped, ok := wrap(inner, &object.String{Value: "outer"}).(*object.Error)
 	if !ok {
-		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
-		return false
+		t.Fatalf("wrap_error didn't return an Error")
+	}
+	if wrapped.Message != "outer: inner" {
+		t.Errorf("wrong message. expected=%q, got=%q", "outer: inner", wrapped.Message)
+	}
+	if wrapped.Inspect() != "ERROR: outer: inner\ncaused by: inner" {
+		t.Errorf("wrong Inspect. got=%q", wrapped.Inspect())
 	}
 
-	if result.Value != expected {
-		t.Errorf("object has wrong value. got=%t, want=%t",
-			result.Value, expected)
-		return false
+	unwrapped, ok := unwrap(wrapped).(*object.Error)
+	if !ok || unwrapped != inner || unwrapped.Message != "inner" {
+		t.Errorf("unwrap_error didn't return the wrapped error. got=%+v", unwrapped)
 	}
+	testNullObject(t, unwrap(&object.Error{Message: "bare"}))
 
-	return true
+	twice := wrap(wrapped, &object.String{Value: "top"}).(*object.Error)
+	if twice.Message != "top: outer: inner" || twice.Wrapped != wrapped {
+		t.Errorf("wrong double wrap. got=%+v", twice)
+	}
+
+	testErrorObject(t, testEval(`wrap_error(1, "outer")`), "first argument to `wrap_error` must be ERROR, got INTEGER")
+	testErrorObject(t, wrap(inner, &object.Integer{Value: 1}), "second argument to `wrap_error` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`unwrap_error("bare")`), "argument to `unwrap_error` must be ERROR, got STRING")
+	testErrorObject(t, testEval(`unwrap_error()`), "wrong number of arguments to `unwrap_error`. got=0, want=1")
 }
 
-func TestBuiltinFunctions(t *testing.T) {
+func TestErrorValues(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`unwrap_error(wrap_error(error("inner"), "outer")).Message == "inner"`, true},
+		{`wrap_error(error("inner"), "outer").Message`, "outer: inner"},
+		{`unwrap_error(error("bare")) == null`, true},
+		{`let err = error("boom"); let f = fn(e) { e.Message }; f(err)`, "boom"},
+		{`[error("a"), error("b")].len()`, 2},
+		{`error("boom"); 1`, 1},
+		{`error(1)`, errorMessage("argument to `error` must be STRING, got INTEGER")},
+		{`wrap_error("bare", "outer")`, errorMessage("first argument to `wrap_error` must be ERROR, got STRING")},
 	}
 
 	for _, tt := range tests {
@@ -555,63 +3303,282 @@ func TestBuiltinFunctions(t *testing.T) {
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
 		case string:
-			errObj, ok := evaluated.(*object.Error)
-			if !ok {
-				t.Errorf("object is not Error. got=%T (%+v)",
-					evaluated, evaluated)
-				continue
-			}
-			if errObj.Message != expected {
-				t.Errorf("wrong error message. expected=%q, got=%q",
-					expected, errObj.Message)
-			}
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
 		}
 	}
+
+	// an error value is a program's result rather than it failing
+	program := parser.New(lexer.New(`error("boom")`)).ParseProgram()
+	if _, err := Run(program, object.NewEnvironment()); err != nil {
+		t.Errorf("expected an error value not to fail Run, got=%v", err)
+	}
 }
 
-func TestStd(t *testing.T) {
-	data, err := os.ReadFile("../std/std.monkey")
-	if err != nil {
-		t.Error(err)
+func TestEvalBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`eval("1 + 2") == 3`, true},
+		{`eval("let x = 10; x * 2") == 20`, true},
+		{`eval("")`, nil},
+		{`let src = "fn(x) { x * " + 3 + " }"; eval(src)(4)`, 12},
+		// direct calls run in the caller's environment, both reading and binding variables there
+		{`let n = 5; eval("n + 1")`, 6},
+		{`eval("let y = 7"); y`, 7},
+		{`let f = fn(a) { eval("a * 2") }; f(21)`, 42},
+		// passed around it gets an environment of its own
+		{`let n = 5; apply(eval, ["n"])`, "identifier not found: n"},
+		{`eval("let x = ")`, "cannot eval, the source has parser errors: no prefix parse function for EOF found"},
+		{`eval("1 + true")`, "type mismatch: INTEGER + BOOLEAN"},
+		{`eval(1)`, "argument to `eval` must be STRING, got INTEGER"},
+		{`eval()`, "wrong number of arguments to `eval`. got=0, want=1"},
 	}
 
-	input := string(data)
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
 
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	env := object.NewEnvironment()
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
 
-	Eval(program, env)
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "ERROR: line 1, col 3: type mismatch: INTEGER + BOOLEAN"},
+		{"let a = 1;\nlet b = a;\nlet c = d;", "ERROR: line 3, col 9: identifier not found: d"},
+		{"let f = fn(x) {\n  x * 2;\n  -true\n};\nf(1)", "ERROR: line 3, col 3: unknown operator: -BOOLEAN"},
+		{"let xs = [1, 2];\n\n  len(xs, xs)", "ERROR: line 3, col 6: wrong number of arguments to `len`. got=2, want=1"},
+		{"if (true) {\n  if (1 > 0) {\n    \"a\" - \"b\"\n  }\n}", "ERROR: line 3, col 9: unknown operator: STRING - STRING"},
+		{"let h = {};\nh[fn() {}]", "ERROR: line 2, col 2: unusable as hash key: FUNCTION"},
+	}
 
-	funcs := []string{
-		"first",
-		"last",
-		"rest",
-		"map",
-		"reduce",
-		"sum",
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q - no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != tt.expected {
+			t.Errorf("input %q - wrong error. expected=%q, got=%q", tt.input, tt.expected, errObj.Inspect())
+		}
 	}
 
-	for _, fnName := range funcs {
-		fn, ok := env.Get(fnName)
+	// errors made outside of Eval have no position to report
+	if inspected := newError("boom").Inspect(); inspected != "ERROR: boom" {
+		t.Errorf("error without a position wrong. got=%q", inspected)
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"exit()", 0},
+		{"exit(3)", 3},
+		{"let x = 1; exit(x + 1); x = 5; exit(9)", 2},
+		{"let f = fn() { exit(4); 1 }; let y = f() + 1; exit(0)", 4},
+		{"loop { while (true) { exit(5) } }", 5},
+		{"find([1, 2, 3], fn(x) { if (x == 2) { exit(x) }; false })", 2},
+		{"let r = fn() { return exit(6) }; r(); 1", 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		exit, ok := evaluated.(*object.Exit)
 		if !ok {
-			t.Errorf("std function `%s` not found", fnName)
-			return
+			t.Errorf("input %q - object is not Exit. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
 		}
-		if _, ok := fn.(*object.Function); !ok {
-			t.Errorf("std function `%s` not a Function, got=%T (%+v)", fnName, fn, fn)
-			return
+
+		if exit.Code != tt.expected {
+			t.Errorf("input %q - wrong exit code. expected=%d, got=%d", tt.input, tt.expected, exit.Code)
+		}
+	}
+
+	testErrorObject(t, testEval("exit(1, 2)"), "wrong number of arguments to `exit`. got=2, want=0 or 1")
+}
+
+func TestAssert(t *testing.T) {
+	passing := []string{
+		"assert(true)",
+		"assert(1 < 2)",
+		"assert(0)",
+		`assert(len("abc") == 3, "len is wrong")`,
+	}
+
+	for _, input := range passing {
+		evaluated := testEval(input)
+		if evaluated != NULL {
+			t.Errorf("input %q - expected NULL, got=%T (%+v)", input, evaluated, evaluated)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"assert(false)", "assertion failed"},
+		{"assert(null)", "assertion failed"},
+		{`assert(1 == 2, "one is not two")`, "assertion failed: one is not two"},
+		{`let x = 1; assert(x > 1, "x is too small"); x = 5`, "assertion failed: x is too small"},
+		{"assert()", "wrong number of arguments to `assert`. got=0, want=1 or 2"},
+		{"assert(false, 1)", "second argument to `assert` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// a failed assertion stops the program
+	env := object.NewEnvironment()
+	testEvalWithEnv(`let x = 1; assert(false); x = 5`, env)
+	if x, _ := env.Get("x"); x.(*object.Integer).Value != 1 {
+		t.Errorf("expected the program to stop at the failed assertion, x=%s", x.Inspect())
+	}
+}
+
+func TestRun(t *testing.T) {
+	program := parser.New(lexer.New("let x = 2;\nx * 21")).ParseProgram()
+
+	result, err := Run(program, object.NewEnvironment())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, result, 42)
+
+	program = parser.New(lexer.New("let x = 2;\nx + true")).ParseProgram()
+
+	result, err = Run(program, object.NewEnvironment())
+	if result != nil {
+		t.Errorf("expected no result, got=%T (%+v)", result, result)
+	}
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a *RuntimeError, got=%T (%v)", err, err)
+	}
+
+	if err.Error() != "line 2, col 3: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+	if runtimeErr.Err.Pos.Line != 2 {
+		t.Errorf("wrong error line. expected=2, got=%d", runtimeErr.Err.Pos.Line)
+	}
+
+	program = parser.New(lexer.New("exit(3);\n1")).ParseProgram()
+
+	result, err = Run(program, object.NewEnvironment())
+	if result != nil {
+		t.Errorf("expected no result, got=%T (%+v)", result, result)
+	}
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an *ExitError, got=%T (%v)", err, err)
+	}
+	if exitErr.Code != 3 {
+		t.Errorf("wrong exit code. expected=3, got=%d", exitErr.Code)
+	}
+}
+
+// chdir moves into dir for the rest of the test, imports in the input are relative to the working directory
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "greeter.monkey", `
+		import "punctuation.monkey";
+		let prefix = "hello, ";
+		let shout = fn(s) { s + punctuation.bang };
+		export let greet = fn(name) { shout(prefix + name) };
+		export let greeting = greet("world");
+	`)
+	writeModule(t, dir, "punctuation.monkey", `export let bang = "!";`)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "greeter.monkey"; greeter.greet("monkey")`, "hello, monkey!"},
+		{`import "greeter.monkey"; greeter.greeting`, "hello, world!"},
+		{`import "greeter.monkey"; greeter.prefix`, errorMessage("prefix is not exported by module greeter")},
+		{`import "greeter.monkey"; greeter.shout("hi")`, errorMessage("shout is not exported by module greeter")},
+		{`import "greeter.monkey"; greeter.punctuation`, errorMessage("punctuation is not exported by module greeter")},
+		{`import "greeter.monkey"; greeter.missing`, errorMessage("module greeter has no binding missing")},
+		{`export let x = 5; x`, 5},
+	}
+
+	chdir(t, dir)
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
 		}
 	}
 }
 
+type errorMessage string
+
+func writeModule(t *testing.T, dir string, name string, input string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func testEval(input string) object.Object {
+	return testEvalWithEnv(input, object.NewEnvironment())
+}
+
+func testEvalWithEnv(input string, env *object.Environment) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	env := object.NewEnvironment()
 
 	return Eval(program, env)
 }
@@ -631,6 +3598,21 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			expected, result.Message)
+		return false
+	}
+
+	return true
+}
+
 func testStringObject(t *testing.T, obj object.Object, expected string) bool {
 	result, ok := obj.(*object.String)
 	if !ok {
@@ -0,0 +1,115 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"waiig/ast"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+	"waiig/token"
+)
+
+func (in *Interpreter) evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if in.sandbox {
+		return newError("operation not permitted in sandbox")
+	}
+
+	path, err := in.resolveImport(node.Path.Value)
+	if err != nil {
+		return newError("cannot import %q: %s", node.Path.Value, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if !isValidName(name) {
+		return newError("cannot import %q: %q isn't a valid name", node.Path.Value, name)
+	}
+
+	module := in.loadModule(name, path)
+	if isError(module) {
+		return module
+	}
+
+	env.Set(name, module)
+
+	return nil
+}
+
+func (in *Interpreter) resolveImport(path string) (string, error) {
+	if !filepath.IsAbs(path) && len(in.importing) > 0 {
+		path = filepath.Join(filepath.Dir(in.importing[len(in.importing)-1]), path)
+	}
+
+	return filepath.Abs(path)
+}
+
+func (in *Interpreter) loadModule(name string, path string) object.Object {
+	if module, ok := in.modules[path]; ok {
+		return module
+	}
+
+	for i, imported := range in.importing {
+		if imported == path {
+			chain := append(append([]string{}, in.importing[i:]...), path)
+			for j := range chain {
+				chain[j] = filepath.Base(chain[j])
+			}
+			return newError("circular import: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return newError("cannot import %q: %s", path, err)
+	}
+
+	p := parser.New(lexer.New(string(data)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("cannot import %q, it has parser errors: %s", path, strings.Join(p.Errors(), ", "))
+	}
+
+	in.importing = append(in.importing, path)
+	defer func() { in.importing = in.importing[:len(in.importing)-1] }()
+
+	module := &object.Module{Name: name, Path: path, Env: object.NewEnvironment()}
+	if evaluated := in.evalNode(program, module.Env); isError(evaluated) {
+		return evaluated
+	}
+
+	in.modules[path] = module
+
+	return module
+}
+
+// evalModuleMember looks up one of module's exported bindings, `math.add`
+func evalModuleMember(module *object.Module, name string) object.Object {
+	value, ok := module.Env.Get(name)
+	if !ok {
+		return newError("module %s has no binding %s", module.Name, name)
+	}
+
+	if !module.Env.IsExported(name) {
+		return newError("%s is not exported by module %s", name, module.Name)
+	}
+
+	return value
+}
+
+// isValidName matches the lexer, which allows letters, underscores and, after the first character, digits in
+// identifiers, keywords can't be bound
+func isValidName(name string) bool {
+	if name == "" || token.LookUpIdent(name) != token.IDENT {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || i > 0 && '0' <= ch && ch <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
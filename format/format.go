@@ -0,0 +1,305 @@
+package format
+
+import (
+	"strings"
+	"waiig/ast"
+	"waiig/parser"
+)
+
+// indent is what each level of blocks is indented by
+const indent = "    "
+
+// primary is the precedence of anything which is never split by an operator, like literals and identifiers
+const primary = parser.INDEX + 1
+
+var infixPrecedences = map[string]int{
+	"==": parser.EQUALS,
+	"!=": parser.EQUALS,
+	"<":  parser.LESSGREATER,
+	">":  parser.LESSGREATER,
+	"+":  parser.SUM,
+	"-":  parser.SUM,
+	"*":  parser.PRODUCT,
+	"/":  parser.PRODUCT,
+	">>": parser.COMPOSE,
+	"<<": parser.COMPOSE,
+}
+
+// Source renders program as canonically formatted source, one statement per line ending in a semicolon, blocks
+// indented by 4 spaces with their braces on the line of what they belong to, single spaces around binary operators,
+// and only the parentheses needed for it to parse back to the same program. Comments aren't part of the AST so they
+// don't survive formatting. Formatting the output again gives back the same text
+func Source(program *ast.Program) string {
+	f := &formatter{}
+
+	for _, stmt := range program.Statements {
+		f.statement(stmt)
+		f.out.WriteString(";\n")
+	}
+
+	return f.out.String()
+}
+
+type formatter struct {
+	out   strings.Builder
+	level int
+}
+
+func (f *formatter) write(s ...string) {
+	for _, part := range s {
+		f.out.WriteString(part)
+	}
+}
+
+func (f *formatter) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Exported {
+			f.write("export ")
+		}
+		f.write("let ", stmt.Name.Declaration(), " = ")
+		f.expression(stmt.Value)
+	case *ast.ImportStatement:
+		f.write("import \"", stmt.Path.Value, "\"")
+	case *ast.ReturnStatement:
+		f.write("return ")
+		f.expression(stmt.ReturnValue)
+	case *ast.BreakStatement:
+		f.write("break")
+		if stmt.Label != "" {
+			f.write(" ", stmt.Label)
+		}
+		if stmt.Value != nil {
+			f.write(" ")
+			f.expression(stmt.Value)
+		}
+	case *ast.ContinueStatement:
+		f.write("continue")
+		if stmt.Label != "" {
+			f.write(" ", stmt.Label)
+		}
+	case *ast.ExpressionStatement:
+		f.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		f.block(stmt)
+	}
+}
+
+// block writes `{`, the statements one per line indented one level deeper, and `}`. The last statement is left without
+// a semicolon since it's what the block evaluates to
+func (f *formatter) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		f.write("{}")
+		return
+	}
+
+	f.write("{\n")
+	f.level++
+
+	for i, stmt := range block.Statements {
+		f.write(strings.Repeat(indent, f.level))
+		f.statement(stmt)
+		if i < len(block.Statements)-1 {
+			f.write(";")
+		}
+		f.write("\n")
+	}
+
+	f.level--
+	f.write(strings.Repeat(indent, f.level), "}")
+}
+
+func (f *formatter) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		f.write(exp.Value)
+	case *ast.IntegerLiteral:
+		f.write(exp.Token.Literal)
+	case *ast.Boolean:
+		f.write(exp.Token.Literal)
+	case *ast.Null:
+		f.write("null")
+	case *ast.StringLiteral:
+		f.write("\"", exp.Value, "\"")
+	case *ast.PrefixExpression:
+		f.write(exp.Operator)
+		// `- -x` would otherwise be read back as `--x`
+		if right, ok := exp.Right.(*ast.PrefixExpression); ok && !(exp.Operator == "-" && right.Operator == "-") {
+			f.expression(right)
+		} else {
+			f.operand(exp.Right, precedence(exp.Right) <= parser.PREFIX)
+		}
+	case *ast.PostfixExpression:
+		f.write(exp.Target.Value, exp.Operator)
+	case *ast.InfixExpression:
+		p := infixPrecedences[exp.Operator]
+		// a comparison on the left of another one would be read back as a chain, so it keeps its parentheses
+		f.operand(exp.Left, precedence(exp.Left) < p || p == parser.LESSGREATER && precedence(exp.Left) == p)
+		f.write(" ", exp.Operator, " ")
+		f.operand(exp.Right, precedence(exp.Right) <= p)
+	case *ast.ComparisonChain:
+		for i, operand := range exp.Operands {
+			if i > 0 {
+				f.write(" ", exp.Operators[i-1], " ")
+			}
+			f.operand(operand, precedence(operand) <= parser.LESSGREATER)
+		}
+	case *ast.RangeExpression:
+		f.operand(exp.Left, precedence(exp.Left) < parser.RANGE)
+		f.write(":")
+		f.operand(exp.Right, precedence(exp.Right) <= parser.RANGE)
+	case *ast.AssignExpression:
+		// the value is parsed as a whole expression, so assignments chain without parentheses
+		f.expression(exp.Target)
+		f.write(" = ")
+		f.expression(exp.Value)
+	case *ast.PipeExpression:
+		f.operand(exp.Left, precedence(exp.Left) < parser.PIPE)
+		f.write(" |> ")
+		f.operand(exp.Right, precedence(exp.Right) <= parser.PIPE)
+	case *ast.CoalesceExpression:
+		f.operand(exp.Left, precedence(exp.Left) < parser.COALESCE)
+		f.write(" ?? ")
+		f.operand(exp.Right, precedence(exp.Right) <= parser.COALESCE)
+	case *ast.CallExpression:
+		f.receiver(exp.Function)
+		f.write("(")
+		f.list(exp.Arguments)
+		f.write(")")
+	case *ast.IndexExpression:
+		f.receiver(exp.Left)
+		f.write("[")
+		f.expression(exp.Index)
+		f.write("]")
+	case *ast.DotExpression:
+		f.receiver(exp.Left)
+		f.write(exp.Token.Literal, exp.Key.Value)
+	case *ast.MethodCallExpression:
+		f.receiver(exp.Receiver)
+		f.write(exp.Token.Literal, exp.Method.Value, "(")
+		f.list(exp.Arguments)
+		f.write(")")
+	case *ast.ArrayLiteral:
+		f.write("[")
+		f.list(exp.Elements)
+		f.write("]")
+	case *ast.HashLiteral:
+		f.write("{")
+		for i, pair := range exp.Pairs {
+			if i > 0 {
+				f.write(", ")
+			}
+			// keys stop at anything binding looser than the `:` after them, and at a range's `:`
+			f.operand(pair.Key, precedence(pair.Key) <= parser.HASH_INIT || precedence(pair.Key) == parser.RANGE)
+			f.write(": ")
+			f.expression(pair.Value)
+		}
+		f.write("}")
+	case *ast.FunctionLiteral:
+		params := []string{}
+		for _, param := range exp.Parameters {
+			params = append(params, param.Declaration())
+		}
+		f.write("fn(", strings.Join(params, ", "), ") ")
+		f.block(exp.Body)
+	case *ast.IfExpression:
+		f.write("if (")
+		f.expression(exp.Condition)
+		f.write(") ")
+		f.block(exp.Consequence)
+		if exp.Alternative != nil {
+			f.write(" else ")
+			f.block(exp.Alternative)
+		}
+	case *ast.WhileExpression:
+		f.label(exp.Label)
+		f.write("while (")
+		f.expression(exp.Condition)
+		f.write(") ")
+		f.block(exp.Body)
+	case *ast.DoWhileExpression:
+		f.label(exp.Label)
+		f.write("do ")
+		f.block(exp.Body)
+		f.write(" while (")
+		f.expression(exp.Condition)
+		f.write(")")
+	case *ast.LoopExpression:
+		f.label(exp.Label)
+		f.write("loop ")
+		f.block(exp.Body)
+	case *ast.BlockStatement:
+		f.block(exp)
+	case *ast.ForInExpression:
+		f.label(exp.Label)
+		f.write("for ")
+		if exp.IndexVar != nil {
+			f.write(exp.IndexVar.Value, ", ")
+		}
+		f.write(exp.ValueVar.Value, " in ")
+		f.expression(exp.Iterable)
+		f.write(" ")
+		f.block(exp.Body)
+	}
+}
+
+// operand writes exp, in parentheses when parens is set because it binds looser than the operator it's next to
+func (f *formatter) operand(exp ast.Expression, parens bool) {
+	if parens {
+		f.write("(")
+	}
+
+	f.expression(exp)
+
+	if parens {
+		f.write(")")
+	}
+}
+
+// receiver writes what's being called, indexed or dotted into, calls, indexes and dots chain left to right
+func (f *formatter) receiver(exp ast.Expression) {
+	f.operand(exp, precedence(exp) < parser.CALL)
+}
+
+func (f *formatter) list(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			f.write(", ")
+		}
+		f.expression(exp)
+	}
+}
+
+func (f *formatter) label(label string) {
+	if label != "" {
+		f.write(label, ": ")
+	}
+}
+
+// precedence is how tightly exp binds, the same as the parser's precedence for the operator it was parsed from
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.CoalesceExpression:
+		return parser.COALESCE
+	case *ast.PipeExpression:
+		return parser.PIPE
+	case *ast.InfixExpression:
+		return infixPrecedences[exp.Operator]
+	case *ast.ComparisonChain:
+		return parser.LESSGREATER
+	case *ast.RangeExpression:
+		return parser.RANGE
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.PostfixExpression:
+		return parser.POSTFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.DotExpression, *ast.MethodCallExpression:
+		return parser.INDEX
+	default:
+		return primary
+	}
+}
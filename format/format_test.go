@@ -0,0 +1,125 @@
+package format
+
+import (
+	"testing"
+	"waiig/ast"
+	"waiig/lexer"
+	"waiig/parser"
+)
+
+func TestSourceNestedFunction(t *testing.T) {
+	input := `let   makeCounter=fn(start,step){let n=start;
+fn(){ if(n>100){ n=start } else { n=n+step*2 }; n }};
+let c = makeCounter(1 , 2) ; c()`
+
+	expected := `let makeCounter = fn(start, step) {
+    let n = start;
+    fn() {
+        if (n > 100) {
+            n = start
+        } else {
+            n = n + step * 2
+        };
+        n
+    }
+};
+let c = makeCounter(1, 2);
+c();
+`
+
+	if actual := Source(parse(t, input)); actual != expected {
+		t.Errorf("wrong output. expected=\n%s\ngot=\n%s", expected, actual)
+	}
+}
+
+func TestSourceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(a+b)", "-(a + b);\n"},
+		{"-(-a)", "-(-a);\n"},
+		{"!-a", "!-a;\n"},
+		{"!(a==b)", "!(a == b);\n"},
+		{"1<x<10", "1 < x < 10;\n"},
+		{"(3>2)>1", "(3 > 2) > 1;\n"},
+		{"(1<x<10)<y", "(1 < x < 10) < y;\n"},
+		{"(a==b)<c", "(a == b) < c;\n"},
+		{"a=b=1", "a = b = 1;\n"},
+		{"x|>f(1)|>g", "x |> f(1) |> g;\n"},
+		{"a??b??c", "a ?? b ?? c;\n"},
+		{"(f>>g)<<h", "f >> g << h;\n"},
+		{"f>>(g<<h)", "f >> (g << h);\n"},
+		{"a*(b>>c)", "a * b >> c;\n"},
+		{"(a*b)>>c", "(a * b) >> c;\n"},
+		{"1:(2:3)", "1:(2:3);\n"},
+		{"(1+2):5", "1 + 2:5;\n"},
+		{"(a+b).len()", "(a + b).len();\n"},
+		{"h?.name?.first", "h?.name?.first;\n"},
+		{"f(x)[0](y)", "f(x)[0](y);\n"},
+		{"(-f)(1)", "(-f)(1);\n"},
+		{`{"a":1,(x==y):2,1+1:[1,2]}`, `{"a": 1, x == y: 2, 1 + 1: [1, 2]};` + "\n"},
+		{`{(1:3):"x"}`, `{(1:3): "x"};` + "\n"},
+		{"i++", "i++;\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"export let x=null", "export let x = null;\n"},
+		{"let x:int=1", "let x: int = 1;\n"},
+		{"fn(a:int,b){a}", "fn(a: int, b) {\n    a\n};\n"},
+		{`import "lib.monkey"`, `import "lib.monkey";` + "\n"},
+		{"outer:while(true){loop{break outer};continue}", "outer: while (true) {\n    loop {\n        break outer\n    };\n    continue\n};\n"},
+		{"do{x--}while(x>0)", "do {\n    x--\n} while (x > 0);\n"},
+		{"let y = loop { break 5 }", "let y = loop {\n    break 5\n};\n"},
+		{"for i,v in xs{v}", "for i, v in xs {\n    v\n};\n"},
+		{"let r={let x=2;x*3}", "let r = {\n    let x = 2;\n    x * 3\n};\n"},
+		{"outer:for c in \"ab\"{continue outer}", "outer: for c in \"ab\" {\n    continue outer\n};\n"},
+	}
+
+	for _, tt := range tests {
+		if actual := Source(parse(t, tt.input)); actual != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestSourceIsIdempotent(t *testing.T) {
+	inputs := []string{
+		`let fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }; puts(fib(10))`,
+		`let apply = fn(f, xs) { let out = []; let i = 0; while (i < len(xs)) { out = push(out, f(xs[i])); i++ }; out };
+		apply(fn(x) { fn(y) { x * y } }, [1, 2, 3])`,
+		`let h = {"a": {"b": [1, -2, !true]}, 3: fn() { 1 }}; h.a.b.first() ?? (h["c"] |> len)`,
+		`outer: loop { do { if (x) { break outer 1 } else { continue } } while (false) }`,
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+		once := Source(program)
+		reparsed := parse(t, once)
+		twice := Source(reparsed)
+
+		if once != twice {
+			t.Errorf("formatting isn't idempotent. first=\n%s\nsecond=\n%s", once, twice)
+		}
+
+		// the parentheses the formatter drops mustn't change how it parses
+		if program.String() != reparsed.String() {
+			t.Errorf("formatting changed the program. expected=%q, got=%q", program.String(), reparsed.String())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("input %q has parser errors: %v", input, p.Errors())
+	}
+
+	return program
+}
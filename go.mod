@@ -1,3 +1,5 @@
 module waiig
 
 go 1.22
+
+require golang.org/x/text v0.21.0
@@ -0,0 +1,213 @@
+package inspector
+
+import (
+	"sort"
+	"strings"
+	"waiig/object"
+)
+
+// PrettyPrintString is PrettyPrint indenting by 2 spaces
+func PrettyPrintString(obj object.Object) string {
+	return PrettyPrint(obj, 2)
+}
+
+// PrettyPrint is obj's Inspect spread over several lines, indented by indent spaces per level. Arrays and hashes
+// holding only scalars stay on one line, otherwise hashes get a line per pair and arrays of more than 3 elements a line
+// per element. Hash pairs are sorted by key so the output is stable, functions only show their signature
+func PrettyPrint(obj object.Object, indent int) string {
+	var out strings.Builder
+	prettyPrint(&out, obj, strings.Repeat(" ", indent), 0, map[object.Object]bool{})
+	return out.String()
+}
+
+// prettyPrint writes obj to out, visiting has the arrays and hashes already being printed further up, which are written
+// as a placeholder when they hold themselves, like Inspect does
+func prettyPrint(out *strings.Builder, obj object.Object, indent string, level int, visiting map[object.Object]bool) {
+	leave, ok := visit(obj, visiting)
+	if !ok {
+		out.WriteString(placeholder(obj))
+		return
+	}
+	defer leave()
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		if isFlat(obj) || len(obj.Elements) <= 3 {
+			out.WriteString("[")
+			for i, element := range obj.Elements {
+				if i > 0 {
+					out.WriteString(", ")
+				}
+				prettyPrint(out, element, indent, level, visiting)
+			}
+			out.WriteString("]")
+			return
+		}
+
+		out.WriteString("[\n")
+		for i, element := range obj.Elements {
+			out.WriteString(strings.Repeat(indent, level+1))
+			prettyPrint(out, element, indent, level+1, visiting)
+			if i < len(obj.Elements)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(strings.Repeat(indent, level) + "]")
+	case *object.Hash:
+		pairs := sortedPairs(obj)
+
+		if isFlat(obj) {
+			out.WriteString("{")
+			for i, pair := range pairs {
+				if i > 0 {
+					out.WriteString(", ")
+				}
+				out.WriteString(pair.Key.Inspect() + ": ")
+				prettyPrint(out, pair.Value, indent, level, visiting)
+			}
+			out.WriteString("}")
+			return
+		}
+
+		out.WriteString("{\n")
+		for i, pair := range pairs {
+			out.WriteString(strings.Repeat(indent, level+1))
+			prettyPrint(out, pair.Key, indent, level+1, visiting)
+			out.WriteString(": ")
+			prettyPrint(out, pair.Value, indent, level+1, visiting)
+			if i < len(pairs)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(strings.Repeat(indent, level) + "}")
+	case *object.Function:
+		params := []string{}
+		for _, p := range obj.Parameters {
+			params = append(params, p.String())
+		}
+		out.WriteString("fn(" + strings.Join(params, ", ") + ") {...}")
+	default:
+		out.WriteString(obj.Inspect())
+	}
+}
+
+// Depth is how deeply arrays and hashes are nested in obj, 0 for anything else, 1 for `[1, 2]`, 2 for `[[1], 2]`. An
+// array or hash holding itself doesn't add to the depth again where it comes around
+func Depth(obj object.Object) int {
+	return depth(obj, map[object.Object]bool{})
+}
+
+func depth(obj object.Object, visiting map[object.Object]bool) int {
+	leave, ok := visit(obj, visiting)
+	if !ok {
+		return 0
+	}
+	defer leave()
+
+	deepest := 0
+	for _, child := range children(obj) {
+		deepest = max(deepest, depth(child, visiting))
+	}
+
+	switch obj.(type) {
+	case *object.Array, *object.Hash:
+		return deepest + 1
+	default:
+		return 0
+	}
+}
+
+// Size is how many elements and hash pairs there are in obj, counting those of nested arrays and hashes. An array or
+// hash holding itself is counted as an element, but its elements aren't counted again
+func Size(obj object.Object) int {
+	return size(obj, map[object.Object]bool{})
+}
+
+func size(obj object.Object, visiting map[object.Object]bool) int {
+	leave, ok := visit(obj, visiting)
+	if !ok {
+		return 0
+	}
+	defer leave()
+
+	total := 0
+	switch obj := obj.(type) {
+	case *object.Array:
+		total = len(obj.Elements)
+	case *object.Hash:
+		total = len(obj.Pairs)
+	}
+
+	for _, child := range children(obj) {
+		total += size(child, visiting)
+	}
+
+	return total
+}
+
+// visit marks obj as being visited when it's an array or a hash, ok is false when it already was further up, meaning obj
+// holds itself. leave unmarks it, the same array held twice side by side isn't a cycle
+func visit(obj object.Object, visiting map[object.Object]bool) (leave func(), ok bool) {
+	switch obj.(type) {
+	case *object.Array, *object.Hash:
+	default:
+		return func() {}, true
+	}
+
+	if visiting[obj] {
+		return nil, false
+	}
+	visiting[obj] = true
+
+	return func() { delete(visiting, obj) }, true
+}
+
+// placeholder stands in for an array or hash which holds itself
+func placeholder(obj object.Object) string {
+	if _, ok := obj.(*object.Hash); ok {
+		return "{...}"
+	}
+	return "[...]"
+}
+
+// isFlat reports whether obj holds no arrays or hashes, hash keys included
+func isFlat(obj object.Object) bool {
+	for _, child := range children(obj) {
+		switch child.(type) {
+		case *object.Array, *object.Hash:
+			return false
+		}
+	}
+
+	return true
+}
+
+func children(obj object.Object) []object.Object {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return obj.Elements
+	case *object.Hash:
+		children := []object.Object{}
+		for _, pair := range sortedPairs(obj) {
+			children = append(children, pair.Key, pair.Value)
+		}
+		return children
+	default:
+		return nil
+	}
+}
+
+func sortedPairs(hash *object.Hash) []object.HashPair {
+	pairs := []object.HashPair{}
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+	})
+
+	return pairs
+}
@@ -0,0 +1,136 @@
+package inspector
+
+import (
+	"testing"
+	"waiig/evaluator"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+)
+
+func TestPrettyPrintFlat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"42", "42"},
+		{`"hi"`, "hi"},
+		{"true", "true"},
+		{"null", "null"},
+		{"[]", "[]"},
+		{"{}", "{}"},
+		{"[1, 2, 3, 4, 5, 6]", "[1, 2, 3, 4, 5, 6]"},
+		{`{"b": 2, "a": 1, "c": true}`, "{a: 1, b: 2, c: true}"},
+		{"fn(x, y) { x + y }", "fn(x, y) {...}"},
+		{"[fn() { 1 }, 2]", "[fn() {...}, 2]"},
+		{"len", "builtin function `len`"},
+	}
+
+	for _, tt := range tests {
+		actual := PrettyPrintString(testEval(t, tt.input))
+		if actual != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestPrettyPrintNested(t *testing.T) {
+	tests := []struct {
+		input    string
+		indent   int
+		expected string
+	}{
+		{
+			`{"a": [1, {"b": 2}]}`,
+			2,
+			"{\n" +
+				"  a: [1, {b: 2}]\n" +
+				"}",
+		},
+		{
+			`[[1, 2], [3], [4, 5], [6]]`,
+			2,
+			"[\n" +
+				"  [1, 2],\n" +
+				"  [3],\n" +
+				"  [4, 5],\n" +
+				"  [6]\n" +
+				"]",
+		},
+		{
+			`{"name": "monkey", "tags": ["a", "b"], "nested": {"deeper": {"deepest": [1, [2]]}}}`,
+			4,
+			"{\n" +
+				"    name: monkey,\n" +
+				"    nested: {\n" +
+				"        deeper: {\n" +
+				"            deepest: [1, [2]]\n" +
+				"        }\n" +
+				"    },\n" +
+				"    tags: [a, b]\n" +
+				"}",
+		},
+		{
+			`[1, {"x": [1]}, 3]`,
+			2,
+			"[1, {\n" +
+				"  x: [1]\n" +
+				"}, 3]",
+		},
+	}
+
+	for _, tt := range tests {
+		actual := PrettyPrint(testEval(t, tt.input), tt.indent)
+		if actual != tt.expected {
+			t.Errorf("input %q - expected=\n%s\ngot=\n%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestDepthAndSize(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedDepth int
+		expectedSize  int
+	}{
+		{"1", 0, 0},
+		{"[]", 1, 0},
+		{"[1, 2, 3]", 1, 3},
+		{"[[1], 2]", 2, 3},
+		{`{"a": [1, {"b": 2}]}`, 3, 4},
+		// the array coming around again is an element, but its elements aren't counted twice
+		{"let a = [1]; a[0] = a; a", 1, 1},
+		{"let a = [1, 2]; a[1] = [a]; a", 2, 3},
+	}
+
+	for _, tt := range tests {
+		obj := testEval(t, tt.input)
+
+		if depth := Depth(obj); depth != tt.expectedDepth {
+			t.Errorf("input %q - wrong depth. expected=%d, got=%d", tt.input, tt.expectedDepth, depth)
+		}
+		if size := Size(obj); size != tt.expectedSize {
+			t.Errorf("input %q - wrong size. expected=%d, got=%d", tt.input, tt.expectedSize, size)
+		}
+	}
+}
+
+func TestPrettyPrintSelfReferential(t *testing.T) {
+	obj := testEval(t, `let h = {"a": 1}; h["self"] = h; h`)
+
+	expected := "{\n  a: 1,\n  self: {...}\n}"
+	if actual := PrettyPrintString(obj); actual != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, actual)
+	}
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("input %q has parser errors: %v", input, p.Errors())
+	}
+
+	return evaluator.Eval(program, object.NewEnvironment())
+}
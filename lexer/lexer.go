@@ -1,6 +1,10 @@
 package lexer
 
-import "waiig/token"
+import (
+	"io"
+	"os"
+	"waiig/token"
+)
 
 type Lexer struct {
 	input string
@@ -10,15 +14,71 @@ type Lexer struct {
 	readPosition int
 	// current char under examination
 	ch byte
+	// line and column of the current char, both start at 1 and columns count bytes
+	line   int
+	column int
+	// prev is the type of the last token read, empty until NextToken is first called. `--` is only a decrement after
+	// some tokens, and Tokens can only be called before any was read
+	prev token.TokenType
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// NewFromReader creates a lexer over everything r produces, it's all read up front since the lexer scans a string
+func NewFromReader(r io.Reader) (*Lexer, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(string(input)), nil
+}
+
+// NewFromFile creates a lexer over the contents of the file at path, the file is closed once it's been read
+func NewFromFile(path string) (*Lexer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewFromReader(f)
+}
+
+// Tokenize lexes the whole input, returning all of its tokens including the trailing EOF
+func Tokenize(input string) []token.Token {
+	return New(input).Tokens()
+}
+
+// Tokens drains the lexer returning all of its tokens including the trailing EOF, it must be called on a fresh lexer,
+// calling it after NextToken would silently drop the tokens already read so it panics instead
+func (l *Lexer) Tokens() []token.Token {
+	if l.prev != "" {
+		panic("lexer: Tokens called on a partially consumed lexer")
+	}
+
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -29,11 +89,20 @@ func (l *Lexer) readChar() {
 }
 
 func (l *Lexer) NextToken() token.Token {
+	tok := l.nextToken()
+	l.prev = tok.Type
+
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
 	l.skipComments()
 
+	pos := token.Position{Line: l.line, Column: l.column}
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -43,9 +112,19 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '+' {
+			l.readChar()
+			tok = token.Token{Type: token.INCREMENT, Literal: "++"}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '-' && l.isDecrement() {
+			l.readChar()
+			tok = token.Token{Type: token.DECREMENT, Literal: "--"}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -58,15 +137,44 @@ func (l *Lexer) NextToken() token.Token {
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.BWDARROW, Literal: "<<"}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.FWDARROW, Literal: ">>"}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: "|>"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '?':
+		if l.peekChar() == '?' {
+			l.readChar()
+			tok = token.Token{Type: token.COALESCE, Literal: "??"}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.OPT_DOT, Literal: "?."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -89,10 +197,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookUpIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = token.INT
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -100,9 +210,41 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
+	return tok
+}
+
+// Peek returns the next token without consuming it, the following NextToken call returns the same token
+func (l *Lexer) Peek() token.Token {
+	position, readPosition, ch, line, column, prev := l.position, l.readPosition, l.ch, l.line, l.column, l.prev
+
+	tok := l.NextToken()
+
+	l.position, l.readPosition, l.ch, l.line, l.column, l.prev = position, readPosition, ch, line, column, prev
+
 	return tok
 }
 
+// isDecrement reports whether the `--` at the current char is a decrement, which it can only be right after something
+// assignable, a name or an index, and when no operand follows it on the same line. Otherwise it's two minuses, as in
+// `a--b` or `--x`
+func (l *Lexer) isDecrement() bool {
+	if l.prev != token.IDENT && l.prev != token.RBRCKT {
+		return false
+	}
+
+	for i := l.readPosition + 1; i < len(l.input); i++ {
+		ch := l.input[i]
+		if ch == ' ' || ch == '\t' || ch == '\r' {
+			continue
+		}
+
+		return !(isLetter(ch) || isDigit(ch) || ch == '(' || ch == '[' || ch == '"')
+	}
+
+	return true
+}
+
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
 		return 0
@@ -133,9 +275,10 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// readIdentifier reads an identifier, which starts with a letter but may contain digits after that, e.g. base64Encode
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -1,6 +1,9 @@
 package lexer
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"waiig/token"
 )
@@ -30,6 +33,15 @@ if (5 < 10) {
 
 [1, 2];
 [1:5];
+x |> f;
+f >> g << h;
+a < b > c;
+a.len();
+a ?? b;
+a?.b;
+i++ - i--;
+do { break; continue } while (x)
+loop { break 1 }
 // comment
 `
 
@@ -149,6 +161,66 @@ if (5 < 10) {
 		{token.RBRCKT, "]"},
 		{token.SEMICOLON, ";"},
 
+		{token.IDENT, "x"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "f"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "f"},
+		{token.FWDARROW, ">>"},
+		{token.IDENT, "g"},
+		{token.BWDARROW, "<<"},
+		{token.IDENT, "h"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "a"},
+		{token.LT, "<"},
+		{token.IDENT, "b"},
+		{token.GT, ">"},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "len"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "a"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "a"},
+		{token.OPT_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "i"},
+		{token.INCREMENT, "++"},
+		{token.MINUS, "-"},
+		{token.IDENT, "i"},
+		{token.DECREMENT, "--"},
+		{token.SEMICOLON, ";"},
+
+		{token.DO, "do"},
+		{token.LBRACE, "{"},
+		{token.BREAK, "break"},
+		{token.SEMICOLON, ";"},
+		{token.CONTINUE, "continue"},
+		{token.RBRACE, "}"},
+		{token.WHILE, "while"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+
+		{token.LOOP, "loop"},
+		{token.LBRACE, "{"},
+		{token.BREAK, "break"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+
 		{token.EOF, ""},
 	}
 
@@ -167,3 +239,237 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestPeek(t *testing.T) {
+	l := New("a == b")
+
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "a", Pos: token.Position{Line: 1, Column: 1}},
+		{Type: token.EQ, Literal: "==", Pos: token.Position{Line: 1, Column: 3}},
+		{Type: token.IDENT, Literal: "b", Pos: token.Position{Line: 1, Column: 6}},
+		{Type: token.EOF, Literal: "", Pos: token.Position{Line: 1, Column: 7}},
+	}
+
+	for i, tt := range expected {
+		first := l.Peek()
+		second := l.Peek()
+		if first != second {
+			t.Errorf("tests[%d] - peeking twice returned different tokens. first=%+v, second=%+v", i, first, second)
+		}
+		if first != tt {
+			t.Errorf("tests[%d] - peeked token wrong. expected=%+v, got=%+v", i, tt, first)
+		}
+
+		next := l.NextToken()
+		if next != tt {
+			t.Errorf("tests[%d] - next token wrong. expected=%+v, got=%+v", i, tt, next)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Pos: token.Position{Line: 1, Column: 1}},
+		{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 1, Column: 5}},
+		{Type: token.ASSIGN, Literal: "=", Pos: token.Position{Line: 1, Column: 7}},
+		{Type: token.INT, Literal: "5", Pos: token.Position{Line: 1, Column: 9}},
+		{Type: token.SEMICOLON, Literal: ";", Pos: token.Position{Line: 1, Column: 10}},
+		{Type: token.EOF, Literal: "", Pos: token.Position{Line: 1, Column: 11}},
+	}
+
+	tokens := Tokenize("let x = 5;")
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)", len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+
+	empty := Tokenize("")
+	if len(empty) != 1 || empty[0].Type != token.EOF {
+		t.Errorf("empty input should only produce EOF. got=%+v", empty)
+	}
+}
+
+func TestNewFromFile(t *testing.T) {
+	input := "let add = fn(x, y) {\n  x + y;\n};\nadd(1, \"two\");\n"
+
+	path := filepath.Join(t.TempDir(), "input.monkey")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatalf("could not write input file: %s", err)
+	}
+
+	l, err := NewFromFile(path)
+	if err != nil {
+		t.Fatalf("NewFromFile returned an error: %s", err)
+	}
+
+	expected := Tokenize(input)
+	tokens := l.Tokens()
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)", len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+
+	if _, err := NewFromFile(filepath.Join(t.TempDir(), "missing.monkey")); err == nil {
+		t.Errorf("NewFromFile on a missing file should return an error")
+	}
+}
+
+func TestNewFromReader(t *testing.T) {
+	l, err := NewFromReader(strings.NewReader("let x = 5;"))
+	if err != nil {
+		t.Fatalf("NewFromReader returned an error: %s", err)
+	}
+
+	if tokens := l.Tokens(); len(tokens) != 6 || tokens[1].Literal != "x" {
+		t.Errorf("wrong tokens. got=%+v", tokens)
+	}
+}
+
+func TestIdentifiersWithDigits(t *testing.T) {
+	tokens := Tokenize("base64Encode x1 1x")
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "base64Encode"},
+		{Type: token.IDENT, Literal: "x1"},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.IDENT, Literal: "x"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)", len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		if tok.Type != expected[i].Type || tok.Literal != expected[i].Literal {
+			t.Errorf("tokens[%d] wrong. expected=%q %q, got=%q %q", i, expected[i].Type, expected[i].Literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestDoubleMinus(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.TokenType
+	}{
+		{"i--", []token.TokenType{token.IDENT, token.DECREMENT, token.EOF}},
+		{"a[0]--;", []token.TokenType{token.IDENT, token.LBRCKT, token.INT, token.RBRCKT, token.DECREMENT, token.SEMICOLON, token.EOF}},
+		{"i--\nj", []token.TokenType{token.IDENT, token.DECREMENT, token.IDENT, token.EOF}},
+		{"a--b", []token.TokenType{token.IDENT, token.MINUS, token.MINUS, token.IDENT, token.EOF}},
+		{"a -- 1", []token.TokenType{token.IDENT, token.MINUS, token.MINUS, token.INT, token.EOF}},
+		{"--x", []token.TokenType{token.MINUS, token.MINUS, token.IDENT, token.EOF}},
+		{"1--2", []token.TokenType{token.INT, token.MINUS, token.MINUS, token.INT, token.EOF}},
+	}
+
+	for _, tt := range tests {
+		tokens := Tokenize(tt.input)
+		if len(tokens) != len(tt.expected) {
+			t.Errorf("input %q - wrong number of tokens. expected=%d, got=%d (%+v)", tt.input, len(tt.expected), len(tokens), tokens)
+			continue
+		}
+
+		for i, tok := range tokens {
+			if tok.Type != tt.expected[i] {
+				t.Errorf("input %q - tokens[%d] wrong. expected=%q, got=%q", tt.input, i, tt.expected[i], tok.Type)
+			}
+		}
+	}
+
+	// peeking at `--` doesn't change what comes after it
+	l := New("a--b")
+	l.NextToken()
+	if peeked := l.Peek(); peeked.Type != token.MINUS {
+		t.Errorf("wrong peeked token. expected=%q, got=%q", token.MINUS, peeked.Type)
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+	a + b; // sum
+};
+"multi
+line" add(1,
+  22)`
+
+	expected := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"let", 1, 1},
+		{"add", 1, 5},
+		{"=", 1, 9},
+		{"fn", 1, 11},
+		{"(", 1, 13},
+		{"a", 1, 14},
+		{",", 1, 15},
+		{"b", 1, 17},
+		{")", 1, 18},
+		{"{", 1, 20},
+		{"a", 2, 2},
+		{"+", 2, 4},
+		{"b", 2, 6},
+		{";", 2, 7},
+		{"}", 3, 1},
+		{";", 3, 2},
+		{"multi\nline", 4, 1},
+		{"add", 5, 7},
+		{"(", 5, 10},
+		{"1", 5, 11},
+		{",", 5, 12},
+		{"22", 6, 3},
+		{")", 6, 5},
+		{"", 6, 6},
+	}
+
+	tokens := Tokenize(input)
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)", len(expected), len(tokens), tokens)
+	}
+
+	for i, tt := range expected {
+		tok := tokens[i]
+		if tok.Literal != tt.literal {
+			t.Errorf("tokens[%d] - literal wrong. expected=%q, got=%q", i, tt.literal, tok.Literal)
+		}
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Errorf("tokens[%d] %q - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.literal, tt.line, tt.column, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+func TestTokensAfterNextTokenPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Tokens didn't panic on a partially consumed lexer")
+		}
+	}()
+
+	l := New("let x = 5;")
+	l.NextToken()
+	l.Tokens()
+}
+
+func TestTokensAfterPeek(t *testing.T) {
+	// peeking doesn't consume anything, so the lexer still counts as fresh
+	l := New("let x = 5;")
+	l.Peek()
+
+	tokens := l.Tokens()
+	if len(tokens) != 6 || tokens[0].Type != token.LET {
+		t.Errorf("wrong tokens after peeking. got=%+v", tokens)
+	}
+}
@@ -0,0 +1,290 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C is read as a key rather than raising an interrupt
+var ErrInterrupted = errors.New("interrupted")
+
+// Completer is called with the line up to the cursor when Tab is pressed, it returns the partial word at the end of the
+// line and the candidates which could replace it
+type Completer func(line string) (prefix string, candidates []string)
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Editor reads lines with basic editing: the arrow keys, Home and End move around the line, up and down go through the
+// earlier lines, and Tab completes the word before the cursor with Complete. When in is a terminal it's switched to raw
+// mode while a line is read so keys arrive one by one, otherwise the keys are taken from in as they are
+type Editor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// terminal is in when it's a terminal, restore puts it back the way it was before raw mode, nil outside of ReadLine.
+	// Close can be called while ReadLine waits for a key, so restore is guarded by mu
+	terminal *os.File
+	mu       sync.Mutex
+	restore  func()
+
+	Complete Completer
+
+	history []string
+}
+
+// New returns an Editor reading keys from in and echoing the line being edited to out
+func New(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out}
+
+	if f, ok := in.(*os.File); ok && IsTerminal(f) {
+		e.terminal = f
+	}
+
+	return e
+}
+
+// AddHistory adds line to the lines up and down go through, the most recent last
+func (e *Editor) AddHistory(line string) {
+	e.history = append(e.history, line)
+}
+
+// Close puts the terminal back into the mode it was in, for when ReadLine is left waiting for a key, e.g. on an
+// interrupt
+func (e *Editor) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.restore != nil {
+		e.restore()
+		e.restore = nil
+	}
+}
+
+// ReadLine shows prompt and returns the line once Enter is pressed, without the newline. It returns io.EOF on Ctrl-D
+// when the line is empty, or once in is exhausted with nothing read
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.terminal != nil {
+		restore, err := makeRaw(e.terminal)
+		if err != nil {
+			return "", err
+		}
+		e.mu.Lock()
+		e.restore = restore
+		e.mu.Unlock()
+		defer e.Close()
+	}
+
+	l := &line{prompt: prompt, out: e.out, historyIndex: len(e.history)}
+	l.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(l.buf) > 0 {
+				fmt.Fprint(e.out, "\n")
+				return string(l.buf), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyLineFeed:
+			fmt.Fprint(e.out, "\n")
+			return string(l.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(l.buf) == 0 {
+				fmt.Fprint(e.out, "\n")
+				return "", io.EOF
+			}
+			l.deleteForward()
+		case keyCtrlA:
+			l.moveTo(0)
+		case keyCtrlE:
+			l.moveTo(len(l.buf))
+		case keyCtrlB:
+			l.moveTo(l.pos - 1)
+		case keyCtrlF:
+			l.moveTo(l.pos + 1)
+		case keyCtrlK:
+			l.buf = l.buf[:l.pos]
+			l.refresh()
+		case keyCtrlU:
+			l.buf = l.buf[l.pos:]
+			l.moveTo(0)
+		case keyBackspace, keyDelete:
+			l.deleteBackward()
+		case keyTab:
+			e.complete(l)
+		case keyEscape:
+			e.escape(l)
+		default:
+			if r >= ' ' {
+				l.insert(r)
+			}
+		}
+	}
+}
+
+// escape handles the escape sequences the arrow keys, Home, End and Delete send, anything else is ignored
+func (e *Editor) escape(l *line) {
+	next, _, err := e.in.ReadRune()
+	if err != nil || (next != '[' && next != 'O') {
+		return
+	}
+
+	// `ESC [ 3 ~` and the like carry a number before the final character
+	number := ""
+	key, _, err := e.in.ReadRune()
+	for err == nil && '0' <= key && key <= '9' {
+		number += string(key)
+		key, _, err = e.in.ReadRune()
+	}
+	if err != nil {
+		return
+	}
+
+	switch {
+	case key == 'A':
+		e.recall(l, -1)
+	case key == 'B':
+		e.recall(l, 1)
+	case key == 'C':
+		l.moveTo(l.pos + 1)
+	case key == 'D':
+		l.moveTo(l.pos - 1)
+	case key == 'H', key == '~' && (number == "1" || number == "7"):
+		l.moveTo(0)
+	case key == 'F', key == '~' && (number == "4" || number == "8"):
+		l.moveTo(len(l.buf))
+	case key == '~' && number == "3":
+		l.deleteForward()
+	}
+}
+
+// recall replaces the line with the one delta entries away in the history, going past the most recent one gives back
+// what was being typed before going through the history
+func (e *Editor) recall(l *line, delta int) {
+	index := l.historyIndex + delta
+	if index < 0 || index > len(e.history) {
+		return
+	}
+
+	if l.historyIndex == len(e.history) {
+		l.draft = l.buf
+	}
+	l.historyIndex = index
+
+	if index == len(e.history) {
+		l.buf = l.draft
+	} else {
+		l.buf = []rune(e.history[index])
+	}
+	l.moveTo(len(l.buf))
+}
+
+// complete extends the word before the cursor as far as all the candidates agree, and lists them when there's more than
+// one left to choose from
+func (e *Editor) complete(l *line) {
+	if e.Complete == nil {
+		return
+	}
+
+	prefix, candidates := e.Complete(string(l.buf[:l.pos]))
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(common, prefix); ok {
+		for _, r := range rest {
+			l.buf = append(l.buf[:l.pos], append([]rune{r}, l.buf[l.pos:]...)...)
+			l.pos++
+		}
+	}
+
+	if len(candidates) > 1 {
+		fmt.Fprintf(e.out, "\n%s\n", strings.Join(candidates, "  "))
+	}
+	l.refresh()
+}
+
+// line is the line being edited, pos is the index in buf the cursor is at
+type line struct {
+	prompt string
+	out    io.Writer
+
+	buf []rune
+	pos int
+
+	// historyIndex is the history entry being shown, the length of the history when it's the line being typed, which
+	// is kept in draft while going through the history
+	historyIndex int
+	draft        []rune
+}
+
+func (l *line) insert(r rune) {
+	l.buf = append(l.buf[:l.pos], append([]rune{r}, l.buf[l.pos:]...)...)
+	l.pos++
+	l.refresh()
+}
+
+func (l *line) deleteBackward() {
+	if l.pos == 0 {
+		return
+	}
+
+	l.buf = append(l.buf[:l.pos-1], l.buf[l.pos:]...)
+	l.pos--
+	l.refresh()
+}
+
+func (l *line) deleteForward() {
+	if l.pos == len(l.buf) {
+		return
+	}
+
+	l.buf = append(l.buf[:l.pos], l.buf[l.pos+1:]...)
+	l.refresh()
+}
+
+func (l *line) moveTo(pos int) {
+	l.pos = min(max(pos, 0), len(l.buf))
+	l.refresh()
+}
+
+// refresh redraws the prompt and the line over the current one and puts the cursor back where it belongs
+func (l *line) refresh() {
+	fmt.Fprintf(l.out, "\r%s%s\x1b[K", l.prompt, string(l.buf))
+	if back := len(l.buf) - l.pos; back > 0 {
+		fmt.Fprintf(l.out, "\x1b[%dD", back)
+	}
+}
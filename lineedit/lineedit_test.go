@@ -0,0 +1,126 @@
+package lineedit
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLineEditing(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"hello\r", "hello"},
+		{"hello\n", "hello"},
+		{"helo\x1b[Dl\r", "hello"},
+		{"ello\x01h\r", "hello"},
+		{"hello\x01\x05!\r", "hello!"},
+		{"hellp\x7fo\r", "hello"},
+		{"hellp\x08o\r", "hello"},
+		{"hxello\x1b[H\x1b[C\x1b[3~\r", "hello"},
+		{"hello world\x01\x06\x06\x06\x06\x06\x0b\r", "hello"},
+		{"say hello\x02\x02\x02\x02\x02\x15\r", "hello"},
+		{"héllo\x1b[D\x1b[D\x1b[D\x7fe\r", "hello"},
+		{"ab\x1b[1~x\x1b[4~y\r", "xaby"},
+		{"unfinished", "unfinished"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		line, err := New(strings.NewReader(tt.keys), &out).ReadLine("> ")
+		if err != nil {
+			t.Errorf("keys %q - unexpected error: %s", tt.keys, err)
+			continue
+		}
+
+		if line != tt.expected {
+			t.Errorf("keys %q - expected=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestReadLineEOF(t *testing.T) {
+	tests := []string{"", "\x04"}
+
+	for _, keys := range tests {
+		_, err := New(strings.NewReader(keys), io.Discard).ReadLine("> ")
+		if err != io.EOF {
+			t.Errorf("keys %q - expected io.EOF, got=%v", keys, err)
+		}
+	}
+
+	// Ctrl-D deletes the character under the cursor when there's a line
+	line, err := New(strings.NewReader("hxello\x01\x06\x04\r"), io.Discard).ReadLine("> ")
+	if err != nil || line != "hello" {
+		t.Errorf("expected Ctrl-D to delete a character, got=%q, err=%v", line, err)
+	}
+}
+
+func TestReadLineHistory(t *testing.T) {
+	editor := New(strings.NewReader("\x1b[A\r\x1b[A\x1b[A\r\x1b[A\x1b[A\x1b[A\x1b[A\r"+
+		"draft\x1b[A\x1b[B\r"), io.Discard)
+	editor.AddHistory("first")
+	editor.AddHistory("second")
+
+	expected := []string{"second", "first", "first", "draft"}
+	for _, want := range expected {
+		line, err := editor.ReadLine("> ")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if line != want {
+			t.Errorf("expected=%q, got=%q", want, line)
+		}
+	}
+}
+
+func TestReadLineCompletion(t *testing.T) {
+	complete := func(line string) (string, []string) {
+		start := strings.LastIndex(line, " ") + 1
+		prefix := line[start:]
+
+		candidates := []string{}
+		for _, name := range []string{"total", "totals", "value"} {
+			if strings.HasPrefix(name, prefix) {
+				candidates = append(candidates, name)
+			}
+		}
+		return prefix, candidates
+	}
+
+	tests := []struct {
+		keys           string
+		expected       string
+		expectedListed bool
+	}{
+		{"let x = va\t\r", "let x = value", false},
+		{"to\t\r", "total", true},
+		{"to\ts\r", "totals", true},
+		{"nothing\t\r", "nothing", false},
+		{"va + 1\x1b[D\x1b[D\x1b[D\x1b[D\t\r", "value + 1", false},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		editor := New(strings.NewReader(tt.keys), &out)
+		editor.Complete = complete
+
+		line, err := editor.ReadLine("> ")
+		if err != nil {
+			t.Errorf("keys %q - unexpected error: %s", tt.keys, err)
+			continue
+		}
+
+		if line != tt.expected {
+			t.Errorf("keys %q - expected=%q, got=%q", tt.keys, tt.expected, line)
+		}
+
+		listed := strings.Contains(out.String(), "\ntotal  totals\n")
+		if listed != tt.expectedListed {
+			t.Errorf("keys %q - expected the candidates listed=%t, output=%q", tt.keys, tt.expectedListed, out.String())
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package lineedit
+
+import (
+	"errors"
+	"os"
+)
+
+// IsTerminal reports whether f is a terminal, raw mode isn't supported here so it's always false and keys are read as
+// they come
+func IsTerminal(f *os.File) bool {
+	return false
+}
+
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this system")
+}
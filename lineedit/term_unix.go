@@ -0,0 +1,51 @@
+//go:build linux || darwin
+
+package lineedit
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	_, err := getTermios(f.Fd())
+	return err == nil
+}
+
+// makeRaw turns off line buffering and echoing on f so keys can be read one by one, Ctrl-C still raises an interrupt.
+// The returned func puts f back the way it was
+func makeRaw(f *os.File) (func(), error) {
+	fd := f.Fd()
+	original, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *original
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := setTermios(fd, &raw); err != nil {
+		return nil, err
+	}
+
+	return func() { setTermios(fd, original) }, nil
+}
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	var termios syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return nil, errno
+	}
+	return &termios, nil
+}
+
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
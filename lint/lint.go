@@ -0,0 +1,144 @@
+package lint
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"waiig/ast"
+	"waiig/token"
+)
+
+// Warning is a problem found in a program, Pos is where, the zero Position when that's unknown
+type Warning struct {
+	Pos     token.Position
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Pos.Line == 0 {
+		return w.Message
+	}
+	return w.Pos.String() + ": " + w.Message
+}
+
+// UnusedVariables reports the let bindings which are never read. Scopes mirror the evaluator's environments, the
+// program has one and every function call and for loop iteration gets its own enclosed one, other blocks don't. Like
+// in the evaluator, a `let` of a name already bound in the same scope rebinds it rather than declaring another
+// variable, and functions look names up when they're called, so a function can use a binding declared after it.
+// Exported bindings are used by importers, and neither function parameters nor loop variables are reported
+func UnusedVariables(program *ast.Program) []Warning {
+	l := &linter{}
+
+	l.push()
+	ast.Walk(program, l.visit)
+	l.pop()
+
+	sort.SliceStable(l.warnings, func(i, j int) bool {
+		a, b := l.warnings[i].Pos, l.warnings[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return l.warnings
+}
+
+type binding struct {
+	pos        token.Position
+	reportable bool
+}
+
+type scope struct {
+	// bindings are keyed by name, the first let of a name is where it's reported
+	bindings map[string]*binding
+	// names read in this scope or in functions defined in it, which are only resolved once the whole scope is seen
+	references map[string]bool
+}
+
+type linter struct {
+	scopes   []*scope
+	warnings []Warning
+}
+
+func (l *linter) push() {
+	l.scopes = append(l.scopes, &scope{bindings: map[string]*binding{}, references: map[string]bool{}})
+}
+
+// pop reports the unused bindings of the innermost scope, the names it couldn't resolve belong to the scope around it
+func (l *linter) pop() {
+	s := l.scopes[len(l.scopes)-1]
+	l.scopes = l.scopes[:len(l.scopes)-1]
+
+	for name := range s.references {
+		if _, ok := s.bindings[name]; ok {
+			continue
+		}
+		if len(l.scopes) > 0 {
+			l.scopes[len(l.scopes)-1].references[name] = true
+		}
+	}
+
+	for name, b := range s.bindings {
+		if b.reportable && !s.references[name] {
+			l.warnings = append(l.warnings, Warning{Pos: b.pos, Message: fmt.Sprintf("unused variable %s", name)})
+		}
+	}
+}
+
+func (l *linter) declare(name string, pos token.Position, reportable bool) {
+	s := l.scopes[len(l.scopes)-1]
+	if _, ok := s.bindings[name]; ok {
+		return
+	}
+
+	s.bindings[name] = &binding{pos: pos, reportable: reportable}
+}
+
+func (l *linter) visit(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		ast.Walk(node.Value, l.visit)
+		l.declare(node.Name.Value, node.Name.Pos(), !node.Exported)
+		return false
+	case *ast.ImportStatement:
+		l.declare(moduleName(node.Path.Value), node.Pos(), false)
+		return false
+	case *ast.FunctionLiteral:
+		l.push()
+		for _, param := range node.Parameters {
+			l.declare(param.Value, param.Pos(), false)
+		}
+		ast.Walk(node.Body, l.visit)
+		l.pop()
+		return false
+	case *ast.ForInExpression:
+		// every iteration runs in its own environment holding the loop variables
+		ast.Walk(node.Iterable, l.visit)
+		l.push()
+		if node.IndexVar != nil {
+			l.declare(node.IndexVar.Value, node.IndexVar.Pos(), false)
+		}
+		l.declare(node.ValueVar.Value, node.ValueVar.Pos(), false)
+		ast.Walk(node.Body, l.visit)
+		l.pop()
+		return false
+	case *ast.AssignExpression:
+		// assigning to a variable doesn't use it, assigning to an element of one does, `xs[0] = 1` reads xs
+		if _, ok := node.Target.(*ast.Identifier); !ok {
+			ast.Walk(node.Target, l.visit)
+		}
+		ast.Walk(node.Value, l.visit)
+		return false
+	case *ast.Identifier:
+		l.scopes[len(l.scopes)-1].references[node.Value] = true
+	}
+
+	return true
+}
+
+// moduleName is the name an import binds, the file's base name without its extension like the evaluator does
+func moduleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
@@ -0,0 +1,73 @@
+package lint
+
+import (
+	"testing"
+	"waiig/lexer"
+	"waiig/parser"
+)
+
+func TestUnusedVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1;", []string{"line 1, col 5: unused variable x"}},
+		{"let x = 1; x", nil},
+		{"let x = 1; let y = x;", []string{"line 1, col 16: unused variable y"}},
+		// used only inside a nested function
+		{"let x = 1; let f = fn() { fn() { x } }; f()", nil},
+		// functions can use bindings declared after them
+		{"let f = fn() { g() }; let g = fn() { 1 }; f()", nil},
+		// the parameter shadows x, so the outer x is never read
+		{"let x = 1; let f = fn(x) { x }; f(2)", []string{"line 1, col 5: unused variable x"}},
+		// a let inside a function is its own variable, the outer one is still unused
+		{"let x = 1; let f = fn() { let x = 2; x }; f()", []string{"line 1, col 5: unused variable x"}},
+		{"let f = fn() { let y = 2; 1 }; f()", []string{"line 1, col 20: unused variable y"}},
+		// blocks don't have their own scope
+		{"if (true) { let y = 1 }; y", nil},
+		// rebinding a name doesn't declare another variable
+		{"let x = 1; let x = x + 1; x", nil},
+		{"let i = 0; while (i < 3) { i++ }", nil},
+		// assigning isn't reading
+		{"let x = 1; x = 2;", []string{"line 1, col 5: unused variable x"}},
+		{"let xs = [1]; xs[0] = 2;", nil},
+		{"let n = 1; let h = {}; h[n] = n.str();", nil},
+		{"export let x = 1;", nil},
+		{"let f = fn(unused) { 1 }; f(1)", nil},
+		{`import "lib/math.monkey";`, nil},
+		{"let xs = [1]; for i, x in xs { 1 }", nil},
+		{"let x = 1; for x in [2] { x }", []string{"line 1, col 5: unused variable x"}},
+		{"for x in [2] { let y = x }", []string{"line 1, col 20: unused variable y"}},
+		{"let a = 1;\nlet f = fn() {\n  let b = 2;\n  let c = 3;\n  c\n};", []string{
+			"line 1, col 5: unused variable a",
+			"line 2, col 5: unused variable f",
+			"line 3, col 7: unused variable b",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("input %q has parser errors: %v", tt.input, p.Errors())
+		}
+
+		warnings := UnusedVariables(program)
+
+		actual := []string{}
+		for _, w := range warnings {
+			actual = append(actual, w.String())
+		}
+
+		if len(actual) != len(tt.expected) {
+			t.Errorf("input %q - expected %d warnings, got=%q", tt.input, len(tt.expected), actual)
+			continue
+		}
+
+		for i, expected := range tt.expected {
+			if actual[i] != expected {
+				t.Errorf("input %q - warning %d wrong. expected=%q, got=%q", tt.input, i, expected, actual[i])
+			}
+		}
+	}
+}
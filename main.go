@@ -1,19 +1,54 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/user"
+	"waiig/evaluator"
+	"waiig/profiler"
 	"waiig/repl"
 )
 
 func main() {
-	usr, err := user.Current()
-	if err != nil {
-		panic(err)
+	profile := flag.Bool("profile", false, "print how many times each function was called to stderr once the program ends")
+	flag.Parse()
+
+	var p *profiler.Profiler
+	var opts []evaluator.Option
+	if *profile {
+		p = profiler.New()
+		opts = append(opts, evaluator.WithCallHook(p.Record))
+	}
+
+	code := 0
+
+	// `waiig program.monkey` runs the program instead of starting the REPL
+	if flag.NArg() > 0 {
+		var exit *repl.ExitError
+		if err := repl.RunFile(os.Stdout, flag.Arg(0), opts...); errors.As(err, &exit) {
+			code = exit.Code
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	} else {
+		usr, err := user.Current()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Hello %s! This is the Monkey programming language!\n",
+			usr.Username)
+		fmt.Printf("Feel free to type in commands\n")
+		if err := repl.Start(os.Stdin, os.Stdout, opts...); errors.Is(err, repl.ErrInterrupted) {
+			code = 130
+		}
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n",
-		usr.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+
+	if p != nil {
+		p.Report(os.Stderr)
+	}
+
+	os.Exit(code)
 }
@@ -2,27 +2,39 @@ package object
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
 	"hash/fnv"
+	"sort"
 	"strconv"
 	"strings"
 	"waiig/ast"
+	"waiig/token"
 )
 
 type ObjectType string
 
 const (
-	INTEGER_OBJ      = "INTEGER"
-	STRING_OBJ       = "STRING"
-	BOOLEAN_OBJ      = "BOOLEAN"
-	NULL_OBJ         = "NULL"
-	RETURN_VALUE_OBJ = "RETURN_VALUE"
-	ERROR_OBJ        = "ERROR"
-	FUNCTION_OBJ     = "FUNCTION"
-	BUILTIN_OBJ      = "BUILTIN"
-	ARRAY_OBJ        = "ARRAY"
-	RANGE_OBJ        = "RANGE"
-	HASH_OBJ         = "HASH"
+	INTEGER_OBJ        = "INTEGER"
+	STRING_OBJ         = "STRING"
+	BOOLEAN_OBJ        = "BOOLEAN"
+	NULL_OBJ           = "NULL"
+	RETURN_VALUE_OBJ   = "RETURN_VALUE"
+	BREAK_OBJ          = "BREAK"
+	CONTINUE_OBJ       = "CONTINUE"
+	EXIT_OBJ           = "EXIT"
+	ERROR_OBJ          = "ERROR"
+	FUNCTION_OBJ       = "FUNCTION"
+	BUILTIN_OBJ        = "BUILTIN"
+	ARRAY_OBJ          = "ARRAY"
+	RANGE_OBJ          = "RANGE"
+	HASH_OBJ           = "HASH"
+	SET_OBJ            = "SET"
+	STRING_BUILDER_OBJ = "STRING_BUILDER"
+	ITERATOR_OBJ       = "ITERATOR"
+	QUEUE_OBJ          = "QUEUE"
+	STACK_OBJ          = "STACK"
+	MODULE_OBJ         = "MODULE"
 )
 
 type Object interface {
@@ -39,6 +51,146 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// Comparable objects can be ordered against others of the same type, Compare returns a negative number when the
+// object is smaller than other, zero if they're equal and a positive number otherwise, or an error when other can't
+// be compared with it
+type Comparable interface {
+	Compare(other Object) (int, error)
+}
+
+// Equatable objects can be checked for equality against any other object, values are compared structurally, so two
+// arrays holding equal elements are equal, while functions are only equal to themselves
+type Equatable interface {
+	Equal(other Object) bool
+}
+
+// Equal reports whether a and b are equal, objects which aren't Equatable are only equal to themselves
+func Equal(a, b Object) bool {
+	return equal(a, b, nil)
+}
+
+// comparing is a pair of collections whose comparison is in progress
+type comparing struct {
+	a, b Object
+}
+
+// equal is Equal for collections, which can hold themselves, e.g. after `a[0] = a`. visited has the pairs of
+// collections already being compared further up, meeting one of those again means the comparison went around a cycle,
+// and the pair is taken as equal since any difference would be found elsewhere along the way
+func equal(a, b Object, visited map[comparing]bool) bool {
+	if a == b {
+		return true
+	}
+
+	switch a.(type) {
+	case *Array, *Hash, *Queue, *Stack:
+		if visited == nil {
+			visited = map[comparing]bool{}
+		}
+		if visited[comparing{a, b}] {
+			return true
+		}
+		visited[comparing{a, b}] = true
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		o, ok := b.(*Array)
+		return ok && equalElements(a.Elements, o.Elements, visited)
+	case *Queue:
+		o, ok := b.(*Queue)
+		return ok && equalElements(a.Elements, o.Elements, visited)
+	case *Stack:
+		o, ok := b.(*Stack)
+		return ok && equalElements(a.Elements, o.Elements, visited)
+	case *Hash:
+		o, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(o.Pairs) {
+			return false
+		}
+
+		for key, pair := range a.Pairs {
+			otherPair, ok := o.Pairs[key]
+			if !ok || !equal(pair.Value, otherPair.Value, visited) {
+				return false
+			}
+		}
+
+		return true
+	case Equatable:
+		return a.Equal(b)
+	default:
+		return false
+	}
+}
+
+func equalElements(a, b []Object, visited map[comparing]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i, element := range a {
+		if !equal(element, b[i], visited) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inspect is Inspect for collections, which can hold themselves like they can for equal. inspecting has the
+// collections already being inspected further up, meeting one of those again prints a placeholder instead of going
+// around the cycle forever
+func inspect(obj Object, inspecting map[Object]bool) string {
+	switch obj.(type) {
+	case *Array, *Hash, *Queue, *Stack:
+		if inspecting[obj] {
+			if _, ok := obj.(*Hash); ok {
+				return "{...}"
+			}
+			return "[...]"
+		}
+		if inspecting == nil {
+			inspecting = map[Object]bool{}
+		}
+		// only the collections on the way down count, the same array held twice side by side isn't a cycle
+		inspecting[obj] = true
+		defer delete(inspecting, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		return "[" + inspectElements(obj.Elements, inspecting) + "]"
+	case *Queue:
+		return "queue([" + inspectElements(obj.Elements, inspecting) + "])"
+	case *Stack:
+		return "stack([" + inspectElements(obj.Elements, inspecting) + "])"
+	case *Hash:
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, fmt.Sprintf("%s: %s",
+				inspect(pair.Key, inspecting), inspect(pair.Value, inspecting)))
+		}
+
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return obj.Inspect()
+	}
+}
+
+func inspectElements(elements []Object, inspecting map[Object]bool) string {
+	inspected := []string{}
+	for _, el := range elements {
+		inspected = append(inspected, inspect(el, inspecting))
+	}
+
+	return strings.Join(inspected, ", ")
+}
+
+func incomparable(a, b Object) error {
+	return fmt.Errorf("cannot compare %s with %s", a.Type(), b.Type())
+}
+
 type Integer struct {
 	Value int64
 }
@@ -52,6 +204,18 @@ func (i *Integer) Inspect() string {
 func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
+func (i *Integer) Compare(other Object) (int, error) {
+	o, ok := other.(*Integer)
+	if !ok {
+		return 0, incomparable(i, other)
+	}
+
+	return cmp.Compare(i.Value, o.Value), nil
+}
+func (i *Integer) Equal(other Object) bool {
+	o, ok := other.(*Integer)
+	return ok && i.Value == o.Value
+}
 
 type Boolean struct {
 	Value bool
@@ -74,6 +238,10 @@ func (b *Boolean) HashKey() HashKey {
 
 	return HashKey{Type: b.Type(), Value: value}
 }
+func (b *Boolean) Equal(other Object) bool {
+	o, ok := other.(*Boolean)
+	return ok && b.Value == o.Value
+}
 
 type String struct {
 	Value string
@@ -91,6 +259,18 @@ func (s *String) HashKey() HashKey {
 
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
+func (s *String) Compare(other Object) (int, error) {
+	o, ok := other.(*String)
+	if !ok {
+		return 0, incomparable(s, other)
+	}
+
+	return strings.Compare(s.Value, o.Value), nil
+}
+func (s *String) Equal(other Object) bool {
+	o, ok := other.(*String)
+	return ok && s.Value == o.Value
+}
 
 type Null struct {
 }
@@ -101,6 +281,13 @@ func (n *Null) Type() ObjectType {
 func (n *Null) Inspect() string {
 	return "null"
 }
+func (n *Null) HashKey() HashKey {
+	return HashKey{Type: n.Type(), Value: 0}
+}
+func (n *Null) Equal(other Object) bool {
+	_, ok := other.(*Null)
+	return ok
+}
 
 type ReturnValue struct {
 	Value Object
@@ -112,16 +299,80 @@ func (r *ReturnValue) Type() ObjectType {
 func (r *ReturnValue) Inspect() string {
 	return r.Value.Inspect()
 }
+func (r *ReturnValue) Equal(other Object) bool {
+	o, ok := other.(*ReturnValue)
+	return ok && Equal(r.Value, o.Value)
+}
+
+// Break and Continue are signals which, like ReturnValue, bubble up through blocks until the enclosing loop handles them
+type Break struct {
+	// Label is the label of the loop to break out of, empty for the innermost one
+	Label string
+	// Value is what the loop evaluates to, nil for a plain `break`
+	Value Object
+}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+type Continue struct {
+	// Label is the label of the loop to continue, empty for the innermost one
+	Label string
+}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+// Exit is the signal `exit` sends, like an error it unwinds everything so the program stops with Code as its status
+type Exit struct {
+	Code int64
+}
+
+func (e *Exit) Type() ObjectType {
+	return EXIT_OBJ
+}
+func (e *Exit) Inspect() string {
+	return fmt.Sprintf("exit(%d)", e.Code)
+}
 
 type Error struct {
 	Message string
+	// Pos is where in the source the error happened, the zero Position when that's unknown
+	Pos token.Position
+	// Wrapped is the error this one adds context to, nil unless it was made by `wrap_error`
+	Wrapped *Error
+	// Value is set on errors made by `error`, programs pass those around like any other value rather than them
+	// stopping evaluation
+	Value bool
 }
 
 func (e *Error) Type() ObjectType {
 	return ERROR_OBJ
 }
 func (e *Error) Inspect() string {
-	return "ERROR: " + e.Message
+	var out string
+	if e.Pos.Line == 0 {
+		out = "ERROR: " + e.Message
+	} else {
+		out = "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+
+	if e.Wrapped != nil {
+		out += "\ncaused by: " + e.Wrapped.Message
+	}
+	return out
+}
+func (e *Error) Equal(other Object) bool {
+	o, ok := other.(*Error)
+	return ok && e.Message == o.Message
 }
 
 type Function struct {
@@ -129,6 +380,8 @@ type Function struct {
 	Body       *ast.BlockStatement
 	// We have this Env here to allow for closures, which "close over" the env they're defined in and can later access it
 	Env *Environment
+	// Name is the name of the let binding the function was first bound to, empty for anonymous functions
+	Name string
 }
 
 func (f *Function) Type() ObjectType {
@@ -152,10 +405,16 @@ func (f *Function) Inspect() string {
 
 	return out.String()
 }
+func (f *Function) Equal(other Object) bool {
+	return f == other
+}
 
 type Environment struct {
 	outer *Environment
 	store map[string]Object
+	// exports are the names exported with `export let`, only they are visible to whoever imports the module this is
+	// the environment of
+	exports map[string]bool
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -167,7 +426,7 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, exports: map[string]bool{}}
 }
 
 func (e *Environment) Set(name string, value Object) Object {
@@ -175,6 +434,32 @@ func (e *Environment) Set(name string, value Object) Object {
 	return value
 }
 
+// SetIfAbsent binds name to value unless this environment already has a binding for it, outer environments aren't
+// looked at, it reports whether value was bound
+func (e *Environment) SetIfAbsent(name string, value Object) bool {
+	if _, ok := e.store[name]; ok {
+		return false
+	}
+
+	e.store[name] = value
+	return true
+}
+
+// Assign updates an existing binding in whichever environment, this one or an outer one, it was defined in,
+// returning false when there's no such binding
+func (e *Environment) Assign(name string, value Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = value
+		return true
+	}
+
+	if e.outer != nil {
+		return e.outer.Assign(name, value)
+	}
+
+	return false
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	value, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -183,17 +468,81 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return value, ok
 }
 
+// Export marks name as exported from this environment
+func (e *Environment) Export(name string) {
+	e.exports[name] = true
+}
+
+// IsExported reports whether name was exported from this environment, outer environments aren't looked at
+func (e *Environment) IsExported(name string) bool {
+	return e.exports[name]
+}
+
+// Outer returns the environment this one is enclosed in, nil for an outermost one
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Bindings returns a copy of the bindings made in this environment, not including those of outer ones
+func (e *Environment) Bindings() map[string]Object {
+	bindings := make(map[string]Object, len(e.store))
+	for name, value := range e.store {
+		bindings[name] = value
+	}
+	return bindings
+}
+
+// Names returns the names of all the bindings visible from this environment, including those of outer ones, in no
+// particular order
+func (e *Environment) Names() []string {
+	names := []string{}
+	for name := range e.store {
+		names = append(names, name)
+	}
+
+	if e.outer != nil {
+		names = append(names, e.outer.Names()...)
+	}
+
+	return names
+}
+
+// Module is an imported file, Env holds the bindings made by evaluating it
+type Module struct {
+	Name string
+	Path string
+	Env  *Environment
+}
+
+func (m *Module) Type() ObjectType {
+	return MODULE_OBJ
+}
+func (m *Module) Inspect() string {
+	return "module " + m.Name
+}
+func (m *Module) Equal(other Object) bool {
+	return m == other
+}
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
-	Fn BuiltinFunction
+	// Name is the name the builtin is bound to, empty for the ones made on the fly like `curry`'s results
+	Name string
+	Fn   BuiltinFunction
 }
 
 func (bi *Builtin) Type() ObjectType {
 	return BUILTIN_OBJ
 }
 func (bi *Builtin) Inspect() string {
-	return "builtin function"
+	if bi.Name == "" {
+		return "builtin function"
+	}
+	return "builtin function `" + bi.Name + "`"
+}
+func (bi *Builtin) Equal(other Object) bool {
+	return bi == other
 }
 
 type Array struct {
@@ -205,18 +554,10 @@ func (arr *Array) Type() ObjectType {
 }
 
 func (arr *Array) Inspect() string {
-	var out bytes.Buffer
-
-	elements := []string{}
-	for _, p := range arr.Elements {
-		elements = append(elements, p.Inspect())
-	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-
-	return out.String()
+	return inspect(arr, nil)
+}
+func (arr *Array) Equal(other Object) bool {
+	return equal(arr, other, nil)
 }
 
 type Range struct {
@@ -237,6 +578,10 @@ func (rg *Range) Inspect() string {
 
 	return out.String()
 }
+func (rg *Range) Equal(other Object) bool {
+	o, ok := other.(*Range)
+	return ok && rg.From == o.From && rg.ToExclusive == o.ToExclusive
+}
 
 type HashPair struct {
 	Key   Object
@@ -254,17 +599,133 @@ func (h *Hash) Type() ObjectType {
 }
 
 func (h *Hash) Inspect() string {
+	return inspect(h, nil)
+}
+func (h *Hash) Equal(other Object) bool {
+	return equal(h, other, nil)
+}
+
+// Set holds distinct Hashable elements, keyed by their HashKey like a Hash's pairs
+type Set struct {
+	Elements map[HashKey]Object
+}
+
+func (st *Set) Type() ObjectType {
+	return SET_OBJ
+}
+
+func (st *Set) Inspect() string {
 	var out bytes.Buffer
 
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+	elements := []string{}
+	for _, el := range st.Sorted() {
+		elements = append(elements, el.Inspect())
 	}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+	out.WriteString("set([")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("])")
 
 	return out.String()
 }
+
+// Sorted returns the elements in a stable order, grouped by type and ordered within a type by Compare when they're
+// Comparable, by Inspect otherwise
+func (st *Set) Sorted() []Object {
+	elements := make([]Object, 0, len(st.Elements))
+	for _, el := range st.Elements {
+		elements = append(elements, el)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		a, b := elements[i], elements[j]
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+		if comparable, ok := a.(Comparable); ok {
+			if c, err := comparable.Compare(b); err == nil {
+				return c < 0
+			}
+		}
+		return a.Inspect() < b.Inspect()
+	})
+
+	return elements
+}
+
+func (st *Set) Equal(other Object) bool {
+	o, ok := other.(*Set)
+	if !ok || len(st.Elements) != len(o.Elements) {
+		return false
+	}
+
+	for key := range st.Elements {
+		if _, ok := o.Elements[key]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Queue holds its elements in the order they were enqueued, front first. Like Array it's never changed in place,
+// enqueueing or dequeueing produces a new Queue
+type Queue struct {
+	Elements []Object
+}
+
+func (q *Queue) Type() ObjectType {
+	return QUEUE_OBJ
+}
+
+func (q *Queue) Inspect() string {
+	return inspect(q, nil)
+}
+func (q *Queue) Equal(other Object) bool {
+	return equal(q, other, nil)
+}
+
+// Stack holds its elements in the order they were pushed, so the top is the last one. Like Queue pushing or popping
+// produces a new Stack
+type Stack struct {
+	Elements []Object
+}
+
+func (st *Stack) Type() ObjectType {
+	return STACK_OBJ
+}
+
+func (st *Stack) Inspect() string {
+	return inspect(st, nil)
+}
+func (st *Stack) Equal(other Object) bool {
+	return equal(st, other, nil)
+}
+
+// StringBuilder accumulates a string in place, so building one piece by piece doesn't copy everything built so far on
+// every step like `s = s + piece` does. It's mutable, so unlike String it isn't Hashable and it's only equal to itself
+type StringBuilder struct {
+	Builder strings.Builder
+}
+
+func (sb *StringBuilder) Type() ObjectType {
+	return STRING_BUILDER_OBJ
+}
+
+func (sb *StringBuilder) Inspect() string {
+	return sb.Builder.String()
+}
+
+// Iterator produces its values one at a time, only when they're asked for, Next returns the next one, or false once
+// there are no more. A value can be an Error, which stops whatever is consuming the iterator
+type Iterator struct {
+	Next func() (Object, bool)
+}
+
+func (it *Iterator) Type() ObjectType {
+	return ITERATOR_OBJ
+}
+
+func (it *Iterator) Inspect() string {
+	return "iterator"
+}
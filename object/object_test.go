@@ -0,0 +1,265 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		left     Comparable
+		right    Object
+		expected int
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1},
+		{&Integer{Value: 2}, &Integer{Value: 2}, 0},
+		{&Integer{Value: 3}, &Integer{Value: -3}, 1},
+		{&String{Value: "a"}, &String{Value: "b"}, -1},
+		{&String{Value: "abc"}, &String{Value: "abc"}, 0},
+		{&String{Value: "b"}, &String{Value: "abc"}, 1},
+		{&String{Value: ""}, &String{Value: "a"}, -1},
+	}
+
+	for _, tt := range tests {
+		actual, err := tt.left.Compare(tt.right)
+		if err != nil {
+			t.Errorf("unexpected error comparing %v with %v: %s", tt.left, tt.right.Inspect(), err)
+			continue
+		}
+
+		if actual != tt.expected {
+			t.Errorf("comparing %v with %s - expected=%d, got=%d", tt.left, tt.right.Inspect(), tt.expected, actual)
+		}
+	}
+}
+
+func TestCompareIncompatibleTypes(t *testing.T) {
+	tests := []struct {
+		left     Comparable
+		right    Object
+		expected string
+	}{
+		{&Integer{Value: 1}, &String{Value: "1"}, "cannot compare INTEGER with STRING"},
+		{&String{Value: "1"}, &Integer{Value: 1}, "cannot compare STRING with INTEGER"},
+		{&Integer{Value: 1}, &Null{}, "cannot compare INTEGER with NULL"},
+	}
+
+	for _, tt := range tests {
+		actual, err := tt.left.Compare(tt.right)
+		if err == nil {
+			t.Errorf("expected error comparing %v with %s, got none", tt.left, tt.right.Inspect())
+			continue
+		}
+
+		if actual != 0 {
+			t.Errorf("incomparable values should compare as 0. got=%d", actual)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	fn := &Function{}
+	builtin := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{&Integer{Value: 1}, &Integer{Value: 2}, false},
+		{&Integer{Value: 1}, &String{Value: "1"}, false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{&String{Value: "a"}, &String{Value: "b"}, false},
+		{&Boolean{Value: true}, &Boolean{Value: true}, true},
+		{&Boolean{Value: true}, &Boolean{Value: false}, false},
+		{&Null{}, &Null{}, true},
+		{&Null{}, &Boolean{Value: false}, false},
+		{&Range{From: 1, ToExclusive: 3}, &Range{From: 1, ToExclusive: 3}, true},
+		{&Range{From: 1, ToExclusive: 3}, &Range{From: 1, ToExclusive: 4}, false},
+		{&Error{Message: "boom"}, &Error{Message: "boom"}, true},
+		{fn, fn, true},
+		{fn, &Function{}, false},
+		{builtin, builtin, true},
+		{builtin, &Builtin{}, false},
+		{&ReturnValue{Value: &Integer{Value: 1}}, &ReturnValue{Value: &Integer{Value: 1}}, true},
+		{array(1, array("a", true), &Null{}), array(1, array("a", true), &Null{}), true},
+		{array(1, array("a", true)), array(1, array("a", false)), false},
+		{array(1, 2), array(1, 2, 3), false},
+		{array(), array(), true},
+		{array(1), &Integer{Value: 1}, false},
+		{
+			hash("a", array(1, hash("b", 2)), "c", true),
+			hash("c", true, "a", array(1, hash("b", 2))),
+			true,
+		},
+		{hash("a", array(1, hash("b", 2))), hash("a", array(1, hash("b", 3))), false},
+		{hash("a", 1), hash("a", 1, "b", 2), false},
+		{hash("a", 1), hash("b", 1), false},
+		{hash(), hash(), true},
+		{set(1, "a", true), set(true, 1, "a"), true},
+		{set(1, 2), set(1, 3), false},
+		{set(1), set(1, 2), false},
+		{set(), set(), true},
+		{set(1), array(1), false},
+	}
+
+	for _, tt := range tests {
+		if actual := Equal(tt.a, tt.b); actual != tt.expected {
+			t.Errorf("Equal(%s, %s) - expected=%t, got=%t", tt.a.Inspect(), tt.b.Inspect(), tt.expected, actual)
+		}
+
+		if actual := Equal(tt.b, tt.a); actual != tt.expected {
+			t.Errorf("Equal(%s, %s) - expected=%t, got=%t", tt.b.Inspect(), tt.a.Inspect(), tt.expected, actual)
+		}
+	}
+}
+
+func TestEqualSelfReferential(t *testing.T) {
+	// a = [1, a] and b = [1, b] unroll to the same infinite array
+	a, b := array(1), array(1)
+	a.Elements = append(a.Elements, a)
+	b.Elements = append(b.Elements, b)
+
+	h := hash("self", 1)
+	h.Pairs[(&String{Value: "self"}).HashKey()] = HashPair{Key: &String{Value: "self"}, Value: h}
+	q := &Queue{Elements: []Object{array(2)}}
+	q.Elements[0].(*Array).Elements = append(q.Elements[0].(*Array).Elements, q)
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{a, a, true},
+		{a, b, true},
+		{a, array(1, array(1, 2)), false},
+		{h, h, true},
+		{h, hash("self", hash("self", 1)), false},
+		{q, q, true},
+		{q, &Queue{Elements: []Object{array(2, q)}}, true},
+	}
+
+	for _, tt := range tests {
+		if actual := Equal(tt.a, tt.b); actual != tt.expected {
+			t.Errorf("Equal(%T, %T) - expected=%t, got=%t", tt.a, tt.b, tt.expected, actual)
+		}
+	}
+}
+
+func TestInspectSelfReferential(t *testing.T) {
+	a := array(1)
+	a.Elements = append(a.Elements, a)
+
+	h := hash("self", 1)
+	h.Pairs[(&String{Value: "self"}).HashKey()] = HashPair{Key: &String{Value: "self"}, Value: h}
+	q := &Queue{Elements: []Object{array(2)}}
+	q.Elements[0].(*Array).Elements = append(q.Elements[0].(*Array).Elements, q)
+
+	// the same array twice side by side isn't a cycle, so it's printed in full both times
+	shared := array(1)
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{a, "[1, [...]]"},
+		{h, "{self: {...}}"},
+		{q, "queue([[2, [...]]])"},
+		{array(shared, shared), "[[1], [1]]"},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.obj.Inspect(); actual != tt.expected {
+			t.Errorf("wrong Inspect. expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func toObject(value interface{}) Object {
+	switch value := value.(type) {
+	case int:
+		return &Integer{Value: int64(value)}
+	case string:
+		return &String{Value: value}
+	case bool:
+		return &Boolean{Value: value}
+	case Object:
+		return value
+	default:
+		panic("unsupported value")
+	}
+}
+
+func array(elements ...interface{}) *Array {
+	arr := &Array{Elements: []Object{}}
+	for _, element := range elements {
+		arr.Elements = append(arr.Elements, toObject(element))
+	}
+
+	return arr
+}
+
+// hash builds a hash from alternating keys and values
+func hash(keysAndValues ...interface{}) *Hash {
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := toObject(keysAndValues[i])
+		h.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: toObject(keysAndValues[i+1])}
+	}
+
+	return h
+}
+
+func set(elements ...interface{}) *Set {
+	st := &Set{Elements: map[HashKey]Object{}}
+	for _, element := range elements {
+		el := toObject(element)
+		st.Elements[el.(Hashable).HashKey()] = el
+	}
+
+	return st
+}
+
+func TestSetInspectIsSorted(t *testing.T) {
+	st := set(10, "b", 2, true, "a", -1, false, &Null{})
+	expected := "set([false, true, -1, 2, 10, null, a, b])"
+
+	// map iteration order changes between runs, so render it a few times
+	for i := 0; i < 10; i++ {
+		if actual := st.Inspect(); actual != expected {
+			t.Fatalf("wrong Inspect. expected=%q, got=%q", expected, actual)
+		}
+	}
+}
+
+func TestEnvironmentSetIfAbsent(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("shadowed", &Integer{Value: 1})
+	env := NewEnclosedEnvironment(outer)
+
+	if !env.SetIfAbsent("x", &Integer{Value: 1}) {
+		t.Errorf("expected x to be set")
+	}
+	if x, _ := env.Get("x"); !Equal(x, &Integer{Value: 1}) {
+		t.Errorf("wrong x. expected=1, got=%v", x)
+	}
+
+	if env.SetIfAbsent("x", &Integer{Value: 2}) {
+		t.Errorf("expected x not to be set again")
+	}
+	if x, _ := env.Get("x"); !Equal(x, &Integer{Value: 1}) {
+		t.Errorf("x was overwritten. expected=1, got=%v", x.Inspect())
+	}
+
+	// only this environment is looked at, so a name bound in an outer one gets shadowed
+	if !env.SetIfAbsent("shadowed", &Integer{Value: 2}) {
+		t.Errorf("expected shadowed to be set in the enclosed environment")
+	}
+	if shadowed, _ := env.Get("shadowed"); !Equal(shadowed, &Integer{Value: 2}) {
+		t.Errorf("wrong shadowed. expected=2, got=%v", shadowed.Inspect())
+	}
+	if shadowed, _ := outer.Get("shadowed"); !Equal(shadowed, &Integer{Value: 1}) {
+		t.Errorf("outer binding changed. expected=1, got=%v", shadowed.Inspect())
+	}
+}
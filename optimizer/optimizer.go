@@ -0,0 +1,32 @@
+package optimizer
+
+import "waiig/ast"
+
+// Pass is a single AST transformation, passes may modify the program in place
+type Pass interface {
+	Transform(*ast.Program) *ast.Program
+}
+
+type Pipeline struct {
+	passes []Pass
+}
+
+func New(passes ...Pass) *Pipeline {
+	return &Pipeline{passes: passes}
+}
+
+// Run applies all the passes in order, over and over until a whole round of them leaves the program unchanged, since
+// one pass can open up opportunities for another, e.g. folding `1 + 1` might leave a `let` which is no longer used
+func (p *Pipeline) Run(program *ast.Program) *ast.Program {
+	for {
+		before := program.String()
+
+		for _, pass := range p.passes {
+			program = pass.Transform(program)
+		}
+
+		if program.String() == before {
+			return program
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package optimizer
+
+import (
+	"testing"
+	"waiig/ast"
+	"waiig/evaluator"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+)
+
+func TestConstantFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"-(2 - 5)", "3"},
+		{"10 / 2 > 4", "true"},
+		{"!(1 == 2)", "true"},
+		{"!null", "true"},
+		{`"a" + "b" == "ab"`, "true"},
+		{"true != false", "true"},
+		{"x + 1 * 2", "(x + 2)"},
+		{"1 / 0", "(1 / 0)"},
+		{`1 + "a"`, "(1 + a)"},
+		{"add(1 + 1, [2 * 2])", "add(2, [4])"},
+		{"fn(x) { x * (3 - 1) }", "fn(x) {\n    (x * 2)\n}"},
+	}
+
+	for _, tt := range tests {
+		program := New(ConstantFold{}).Run(parse(t, tt.input))
+
+		if program.String() != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestDeadCodeElim(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1; return 2; 3; 4", "1return 2;"},
+		{"fn() { return 1; puts(2) }", "fn() {\n    return 1;\n}"},
+		{"if (x) { return 1; 2 } else { 3 }", "ifx {\n    return 1;\n}else {\n    3\n}"},
+		{"1; 2", "12"},
+	}
+
+	for _, tt := range tests {
+		program := New(DeadCodeElim{}).Run(parse(t, tt.input))
+
+		if program.String() != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestPruneUnusedLet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; let y = 2; y", "let y = 2;y"},
+		// y is only used by x, so once x is gone y is unused as well
+		{"let y = 2; let x = y; 3", "3"},
+		{"let x = puts(1); 2", "let x = puts(1);2"},
+		{"let x = [1, fn() { 2 }]; 2", "2"},
+		{"let f = fn() { let unused = 1; 2 }; f()", "let f = fn() {\n    2\n};f()"},
+		{"let x = 1", "let x = 1;"},
+	}
+
+	for _, tt := range tests {
+		program := New(PruneUnusedLet{}).Run(parse(t, tt.input))
+
+		if program.String() != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	input := `
+let unused = 2 * 10;
+let ten = 5 + 5;
+let f = fn(x) {
+	return x * (1 + 1);
+	puts("never");
+};
+return f(ten);
+puts("never");
+`
+	expected := "let ten = 10;let f = fn(x) {\n    return (x * 2);\n};return f(ten);"
+
+	program := parse(t, input)
+	before := evaluator.Eval(parse(t, input), object.NewEnvironment())
+
+	program = New(ConstantFold{}, DeadCodeElim{}, PruneUnusedLet{}).Run(program)
+
+	if program.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, program.String())
+	}
+
+	after := evaluator.Eval(program, object.NewEnvironment())
+	if after.Inspect() != before.Inspect() {
+		t.Errorf("optimized program evaluates differently. before=%s, after=%s", before.Inspect(), after.Inspect())
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("input %q has parser errors: %v", input, p.Errors())
+	}
+
+	return program
+}
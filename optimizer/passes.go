@@ -0,0 +1,230 @@
+package optimizer
+
+import (
+	"strconv"
+	"waiig/ast"
+	"waiig/token"
+)
+
+// ConstantFold replaces operations on literals with their result, e.g. `2 * 3` becomes `6` and `!true` becomes `false`.
+// Anything which would fail at runtime, like dividing by zero or adding a string to an integer, is left alone so it
+// still fails in the same way
+type ConstantFold struct{}
+
+func (ConstantFold) Transform(program *ast.Program) *ast.Program {
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.InfixExpression:
+			return foldInfixExpression(node)
+		case *ast.PrefixExpression:
+			return foldPrefixExpression(node)
+		}
+
+		return node
+	})
+
+	return program
+}
+
+func foldInfixExpression(node *ast.InfixExpression) ast.Expression {
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := node.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		switch node.Operator {
+		case "+":
+			return integerLiteral(left.Value + right.Value)
+		case "-":
+			return integerLiteral(left.Value - right.Value)
+		case "*":
+			return integerLiteral(left.Value * right.Value)
+		case "/":
+			if right.Value == 0 {
+				return node
+			}
+			return integerLiteral(left.Value / right.Value)
+		case "<":
+			return booleanLiteral(left.Value < right.Value)
+		case ">":
+			return booleanLiteral(left.Value > right.Value)
+		case "==":
+			return booleanLiteral(left.Value == right.Value)
+		case "!=":
+			return booleanLiteral(left.Value != right.Value)
+		}
+	case *ast.StringLiteral:
+		right, ok := node.Right.(*ast.StringLiteral)
+		if !ok {
+			return node
+		}
+
+		switch node.Operator {
+		case "+":
+			return stringLiteral(left.Value + right.Value)
+		case "==":
+			return booleanLiteral(left.Value == right.Value)
+		case "!=":
+			return booleanLiteral(left.Value != right.Value)
+		}
+	case *ast.Boolean:
+		right, ok := node.Right.(*ast.Boolean)
+		if !ok {
+			return node
+		}
+
+		switch node.Operator {
+		case "==":
+			return booleanLiteral(left.Value == right.Value)
+		case "!=":
+			return booleanLiteral(left.Value != right.Value)
+		}
+	}
+
+	return node
+}
+
+func foldPrefixExpression(node *ast.PrefixExpression) ast.Expression {
+	switch right := node.Right.(type) {
+	case *ast.IntegerLiteral:
+		switch node.Operator {
+		case "-":
+			return integerLiteral(-right.Value)
+		case "!":
+			return booleanLiteral(false)
+		}
+	case *ast.Boolean:
+		if node.Operator == "!" {
+			return booleanLiteral(!right.Value)
+		}
+	case *ast.Null:
+		if node.Operator == "!" {
+			return booleanLiteral(true)
+		}
+	}
+
+	return node
+}
+
+// DeadCodeElim removes the statements following a `return`, since they can never run
+type DeadCodeElim struct{}
+
+func (DeadCodeElim) Transform(program *ast.Program) *ast.Program {
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Program:
+			node.Statements = removeAfterReturn(node.Statements)
+		case *ast.BlockStatement:
+			node.Statements = removeAfterReturn(node.Statements)
+		}
+
+		return node
+	})
+
+	return program
+}
+
+func removeAfterReturn(statements []ast.Statement) []ast.Statement {
+	for i, statement := range statements {
+		if _, ok := statement.(*ast.ReturnStatement); ok {
+			return statements[:i+1]
+		}
+	}
+
+	return statements
+}
+
+// PruneUnusedLet removes `let` bindings whose name isn't referenced anywhere in the program. A name counts as used if
+// it appears anywhere at all, regardless of scope, and only bindings to values without side effects are removed, so
+// `let x = puts(1)` stays. The last statement of a block is always kept as it's the block's value
+type PruneUnusedLet struct{}
+
+func (PruneUnusedLet) Transform(program *ast.Program) *ast.Program {
+	used := map[string]bool{}
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		if ident, ok := node.(*ast.Identifier); ok {
+			used[ident.Value] = true
+		}
+
+		return node
+	})
+
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Program:
+			node.Statements = removeUnusedLets(node.Statements, used)
+		case *ast.BlockStatement:
+			node.Statements = removeUnusedLets(node.Statements, used)
+		}
+
+		return node
+	})
+
+	return program
+}
+
+func removeUnusedLets(statements []ast.Statement, used map[string]bool) []ast.Statement {
+	kept := []ast.Statement{}
+
+	for i, statement := range statements {
+		let, ok := statement.(*ast.LetStatement)
+		if ok && i < len(statements)-1 && !used[let.Name.Value] && isPure(let.Value) {
+			continue
+		}
+
+		kept = append(kept, statement)
+	}
+
+	return kept
+}
+
+// isPure reports whether evaluating exp can't have side effects, reading an identifier is assumed to always succeed
+func isPure(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.Null, *ast.Identifier, *ast.FunctionLiteral:
+		return true
+	case *ast.ArrayLiteral:
+		for _, element := range exp.Elements {
+			if !isPure(element) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		for _, pair := range exp.Pairs {
+			switch pair.Key.(type) {
+			case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+			default:
+				return false
+			}
+
+			if !isPure(pair.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func integerLiteral(value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{
+		Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10)},
+		Value: value,
+	}
+}
+
+func booleanLiteral(value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+	}
+
+	return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+}
+
+func stringLiteral(value string) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: value}, Value: value}
+}
@@ -11,29 +11,43 @@ import (
 const (
 	_ int = iota
 	LOWEST
-	RANGE       // 2:7
+	ASSIGN      // x = 5
+	COALESCE    // x ?? 5
+	PIPE        // x |> f
 	HASH_INIT   // {"foo": 1}
 	EQUALS      // ==
 	LESSGREATER // > or <
+	RANGE       // 2:7
 	SUM         // +
 	PRODUCT     // *
+	COMPOSE     // f >> g or f << g
 	PREFIX      // -X or !X
+	POSTFIX     // X++ or X--
 	CALL        // myFunction(X)
-	INDEX       // arr[1]
+	INDEX       // arr[1] or arr.len()
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.COLON:    RANGE,
-	token.LPAREN:   CALL,
-	token.LBRCKT:   INDEX,
+	token.ASSIGN:    ASSIGN,
+	token.COALESCE:  COALESCE,
+	token.PIPE:      PIPE,
+	token.EQ:        EQUALS,
+	token.NOT_EQ:    EQUALS,
+	token.LT:        LESSGREATER,
+	token.GT:        LESSGREATER,
+	token.PLUS:      SUM,
+	token.MINUS:     SUM,
+	token.SLASH:     PRODUCT,
+	token.ASTERISK:  PRODUCT,
+	token.FWDARROW:  COMPOSE,
+	token.BWDARROW:  COMPOSE,
+	token.COLON:     RANGE,
+	token.INCREMENT: POSTFIX,
+	token.DECREMENT: POSTFIX,
+	token.LPAREN:    CALL,
+	token.LBRCKT:    INDEX,
+	token.DOT:       INDEX,
+	token.OPT_DOT:   INDEX,
 }
 
 type (
@@ -53,12 +67,57 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// labels of the loops enclosing the current token, innermost last, so `break label` can be told apart from
+	// `break value`
+	labels []string
+
+	// expressions which were wrapped in parentheses, a grouped comparison on the left of another one isn't merged into
+	// a chain with it
+	grouped map[ast.Expression]bool
+
+	// how many brackets the tokens so far have left open, and how many were open when the hash key being parsed
+	// started, -1 outside of keys. A `:` at the key's own nesting ends it rather than making a range
+	nesting    int
+	keyNesting int
+
+	strictSemicolons bool
+	trailingCommas   bool
+	maxErrors        int
 }
 
-func New(l *lexer.Lexer) *Parser {
+// Option configures how a Parser behaves, options are passed to New
+type Option func(*Parser)
+
+// WithStrictSemicolons makes the semicolon after a statement mandatory, only the last statement of a block can leave it
+// out
+func WithStrictSemicolons() Option {
+	return func(p *Parser) {
+		p.strictSemicolons = true
+	}
+}
+
+// WithTrailingCommas allows a comma after the last element of array literals, call arguments and function parameters,
+// hash literals always allow one
+func WithTrailingCommas() Option {
+	return func(p *Parser) {
+		p.trailingCommas = true
+	}
+}
+
+// WithMaxErrors stops parsing once n errors were found, n <= 0 means there's no limit
+func WithMaxErrors(n int) Option {
+	return func(p *Parser) {
+		p.maxErrors = n
+	}
+}
+
+func New(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:          l,
+		errors:     []string{},
+		grouped:    map[ast.Expression]bool{},
+		keyNesting: -1,
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
@@ -69,24 +128,42 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNull)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.WHILE, p.parseWhileExpression)
+	p.registerPrefix(token.DO, p.parseDoWhileExpression)
+	p.registerPrefix(token.LOOP, p.parseLoopExpression)
+	p.registerPrefix(token.FOR, p.parseForInExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRCKT, p.parseArrayLiteral)
-	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.LBRACE, p.parseBraceExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.FWDARROW, p.parseInfixExpression)
+	p.registerInfix(token.BWDARROW, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
-	p.registerInfix(token.LT, p.parseInfixExpression)
-	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT, p.parseComparisonExpression)
+	p.registerInfix(token.GT, p.parseComparisonExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRCKT, p.parseIndexExpression)
 	p.registerInfix(token.COLON, p.parseRangeExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
+	p.registerInfix(token.DOT, p.parseDotExpression)
+	p.registerInfix(token.OPT_DOT, p.parseDotExpression)
+	p.registerInfix(token.COALESCE, p.parseCoalesceExpression)
+	p.registerInfix(token.INCREMENT, p.parsePostfixExpression)
+	p.registerInfix(token.DECREMENT, p.parsePostfixExpression)
+
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -95,6 +172,47 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// ParseExpression parses input as a single expression, anything but an optional semicolon after it is reported as an
+// error, the expression is nil whenever there are errors
+func ParseExpression(input string) (ast.Expression, []string) {
+	p := New(lexer.New(input))
+
+	exp := p.parseExpression(LOWEST)
+	p.expectEnd()
+
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+
+	return exp, nil
+}
+
+// ParseStatement parses input as a single statement, anything after it is reported as an error, the statement is nil
+// whenever there are errors
+func ParseStatement(input string) (ast.Statement, []string) {
+	p := New(lexer.New(input))
+
+	stmt := p.parseStatement()
+	p.expectEnd()
+
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+
+	return stmt, nil
+}
+
+// expectEnd skips an optional trailing semicolon and errors if there's anything left in the input
+func (p *Parser) expectEnd() {
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if !p.peekTokenIs(token.EOF) {
+		p.appendPeekError(token.EOF)
+	}
+}
+
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
@@ -109,19 +227,39 @@ func (p *Parser) Errors() []string {
 
 func (p *Parser) appendPeekError(expected token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", expected, p.peekToken.Type)
+	p.appendError(msg)
+}
+
+// appendError records msg unless the parser already found as many errors as WithMaxErrors allows
+func (p *Parser) appendError(msg string) {
+	if p.tooManyErrors() {
+		return
+	}
+
 	p.errors = append(p.errors, msg)
 }
 
+func (p *Parser) tooManyErrors() bool {
+	return p.maxErrors > 0 && len(p.errors) >= p.maxErrors
+}
+
 func (p *Parser) nextToken() {
 	p.currToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.currToken.Type {
+	case token.LPAREN, token.LBRCKT, token.LBRACE:
+		p.nesting++
+	case token.RPAREN, token.RBRCKT, token.RBRACE:
+		p.nesting--
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	for !p.currTokenIs(token.EOF) {
+	for !p.currTokenIs(token.EOF) && !p.tooManyErrors() {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
@@ -143,7 +281,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.currToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.appendError(msg)
 		return nil
 	}
 
@@ -160,26 +298,68 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	return arr
 }
 
-func (p *Parser) parseHashLiteral() ast.Expression {
-	hash := &ast.HashLiteral{
-		Token: p.currToken,
-		Pairs: p.parseHashLiteralPairs(),
+// parseBraceExpression parses what starts with a `{` in an expression, a hash literal when it's empty or its first
+// expression is followed by a `:`, a block expression like `{ let x = 2; x * 3 }` otherwise. So `{a: 1}` is a hash
+// even though `a:1` on its own is a range, wrap the range in parentheses for a block holding one. A name followed by
+// `:` and a loop is the exception, that's a labeled loop starting a block
+func (p *Parser) parseBraceExpression() ast.Expression {
+	brace := p.currToken
+
+	if p.peekTokenIs(token.RBRACE) {
+		return &ast.HashLiteral{Token: brace, Pairs: p.parseHashLiteralPairs(nil)}
+	}
+
+	switch p.peekToken.Type {
+	case token.LET, token.RETURN, token.BREAK, token.CONTINUE, token.IMPORT, token.EXPORT:
+		return p.parseBlockStatement()
 	}
-	return hash
-}
 
-func (p *Parser) parseHashLiteralPairs() map[ast.Expression]ast.Expression {
-	pairs := make(map[ast.Expression]ast.Expression)
+	start := p.peekToken
+	first := p.parseHashKey()
+	if first == nil {
+		return nil
+	}
 
-	for !p.peekTokenIs(token.RBRACE) {
+	// `{ outer: loop { ... } }` is a block starting with a labeled loop, like it would be as a statement, rather than a
+	// hash whose value is a loop
+	if _, ok := first.(*ast.Identifier); ok && p.peekTokenIs(token.COLON) && isLoopToken(p.l.Peek().Type) {
+		stmt := p.parseLabeledLoop()
+		if stmt == nil {
+			return nil
+		}
+
+		block := &ast.BlockStatement{Token: brace, Statements: []ast.Statement{stmt}}
 		p.nextToken()
 
-		// Here comes trouble.. the problem i'm facing is that this parseExpression will parse the `key:value` as a RangeExpression
-		// rather than a Key:Value, bumping the precedence fixes this, but disallows RangeExpressions as keys, which tbh
-		// should not be allowed but I was trying to allow it for the sake of trying to solve a parsing conflict, not sure how
-		// we'd do it without some extensive lookahead to find a ':' before the ',' so we could determine that we're
-		// parsing a range and that there will be another ':' afterward(and before the ',' or '}')
-		key := p.parseExpression(HASH_INIT)
+		return p.parseBlockStatements(block)
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		return &ast.HashLiteral{Token: brace, Pairs: p.parseHashLiteralPairs(first)}
+	}
+
+	// what was parsed as a key is the start of the block's first statement
+	stmt := &ast.ExpressionStatement{Token: start, Expression: p.parseOperators(first, LOWEST)}
+	p.endStatement()
+
+	block := &ast.BlockStatement{Token: brace, Statements: []ast.Statement{stmt}}
+	p.nextToken()
+
+	return p.parseBlockStatements(block)
+}
+
+// parseHashLiteralPairs parses the pairs up to the closing `}`, starting with the one whose key is firstKey when it
+// has already been parsed
+func (p *Parser) parseHashLiteralPairs(firstKey ast.Expression) []ast.HashPair {
+	pairs := []ast.HashPair{}
+
+	for firstKey != nil || !p.peekTokenIs(token.RBRACE) {
+		key := firstKey
+		firstKey = nil
+
+		if key == nil {
+			key = p.parseHashKey()
+		}
 
 		if !p.expectPeek(token.COLON) {
 			return nil
@@ -187,10 +367,12 @@ func (p *Parser) parseHashLiteralPairs() map[ast.Expression]ast.Expression {
 
 		p.nextToken()
 
-		value := p.parseExpression(HASH_INIT)
+		// nothing after the value can be mistaken for the ':' so it's a full expression, unlike the key
+		value := p.parseExpression(LOWEST)
 
-		pairs[key] = value
+		pairs = append(pairs, ast.HashPair{Key: key, Value: value})
 
+		// the comma after the last pair is optional, `{a: 1, b: 2,}` is fine as the loop stops at the `}` after it
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
@@ -203,6 +385,18 @@ func (p *Parser) parseHashLiteralPairs() map[ast.Expression]ast.Expression {
 	return pairs
 }
 
+// parseHashKey parses the expression after the current token as a hash key, anything binding tighter than `|>` except
+// a range, since the `:` after the key would be taken for one. Ranges in brackets are fine, as in `{(1:3): "x"}`
+func (p *Parser) parseHashKey() ast.Expression {
+	outer := p.keyNesting
+	p.keyNesting = p.nesting
+	defer func() { p.keyNesting = outer }()
+
+	p.nextToken()
+
+	return p.parseExpression(HASH_INIT)
+}
+
 func (p *Parser) parseArrayElements() []ast.Expression {
 	var elements []ast.Expression
 
@@ -242,12 +436,30 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return b
 }
 
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.Null{Token: p.currToken}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.IDENT:
+		// `label: while (...)`, telling a label apart from a range like `a:b` needs to look past the ':'
+		if p.peekTokenIs(token.COLON) && isLoopToken(p.l.Peek().Type) {
+			return p.parseLabeledLoop()
+		}
+		return p.parseExpressionStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -260,7 +472,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	stmt.Name = p.parseDeclaredIdentifier()
+	if stmt.Name == nil {
+		return nil
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -269,10 +484,38 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	p.endStatement()
+
+	return stmt
+}
+
+// parseExportStatement parses `export let x = 5;`, only let statements can be exported
+func (p *Parser) parseExportStatement() ast.Statement {
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+
+	stmt := p.parseLetStatement()
+	if stmt == nil {
+		return nil
 	}
 
+	stmt.Exported = true
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+
+	p.endStatement()
+
 	return stmt
 }
 
@@ -283,10 +526,96 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	p.endStatement()
+
+	return stmt
+}
+
+func isLoopToken(tokenType token.TokenType) bool {
+	return tokenType == token.WHILE || tokenType == token.DO || tokenType == token.LOOP || tokenType == token.FOR
+}
+
+func (p *Parser) parseLabeledLoop() ast.Statement {
+	stmt := &ast.ExpressionStatement{Token: p.currToken}
+	label := p.currToken.Literal
+
+	p.nextToken()
+	p.nextToken()
+
+	p.labels = append(p.labels, label)
+	stmt.Expression = p.parseExpression(LOWEST)
+	p.labels = p.labels[:len(p.labels)-1]
+
+	switch loop := stmt.Expression.(type) {
+	case nil:
+		return nil
+	case *ast.WhileExpression:
+		loop.Label = label
+	case *ast.DoWhileExpression:
+		loop.Label = label
+	case *ast.LoopExpression:
+		loop.Label = label
+	case *ast.ForInExpression:
+		loop.Label = label
+	default:
+		msg := fmt.Sprintf("label %s must be on a loop, got %s", label, stmt.Expression.String())
+		p.appendError(msg)
+		return nil
+	}
+
+	p.endStatement()
+
+	return stmt
+}
+
+func (p *Parser) isLabel(name string) bool {
+	for _, label := range p.labels {
+		if label == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.currToken}
+
+	if p.peekTokenIs(token.IDENT) && p.isLabel(p.peekToken.Literal) {
 		p.nextToken()
+		stmt.Label = p.currToken.Literal
 	}
 
+	// `break value` makes the loop evaluate to value, the value has to start on the same line so that with semicolons
+	// left out a plain `break` doesn't take the next statement as its value
+	if !p.peekTokenIs(token.SEMICOLON) && !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) &&
+		p.peekToken.Pos.Line == p.currToken.Pos.Line {
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+	}
+
+	p.endStatement()
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.currToken}
+
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+
+		if !p.isLabel(p.currToken.Literal) {
+			msg := fmt.Sprintf("unknown label %s", p.currToken.Literal)
+			p.appendError(msg)
+			return nil
+		}
+
+		stmt.Label = p.currToken.Literal
+	}
+
+	p.endStatement()
+
 	return stmt
 }
 
@@ -301,13 +630,23 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 		return nil
 	}
 
-	// SEMICOLONs are optional in statement to make using the REPL easier for the user, so the user doesn't have to add
-	// a semicolon when evaluation expressions such as `5 + 10`
+	p.endStatement()
+
+	return stmt
+}
+
+// endStatement skips the semicolon after a statement. SEMICOLONs are optional to make using the REPL easier for the
+// user, so the user doesn't have to add a semicolon when evaluating expressions such as `5 + 10`, unless the parser is
+// WithStrictSemicolons
+func (p *Parser) endStatement() {
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
+		return
 	}
 
-	return stmt
+	if p.strictSemicolons && !p.peekTokenIs(token.RBRACE) {
+		p.appendPeekError(token.SEMICOLON)
+	}
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -320,6 +659,12 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	leftExp := prefix()
 
+	return p.parseOperators(leftExp, precedence)
+}
+
+// parseOperators parses the operators following leftExp which bind tighter than precedence, with leftExp as the left
+// side of the first one
+func (p *Parser) parseOperators(leftExp ast.Expression, precedence int) ast.Expression {
 	// Hello future me, maybe you're thinking like i was when i wrote this on why this is a for loop rather than an if
 	// statement seeing that infixParseFn will eventually call this, p.parseExpression, method again to parse the RHS,
 	// and that by for loop we would be parsing things twice.
@@ -372,6 +717,36 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return infix
 }
 
+// parseComparisonExpression parses `<` and `>` like any other infix, except when the left side is a comparison itself,
+// then the two are merged into a chain so `1 < x < 10` means `1 < x && x < 10` rather than comparing a boolean to 10.
+// A comparison in parentheses isn't merged, `(1 < x) < 10` compares the boolean to 10
+func (p *Parser) parseComparisonExpression(left ast.Expression) ast.Expression {
+	exp := p.parseInfixExpression(left).(*ast.InfixExpression)
+
+	if p.grouped[left] {
+		return exp
+	}
+
+	switch left := left.(type) {
+	case *ast.ComparisonChain:
+		left.Operators = append(left.Operators, exp.Operator)
+		left.Operands = append(left.Operands, exp.Right)
+		return left
+	case *ast.InfixExpression:
+		if left.Operator != "<" && left.Operator != ">" {
+			return exp
+		}
+
+		return &ast.ComparisonChain{
+			Token:     left.Token,
+			Operands:  []ast.Expression{left.Left, left.Right, exp.Right},
+			Operators: []string{left.Operator, exp.Operator},
+		}
+	default:
+		return exp
+	}
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
@@ -391,6 +766,10 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		if p.trailingCommas && p.peekTokenIs(end) {
+			break
+		}
+
 		p.nextToken()
 		list = append(list, p.parseExpression(LOWEST))
 	}
@@ -428,7 +807,108 @@ func (p *Parser) parseRangeExpression(left ast.Expression) ast.Expression {
 
 	p.nextToken()
 
-	exp.Right = p.parseExpression(LOWEST)
+	// ranges bind tighter than comparisons, `x == 1:3` compares x with the range, and are left associative
+	exp.Right = p.parseExpression(RANGE)
+
+	return exp
+}
+
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	// the target failed to parse, e.g. `fn = 1`, and that's already been reported
+	if target == nil {
+		return nil
+	}
+
+	exp := &ast.AssignExpression{
+		Token:  p.currToken,
+		Target: target,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", target.String())
+		p.appendError(msg)
+		return nil
+	}
+
+	p.nextToken()
+
+	// parsing the value with LOWEST rather than ASSIGN makes assignments right associative, so `a = b = 1` assigns
+	// 1 to both
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	exp := &ast.PipeExpression{
+		Token: p.currToken,
+		Left:  left,
+	}
+
+	precedence := p.currPrecedence()
+	p.nextToken()
+
+	exp.Right = p.parseExpression(precedence)
+
+	return exp
+}
+
+func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
+	target, ok := left.(*ast.Identifier)
+	if !ok {
+		msg := fmt.Sprintf("cannot apply %s to %s", p.currToken.Literal, left.String())
+		p.appendError(msg)
+		return nil
+	}
+
+	return &ast.PostfixExpression{
+		Token:    p.currToken,
+		Target:   target,
+		Operator: p.currToken.Literal,
+	}
+}
+
+func (p *Parser) parseCoalesceExpression(left ast.Expression) ast.Expression {
+	exp := &ast.CoalesceExpression{
+		Token: p.currToken,
+		Left:  left,
+	}
+
+	precedence := p.currPrecedence()
+	p.nextToken()
+
+	exp.Right = p.parseExpression(precedence)
+
+	return exp
+}
+
+// parseDotExpression parses both `h.key` field access and `x.f()` method calls, which one is only known once we see
+// whether the identifier is followed by a '(', as well as their optional `h?.key` and `x?.f()` forms
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	dot := p.currToken
+	optional := p.currTokenIs(token.OPT_DOT)
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	name := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.peekTokenIs(token.LPAREN) {
+		return &ast.DotExpression{Token: dot, Left: left, Key: name, Optional: optional}
+	}
+
+	p.nextToken()
+
+	exp := &ast.MethodCallExpression{
+		Token:    dot,
+		Receiver: left,
+		Method:   name,
+		Optional: optional,
+	}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
 
 	return exp
 }
@@ -444,6 +924,10 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 		return nil
 	}
 
+	if exp != nil {
+		p.grouped[exp] = true
+	}
+
 	return exp
 }
 
@@ -480,6 +964,105 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseWhileExpression() ast.Expression {
+	exp := &ast.WhileExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Body = p.parseBlockStatement()
+
+	return exp
+}
+
+func (p *Parser) parseDoWhileExpression() ast.Expression {
+	exp := &ast.DoWhileExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.WHILE) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseLoopExpression() ast.Expression {
+	exp := &ast.LoopExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Body = p.parseBlockStatement()
+
+	return exp
+}
+
+// parseForInExpression parses `for v in xs { ... }`, and `for i, v in xs { ... }` which binds the index to i as well
+func (p *Parser) parseForInExpression() ast.Expression {
+	exp := &ast.ForInExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.ValueVar = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		exp.IndexVar = exp.ValueVar
+		exp.ValueVar = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Body = p.parseBlockStatement()
+
+	return exp
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	fl := &ast.FunctionLiteral{Token: p.currToken}
 
@@ -493,7 +1076,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// loops don't reach across function boundaries, so neither do their labels
+	labels := p.labels
+	p.labels = nil
 	fl.Body = p.parseBlockStatement()
+	p.labels = labels
 
 	return fl
 }
@@ -508,13 +1095,23 @@ func (p *Parser) parseFunctionParams() []*ast.Identifier {
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	ident := p.parseDeclaredIdentifier()
+	if ident == nil {
+		return nil
+	}
 	params = append(params, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		if p.trailingCommas && p.peekTokenIs(token.RPAREN) {
+			break
+		}
+
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		ident := p.parseDeclaredIdentifier()
+		if ident == nil {
+			return nil
+		}
 		params = append(params, ident)
 	}
 
@@ -525,12 +1122,38 @@ func (p *Parser) parseFunctionParams() []*ast.Identifier {
 	return params
 }
 
+// parseDeclaredIdentifier parses the name a let or a parameter declares, optionally followed by its type, `x: int`
+func (p *Parser) parseDeclaredIdentifier() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.peekTokenIs(token.COLON) {
+		return ident
+	}
+
+	p.nextToken()
+	// `fn` is a keyword but it's also the name of the function type
+	if p.peekTokenIs(token.FUNCTION) {
+		p.nextToken()
+	} else if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	ident.Annotation = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	return ident
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currToken}
 
 	p.nextToken()
 
-	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) {
+	return p.parseBlockStatements(block)
+}
+
+// parseBlockStatements adds the statements from the current token up to the closing `}` to block
+func (p *Parser) parseBlockStatements(block *ast.BlockStatement) *ast.BlockStatement {
+	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) && !p.tooManyErrors() {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
@@ -542,6 +1165,10 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 }
 
 func (p *Parser) peekPrecedence() int {
+	if p.peekTokenIs(token.COLON) && p.nesting == p.keyNesting {
+		return LOWEST
+	}
+
 	if precedence, ok := precedences[p.peekToken.Type]; ok {
 		return precedence
 	}
@@ -559,7 +1186,7 @@ func (p *Parser) currPrecedence() int {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.appendError(msg)
 }
 
 func (p *Parser) currTokenIs(t token.TokenType) bool {
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"waiig/ast"
 	"waiig/lexer"
@@ -41,6 +42,82 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestImportStatements(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedPath string
+	}{
+		{`import "math.monkey";`, "math.monkey"},
+		{`import "lib/strings.monkey"`, "lib/strings.monkey"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ImportStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Path.Value != tt.expectedPath {
+			t.Errorf("stmt.Path.Value not %q. got=%q", tt.expectedPath, stmt.Path.Value)
+		}
+
+		if stmt.String() != `import "`+tt.expectedPath+`";` {
+			t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+		}
+	}
+
+	p := New(lexer.New("import math"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected a parser error for an import without a path")
+	}
+}
+
+func TestExportStatements(t *testing.T) {
+	input := "export let add = fn(a, b) { a + b }; let helper = 1;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	exported := program.Statements[0].(*ast.LetStatement)
+	if !exported.Exported {
+		t.Errorf("add is not exported")
+	}
+	if !strings.HasPrefix(exported.String(), "export let add = ") {
+		t.Errorf("exported.String() wrong. got=%q", exported.String())
+	}
+
+	private := program.Statements[1].(*ast.LetStatement)
+	if private.Exported {
+		t.Errorf("helper is exported")
+	}
+
+	for _, input := range []string{"export 5", "export fn() {}", "export import \"x\""} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("input %q - expected parser errors, got none", input)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -388,6 +465,114 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"{call(4 + 5)[1]:2 + 2}",
 			"{(call((4 + 5))[1]):(2 + 2)}",
 		},
+		{
+			"a |> f |> g",
+			"((a |> f) |> g)",
+		},
+		{
+			"f >> g << h",
+			"((f >> g) << h)",
+		},
+		{
+			"a * f >> g(1)",
+			"(a * (f >> g(1)))",
+		},
+		{
+			"x |> f >> g",
+			"(x |> (f >> g))",
+		},
+		{
+			"-f >> g",
+			"((-f) >> g)",
+		},
+		{
+			"1 + 2 |> add(3) |> f",
+			"(((1 + 2) |> add(3)) |> f)",
+		},
+		{
+			"x = a |> f",
+			"(x = (a |> f))",
+		},
+		{
+			"a.f(1, 2 * 3)",
+			"a.f(1, (2 * 3))",
+		},
+		{
+			"-a.f().g()[0]",
+			"(-(a.f().g()[0]))",
+		},
+		{
+			"1 + a.f() * 2",
+			"(1 + (a.f() * 2))",
+		},
+		{
+			"-h.a.b + 1",
+			"((-h.a.b) + 1)",
+		},
+		{
+			"h.a.f(h.b)[0]",
+			"(h.a.f(h.b)[0])",
+		},
+		{
+			"a?.b.c?.d()[0] ?? 1",
+			"((a?.b.c?.d()[0]) ?? 1)",
+		},
+		{
+			"-i++ * 2",
+			"((-(i++)) * 2)",
+		},
+		{
+			"x = i-- + 1",
+			"(x = ((i--) + 1))",
+		},
+		{
+			"1 < x < 10",
+			"(1 < x < 10)",
+		},
+		{
+			"(3 > 2) > 1",
+			"((3 > 2) > 1)",
+		},
+		{
+			"(1 < x < 10) < y",
+			"((1 < x < 10) < y)",
+		},
+		{
+			"a < b + 1 > c < d == true",
+			"((a < (b + 1) > c < d) == true)",
+		},
+		{
+			"a == b < c",
+			"(a == (b < c))",
+		},
+		{
+			"a ?? b ?? c",
+			"((a ?? b) ?? c)",
+		},
+		{
+			"x = h.a ?? 1 + 2",
+			"(x = (h.a ?? (1 + 2)))",
+		},
+		{
+			"a ?? b |> f",
+			"(a ?? (b |> f))",
+		},
+		{
+			"x == 1:3",
+			"(x == 1:3)",
+		},
+		{
+			"1:5 != x",
+			"(1:5 != x)",
+		},
+		{
+			"a + 1:b * 2",
+			"(a + 1):(b * 2)",
+		},
+		{
+			"let r = 0:len(arr) - 1",
+			"let r = 0:(len(arr) - 1);",
+		},
 	}
 
 	for _, tt := range tests {
@@ -440,6 +625,34 @@ func TestBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestNullExpression(t *testing.T) {
+	input := "null;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	null, ok := stmt.Expression.(*ast.Null)
+	if !ok {
+		t.Fatalf("exp not *ast.Null. got=%T", stmt.Expression)
+	}
+	if null.TokenLiteral() != "null" {
+		t.Errorf("null.TokenLiteral not %q. got=%q", "null", null.TokenLiteral())
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	input := `if (x < y) { x }`
 
@@ -548,8 +761,8 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
-func TestFunctionLiteralParsing(t *testing.T) {
-	input := `fn(x, y) { x + y; }`
+func TestWhileExpression(t *testing.T) {
+	input := `while (x < y) { x; break; continue; }`
 
 	l := lexer.New(input)
 	p := New(l)
@@ -567,66 +780,31 @@ func TestFunctionLiteralParsing(t *testing.T) {
 			program.Statements[0])
 	}
 
-	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	exp, ok := stmt.Expression.(*ast.WhileExpression)
 	if !ok {
-		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+		t.Fatalf("stmt.Expression is not ast.WhileExpression. got=%T",
 			stmt.Expression)
 	}
 
-	if len(function.Parameters) != 2 {
-		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
-			len(function.Parameters))
-	}
-
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
-
-	if len(function.Body.Statements) != 1 {
-		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
-			len(function.Body.Statements))
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
 	}
 
-	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
-			function.Body.Statements[0])
+	if len(exp.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d\n", len(exp.Body.Statements))
 	}
 
-	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
-}
-
-func TestFunctionParameterParsing(t *testing.T) {
-	tests := []struct {
-		input          string
-		expectedParams []string
-	}{
-		{input: "fn() {};", expectedParams: []string{}},
-		{input: "fn(x) {};", expectedParams: []string{"x"}},
-		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	if _, ok := exp.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("Statements[1] is not ast.BreakStatement. got=%T", exp.Body.Statements[1])
 	}
 
-	for _, tt := range tests {
-		l := lexer.New(tt.input)
-		p := New(l)
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
-
-		stmt := program.Statements[0].(*ast.ExpressionStatement)
-		function := stmt.Expression.(*ast.FunctionLiteral)
-
-		if len(function.Parameters) != len(tt.expectedParams) {
-			t.Errorf("length parameters wrong. want %d, got=%d\n",
-				len(tt.expectedParams), len(function.Parameters))
-		}
-
-		for i, ident := range tt.expectedParams {
-			testLiteralExpression(t, function.Parameters[i], ident)
-		}
+	if _, ok := exp.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("Statements[2] is not ast.ContinueStatement. got=%T", exp.Body.Statements[2])
 	}
 }
 
-func TestCallExpressionParsing(t *testing.T) {
-	input := "add(1, 2 * 3, 4 + 5);"
+func TestDoWhileExpression(t *testing.T) {
+	input := `do { x } while (x < y)`
 
 	l := lexer.New(input)
 	p := New(l)
@@ -634,56 +812,52 @@ func TestCallExpressionParsing(t *testing.T) {
 	checkParserErrors(t, p)
 
 	if len(program.Statements) != 1 {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
 			1, len(program.Statements))
 	}
 
 	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
-		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
 			program.Statements[0])
 	}
 
-	exp, ok := stmt.Expression.(*ast.CallExpression)
+	exp, ok := stmt.Expression.(*ast.DoWhileExpression)
 	if !ok {
-		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+		t.Fatalf("stmt.Expression is not ast.DoWhileExpression. got=%T",
 			stmt.Expression)
 	}
 
-	if !testIdentifier(t, exp.Function, "add") {
-		return
+	if len(exp.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d\n", len(exp.Body.Statements))
 	}
 
-	if len(exp.Arguments) != 3 {
-		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	body, ok := exp.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Body.Statements[0])
 	}
 
-	testLiteralExpression(t, exp.Arguments[0], 1)
-	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
-	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+	if !testIdentifier(t, body.Expression, "x") {
+		return
+	}
+
+	testInfixExpression(t, exp.Condition, "x", "<", "y")
 }
 
-func TestCallExpressionParameterParsing(t *testing.T) {
+func TestLoopExpression(t *testing.T) {
 	tests := []struct {
-		input         string
-		expectedIdent string
-		expectedArgs  []string
+		input    string
+		expected string
 	}{
-		{
-			input:         "add();",
-			expectedIdent: "add",
-			expectedArgs:  []string{},
-		},
-		{
-			input:         "add(1);",
-			expectedIdent: "add",
-			expectedArgs:  []string{"1"},
-		},
-		{
-			input:         "add(1, 2 * 3, 4 + 5);",
-			expectedIdent: "add",
-			expectedArgs:  []string{"1", "(2 * 3)", "(4 + 5)"},
-		},
+		{"loop { x }", "loop {\n    x\n}"},
+		{"loop { break }", "loop {\n    break;\n}"},
+		{"loop { break; }", "loop {\n    break;\n}"},
+		{"loop { break x + 1; }", "loop {\n    break (x + 1);\n}"},
+		{"loop { if (x) { break x } }", "loop {\n    ifx {\n    break x;\n}\n}"},
+		{"let x = loop { break 1 }", "let x = loop {\n    break 1;\n};"},
+		// a value on the next line is a statement of its own
+		{"loop { if (x) { break\n y = 1 } }", "loop {\n    ifx {\n    break;\n    (y = 1)\n}\n}"},
 	}
 
 	for _, tt := range tests {
@@ -692,48 +866,23 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 		program := p.ParseProgram()
 		checkParserErrors(t, p)
 
-		stmt := program.Statements[0].(*ast.ExpressionStatement)
-		exp, ok := stmt.Expression.(*ast.CallExpression)
-		if !ok {
-			t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
-				stmt.Expression)
-		}
-
-		if !testIdentifier(t, exp.Function, tt.expectedIdent) {
-			return
-		}
-
-		if len(exp.Arguments) != len(tt.expectedArgs) {
-			t.Fatalf("wrong number of arguments. want=%d, got=%d",
-				len(tt.expectedArgs), len(exp.Arguments))
-		}
-
-		for i, arg := range tt.expectedArgs {
-			if exp.Arguments[i].String() != arg {
-				t.Errorf("argument %d wrong. want=%q, got=%q", i,
-					arg, exp.Arguments[i].String())
-			}
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, actual)
 		}
 	}
 }
 
-func TestArrayElementsParsing(t *testing.T) {
+func TestForInExpression(t *testing.T) {
 	tests := []struct {
-		input            string
-		expectedElements []string
+		input    string
+		expected string
 	}{
-		{
-			input:            "[1, 2, 3]",
-			expectedElements: []string{"1", "2", "3"},
-		},
-		{
-			input:            `["test", 3, false]`,
-			expectedElements: []string{"test", "3", "false"},
-		},
-		{
-			input:            "[fn(a, b) { return a + b }, ident]",
-			expectedElements: []string{"fn(a, b) {\n    return (a + b);\n}", "ident"},
-		},
+		{"for v in xs { v }", "for v in xs {\n    v\n}"},
+		{"for i, v in [1, 2] { i + v }", "for i, v in [1, 2] {\n    (i + v)\n}"},
+		{"for n in 0:3 { break }", "for n in 0:3 {\n    break;\n}"},
+		{"let last = for c in \"abc\" { c }", "let last = for c in abc {\n    c\n};"},
+		{"outer: for x in xs { for y in ys { continue outer } }", "outer: for x in xs {\n    for y in ys {\n    continue outer;\n}\n}"},
 	}
 
 	for _, tt := range tests {
@@ -742,12 +891,404 @@ func TestArrayElementsParsing(t *testing.T) {
 		program := p.ParseProgram()
 		checkParserErrors(t, p)
 
-		stmt := program.Statements[0].(*ast.ExpressionStatement)
-		arr, ok := stmt.Expression.(*ast.ArrayLiteral)
-		if !ok {
-			t.Fatalf("stmt.Expression is not ast.ArrayLiteral. got=%T",
-				stmt.Expression)
-		}
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+
+	stmt := New(lexer.New("for i, v in xs { v }")).ParseProgram().Statements[0].(*ast.ExpressionStatement)
+	loop := stmt.Expression.(*ast.ForInExpression)
+	if loop.IndexVar == nil || loop.IndexVar.Value != "i" || loop.ValueVar.Value != "v" {
+		t.Errorf("wrong loop variables. index=%v, value=%v", loop.IndexVar, loop.ValueVar)
+	}
+
+	stmt = New(lexer.New("for v in xs { v }")).ParseProgram().Statements[0].(*ast.ExpressionStatement)
+	loop = stmt.Expression.(*ast.ForInExpression)
+	if loop.IndexVar != nil || loop.ValueVar.Value != "v" {
+		t.Errorf("wrong loop variables. index=%v, value=%v", loop.IndexVar, loop.ValueVar)
+	}
+}
+
+func TestForInExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for in xs { x }", "expected next token to be IDENT, got IN instead"},
+		{"for x xs { x }", "expected next token to be IN, got IDENT instead"},
+		{"for i, in xs { x }", "expected next token to be IDENT, got IN instead"},
+		{"for x in xs x", "expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q - expected parser errors, got none", tt.input)
+			continue
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("input %q - wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"outer: loop { break outer }", "outer: loop {\n    break outer;\n}"},
+		{"outer: while (x) { continue outer; }", "outer: whilex {\n    continue outer;\n}"},
+		{"outer: do { loop { break outer 5 } } while (x)", "outer: do {\n    loop {\n    break outer 5;\n}\n}whilex"},
+		// not a label in scope, so it's the value being broken with, the evaluator reports it if nothing's bound to it
+		{"loop { break outer }", "loop {\n    break outer;\n}"},
+		{"a:b", "a:b"},
+		{"let r = { outer: loop { break outer 1 } }", "let r = {\n    outer: loop {\n    break outer 1;\n}\n};"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+
+	p := New(lexer.New("loop { break outer }"))
+	program := p.ParseProgram()
+	loop := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.LoopExpression)
+	brk := loop.Body.Statements[0].(*ast.BreakStatement)
+	if brk.Label != "" || brk.Value == nil {
+		t.Errorf("break with an unknown label should break with a value. got label=%q, value=%v", brk.Label, brk.Value)
+	}
+}
+
+func TestLabeledLoopErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"loop { continue outer }", "unknown label outer"},
+		{"outer: loop { } + 1", "label outer must be on a loop, got (loop {\n} + 1)"},
+		{"outer: loop { fn() { continue outer } }", "unknown label outer"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q - expected parser errors, got none", tt.input)
+			continue
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("input %q - wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestDoWhileExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"do { x }", "expected next token to be WHILE, got EOF instead"},
+		{"do { x } while x", "expected next token to be (, got IDENT instead"},
+		{"do x while (y)", "expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q - expected parser errors, got none", tt.input)
+			continue
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("input %q - wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
+			len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
+			len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
+			function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input               string
+		expectedAnnotations []string
+		expectedString      string
+	}{
+		{"let x: int = 5;", []string{"int"}, "let x: int = 5;"},
+		{"let x = 5;", []string{""}, "let x = 5;"},
+		{"fn(x: int, y: string) { x };", []string{"int", "string"}, "fn(x: int, y: string) {\n    x\n}"},
+		{"fn(x, y: any) { x };", []string{"", "any"}, "fn(x, y: any) {\n    x\n}"},
+		{"fn(x, y) { x };", []string{"", ""}, "fn(x, y) {\n    x\n}"},
+		{"let f: fn = fn() { 1 };", []string{"fn"}, "let f: fn = fn() {\n    1\n};"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var idents []*ast.Identifier
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			idents = []*ast.Identifier{stmt.Name}
+		case *ast.ExpressionStatement:
+			idents = stmt.Expression.(*ast.FunctionLiteral).Parameters
+		}
+
+		if len(idents) != len(tt.expectedAnnotations) {
+			t.Fatalf("input %q - wrong number of identifiers. want=%d, got=%d", tt.input, len(tt.expectedAnnotations), len(idents))
+		}
+
+		for i, expected := range tt.expectedAnnotations {
+			annotation := ""
+			if idents[i].Annotation != nil {
+				annotation = idents[i].Annotation.Value
+			}
+			if annotation != expected {
+				t.Errorf("input %q - wrong annotation of %s. want=%q, got=%q", tt.input, idents[i].Value, expected, annotation)
+			}
+		}
+
+		if actual := program.String(); actual != tt.expectedString {
+			t.Errorf("input %q - wrong String(). want=%q, got=%q", tt.input, tt.expectedString, actual)
+		}
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []string{
+		"let x: = 5;",
+		"let x: 5 = 5;",
+		"fn(x: ) { x }",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("input %q - expected parser errors", input)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestCallExpressionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedIdent string
+		expectedArgs  []string
+	}{
+		{
+			input:         "add();",
+			expectedIdent: "add",
+			expectedArgs:  []string{},
+		},
+		{
+			input:         "add(1);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1"},
+		},
+		{
+			input:         "add(1, 2 * 3, 4 + 5);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1", "(2 * 3)", "(4 + 5)"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.CallExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+				stmt.Expression)
+		}
+
+		if !testIdentifier(t, exp.Function, tt.expectedIdent) {
+			return
+		}
+
+		if len(exp.Arguments) != len(tt.expectedArgs) {
+			t.Fatalf("wrong number of arguments. want=%d, got=%d",
+				len(tt.expectedArgs), len(exp.Arguments))
+		}
+
+		for i, arg := range tt.expectedArgs {
+			if exp.Arguments[i].String() != arg {
+				t.Errorf("argument %d wrong. want=%q, got=%q", i,
+					arg, exp.Arguments[i].String())
+			}
+		}
+	}
+}
+
+func TestArrayElementsParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedElements []string
+	}{
+		{
+			input:            "[1, 2, 3]",
+			expectedElements: []string{"1", "2", "3"},
+		},
+		{
+			input:            `["test", 3, false]`,
+			expectedElements: []string{"test", "3", "false"},
+		},
+		{
+			input:            "[fn(a, b) { return a + b }, ident]",
+			expectedElements: []string{"fn(a, b) {\n    return (a + b);\n}", "ident"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		arr, ok := stmt.Expression.(*ast.ArrayLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.ArrayLiteral. got=%T",
+				stmt.Expression)
+		}
 
 		if len(arr.Elements) != len(tt.expectedElements) {
 			t.Fatalf("wrong number of arguments. want=%d, got=%d",
@@ -763,50 +1304,290 @@ func TestArrayElementsParsing(t *testing.T) {
 	}
 }
 
-func TestIndexExpression(t *testing.T) {
-	input := "arr[1]"
+func TestIndexExpression(t *testing.T) {
+	input := "arr[1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IndexExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Left, "arr") {
+		return
+	}
+
+	testLiteralExpression(t, exp.Index, 1)
+}
+
+func TestRangeExpression(t *testing.T) {
+	tests := []struct {
+		input  string
+		verify func(exp *ast.RangeExpression)
+	}{
+		{
+			input: "index:5*7",
+			verify: func(exp *ast.RangeExpression) {
+				testIdentifier(t, exp.Left, "index")
+				testInfixExpression(t, exp.Right, 5, "*", 7)
+			},
+		},
+		{
+			input: "1:2:3",
+			verify: func(exp *ast.RangeExpression) {
+				left, ok := exp.Left.(*ast.RangeExpression)
+				if !ok {
+					t.Fatalf("exp.Left is not ast.RangeExpression. got=%T", exp.Left)
+				}
+				testIntegerLiteral(t, left.Left, 1)
+				testIntegerLiteral(t, left.Right, 2)
+				testIntegerLiteral(t, exp.Right, 3)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		rg, ok := stmt.Expression.(*ast.RangeExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.RangeExpression. got=%T",
+				stmt.Expression)
+		}
+
+		tt.verify(rg)
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	expected := map[string]int64{
+		"one":   1,
+		"two":   2,
+		"three": 3,
+	}
+
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+		}
+
+		expectedValue := expected[literal.String()]
+
+		testIntegerLiteral(t, pair.Value, expectedValue)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	tests := map[string]func(ast.Expression){
+		"one": func(e ast.Expression) {
+			testInfixExpression(t, e, 0, "+", 1)
+		},
+		"two": func(e ast.Expression) {
+			testInfixExpression(t, e, 10, "-", 8)
+		},
+		"three": func(e ast.Expression) {
+			testInfixExpression(t, e, 15, "/", 5)
+		},
+	}
+
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+
+		testFunc, ok := tests[literal.String()]
+		if !ok {
+			t.Errorf("No test function for key %q found", literal.String())
+			continue
+		}
+
+		testFunc(pair.Value)
+	}
+}
+
+func TestParsingHashLiteralsKeepOrder(t *testing.T) {
+	input := `{"c": 3, "a": 1, "b": 2}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expectedKeys := []string{"c", "a", "b"}
+	if len(hash.Pairs) != len(expectedKeys) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		if pair.Key.String() != expectedKeys[i] {
+			t.Errorf("hash.Pairs[%d] has wrong key. expected=%q, got=%q", i, expectedKeys[i], pair.Key.String())
+		}
+	}
+
+	if hash.String() != "{c:3, a:1, b:2}" {
+		t.Errorf("hash.String() wrong. got=%q", hash.String())
+	}
+}
+
+func TestParsingHashLiteralsMixedAndNestedKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{1: "one", "two": 2}`, "{1:one, two:2}"},
+		{`{true: 1, x + 1: [2], null: 3}`, "{true:1, (x + 1):[2], null:3}"},
+		{`{"outer": {"inner": {1: true}}}`, "{outer:{inner:{1:true}}}"},
+		{`{{1: 2}: {3: 4}}`, "{{1:2}:{3:4}}"},
+		// keys take comparisons, only a range needs parentheses since its `:` would end the key
+		{`{1 == 1: "yes", a < b: "lt"}`, "{(1 == 1):yes, (a < b):lt}"},
+		{`{(1:3): "r", [1:2]: 0}`, "{1:3:r, [1:2]:0}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.HashLiteral); !ok {
+			t.Fatalf("input %q - exp is not ast.HashLiteral. got=%T", tt.input, stmt.Expression)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestParsingHashLiteralsInsideBlocks(t *testing.T) {
+	// a `{` after `if (...)` or `fn(...)` starts a block, the `{` inside it starts a hash literal
+	input := `if (true) { {"a": 1} }`
 
 	l := lexer.New(input)
 	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	if len(program.Statements) != 1 {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
-			1, len(program.Statements))
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("exp is not ast.IfExpression. got=%T", stmt.Expression)
 	}
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
-			program.Statements[0])
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("consequence is not 1 statements. got=%d", len(exp.Consequence.Statements))
 	}
 
-	exp, ok := stmt.Expression.(*ast.IndexExpression)
+	inner, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
-		t.Fatalf("stmt.Expression is not ast.IndexExpression. got=%T",
-			stmt.Expression)
+		t.Fatalf("consequence statement is not ast.ExpressionStatement. got=%T", exp.Consequence.Statements[0])
 	}
 
-	if !testIdentifier(t, exp.Left, "arr") {
-		return
+	if _, ok := inner.Expression.(*ast.HashLiteral); !ok {
+		t.Fatalf("consequence exp is not ast.HashLiteral. got=%T", inner.Expression)
 	}
-
-	testLiteralExpression(t, exp.Index, 1)
 }
 
-func TestRangeExpression(t *testing.T) {
+func TestParsingHashLiteralsTrailingComma(t *testing.T) {
 	tests := []struct {
-		input  string
-		verify func(exp *ast.RangeExpression)
+		input    string
+		expected string
 	}{
-		{
-			input: "index:5*7",
-			verify: func(exp *ast.RangeExpression) {
-				testIdentifier(t, exp.Left, "index")
-				testInfixExpression(t, exp.Right, 5, "*", 7)
-			},
-		},
+		{`{a: 1, b: 2,}`, "{a:1, b:2}"},
+		{`{"one": 1,}`, "{one:1}"},
+		{`{}`, "{}"},
+		{`{
+			"name": "monkey",
+			"age": 1 + 2,
+			"tags": [1, 2],
+		}`, "{name:monkey, age:(1 + 2), tags:[1, 2]}"},
+		{`let h = {
+			a: 1,
+			b: 2
+		};`, "let h = {a:1, b:2};"},
 	}
 
 	for _, tt := range tests {
@@ -815,116 +1596,165 @@ func TestRangeExpression(t *testing.T) {
 		program := p.ParseProgram()
 		checkParserErrors(t, p)
 
-		stmt := program.Statements[0].(*ast.ExpressionStatement)
-		rg, ok := stmt.Expression.(*ast.RangeExpression)
-		if !ok {
-			t.Fatalf("stmt.Expression is not ast.RangeExpression. got=%T",
-				stmt.Expression)
+		if len(program.Statements) != 1 {
+			t.Fatalf("input %q - program.Statements does not contain 1 statement. got=%d", tt.input, len(program.Statements))
 		}
 
-		tt.verify(rg)
+		if program.String() != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
 	}
 }
 
-func TestParsingHashLiteralsStringKeys(t *testing.T) {
-	input := `{"one": 1, "two": 2, "three": 3}`
+func TestParsingHashLiteralsRejectsStrayCommas(t *testing.T) {
+	tests := []string{
+		`{,}`,
+		`{a: 1,,}`,
+		`{, a: 1}`,
+	}
 
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
-	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+		if len(p.Errors()) == 0 {
+			t.Errorf("input %q - expected parser errors, got none", input)
+		}
 	}
+}
 
-	if len(hash.Pairs) != 3 {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+func TestBlockExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let result = { let x = 2; x * 3 };", "let result = {\n    let x = 2;\n    (x * 3)\n};"},
+		{"{ x = 1; x + 2 }", "{\n    (x = 1)\n    (x + 2)\n}"},
+		{"{ 1 }", "{\n    1\n}"},
+		{"{ return 5 }", "{\n    return 5;\n}"},
+		{"{ a + b * c; }", "{\n    (a + (b * c))\n}"},
+		{"{ (a:b) }", "{\n    a:b\n}"},
 	}
 
-	expected := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
-	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
-		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+		if len(program.Statements) != 1 {
+			t.Fatalf("input %q - program.Statements does not contain 1 statements. got=%d", tt.input, len(program.Statements))
 		}
 
-		expectedValue := expected[literal.String()]
+		var exp ast.Expression
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			exp = stmt.Value
+		case *ast.ExpressionStatement:
+			exp = stmt.Expression
+		}
 
-		testIntegerLiteral(t, value, expectedValue)
-	}
-}
+		if _, ok := exp.(*ast.BlockStatement); !ok {
+			t.Errorf("input %q - exp is not *ast.BlockStatement. got=%T", tt.input, exp)
+		}
 
-func TestParsingEmptyHashLiteral(t *testing.T) {
-	input := "{}"
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
 
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	// anything followed by a `:` first is still a hash, including what would otherwise be a range
+	for _, input := range []string{`{}`, `{"a": 1}`, `{a: 1, b: 2}`, `{1 + 1: 2}`} {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
-	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.HashLiteral); !ok {
+			t.Errorf("input %q - exp is not *ast.HashLiteral. got=%T", input, stmt.Expression)
+		}
 	}
+}
 
-	if len(hash.Pairs) != 0 {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = y = 1 + 2", "(x = (y = (1 + 2)))"},
+		{"arr[1] = 2 * 3", "((arr[1]) = (2 * 3))"},
+		{"grid[1][2] = 9", "(((grid[1])[2]) = 9)"},
+		{`data["user"]["age"] = 30`, "(((data[user])[age]) = 30)"},
 	}
-}
 
-func TestParsingHashLiteralsWithExpressions(t *testing.T) {
-	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.AssignExpression); !ok {
+			t.Fatalf("exp is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
-	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
 	}
+}
 
-	if len(hash.Pairs) != 3 {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+func TestPostfixExpressionInvalidTarget(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5++", "cannot apply ++ to 5"},
+		{"arr[0]--", "cannot apply -- to (arr[0])"},
 	}
 
-	tests := map[string]func(ast.Expression){
-		"one": func(e ast.Expression) {
-			testInfixExpression(t, e, 0, "+", 1)
-		},
-		"two": func(e ast.Expression) {
-			testInfixExpression(t, e, 10, "-", 8)
-		},
-		"three": func(e ast.Expression) {
-			testInfixExpression(t, e, 15, "/", 5)
-		},
-	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
-		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q - expected parser errors, got none", tt.input)
 			continue
 		}
 
-		testFunc, ok := tests[literal.String()]
-		if !ok {
-			t.Errorf("No test function for key %q found", literal.String())
-			continue
+		if errors[0] != tt.expected {
+			t.Errorf("input %q - wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0])
 		}
+	}
+}
+
+func TestAssignExpressionInvalidTarget(t *testing.T) {
+	l := lexer.New("1 + 2 = 3")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors for invalid assignment target")
+	}
+	if errors[0] != "cannot assign to (1 + 2)" {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
+func TestAssignExpressionUnparseableTarget(t *testing.T) {
+	// the target fails to parse on its own, that's the error reported rather than a panic building "cannot assign to"
+	tests := []string{"fn = 1", "if = 2", "let loop = 1"}
 
-		testFunc(value)
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("input %q - expected parser errors", input)
+		}
 	}
 }
 
@@ -1072,3 +1902,222 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 + 3 * 4", "(2 + (3 * 4))"},
+		{"5;", "5"},
+		{"foo", "foo"},
+		{`"hello"`, "hello"},
+		{"true", "true"},
+		{"null", "null"},
+		{"-a", "(-a)"},
+		{"!(a == b)", "(!(a == b))"},
+		{"if (a) { b } else { c }", "ifa {\n    b\n}else {\n    c\n}"},
+		{"fn(x, y) { x + y }", "fn(x, y) {\n    (x + y)\n}"},
+		{"add(1, 2 * 3)", "add(1, (2 * 3))"},
+		{"[1, 2][0]", "([1, 2][0])"},
+		{"1:5", "1:5"},
+		{`{"a": 1}`, "{a:1}"},
+		{"x = 5", "(x = 5)"},
+		{"x |> f", "(x |> f)"},
+		{"x.f(1)", "x.f(1)"},
+		{"h.a ?? 1", "(h.a ?? 1)"},
+	}
+
+	for _, tt := range tests {
+		exp, errs := ParseExpression(tt.input)
+		if len(errs) != 0 {
+			t.Errorf("input %q has errors: %v", tt.input, errs)
+			continue
+		}
+
+		if exp.String() != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, exp.String())
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "no prefix parse function for EOF found"},
+		{"1 2", "expected next token to be EOF, got INT instead"},
+		{"1; 2", "expected next token to be EOF, got INT instead"},
+		{"let x = 5", "no prefix parse function for LET found"},
+		{"(1 + 2", "expected next token to be ), got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		exp, errs := ParseExpression(tt.input)
+		if exp != nil {
+			t.Errorf("input %q - expected nil expression, got=%q", tt.input, exp.String())
+		}
+
+		if len(errs) == 0 {
+			t.Errorf("input %q - expected errors, got none", tt.input)
+			continue
+		}
+
+		if errs[0] != tt.expected {
+			t.Errorf("input %q - wrong error. expected=%q, got=%q", tt.input, tt.expected, errs[0])
+		}
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5;", "let x = 5;"},
+		{"return a + b;", "return (a + b);"},
+		{"a * b", "(a * b)"},
+	}
+
+	for _, tt := range tests {
+		stmt, errs := ParseStatement(tt.input)
+		if len(errs) != 0 {
+			t.Errorf("input %q has errors: %v", tt.input, errs)
+			continue
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, stmt.String())
+		}
+	}
+
+	errorInputs := []string{"let = 5;", "let x = 5; let y = 6;", ""}
+	for _, input := range errorInputs {
+		stmt, errs := ParseStatement(input)
+		if stmt != nil {
+			t.Errorf("input %q - expected nil statement, got=%q", input, stmt.String())
+		}
+		if len(errs) == 0 {
+			t.Errorf("input %q - expected errors, got none", input)
+		}
+	}
+}
+
+func TestStrictSemicolons(t *testing.T) {
+	accepted := []string{
+		"let x = 5;",
+		"let f = fn(x) { x };",
+		"let f = fn(x) { let y = x; y };",
+		"if (true) { 1 } else { 2 };",
+		"while (false) { break };",
+		"return 1;",
+		`import "lib.monkey";`,
+	}
+
+	for _, input := range accepted {
+		p := New(lexer.New(input), WithStrictSemicolons())
+		p.ParseProgram()
+		checkParserErrors(t, p)
+	}
+
+	rejected := []string{
+		"let x = 5",
+		"let x = 5 let y = 6;",
+		"5 + 5",
+		"let f = fn(x) { let y = x y };",
+		"if (true) { 1 }",
+		"return 1",
+	}
+
+	for _, input := range rejected {
+		p := New(lexer.New(input), WithStrictSemicolons())
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("input %q - expected 1 error, got=%d (%v)", input, len(errors), errors)
+			continue
+		}
+
+		if !strings.HasPrefix(errors[0], "expected next token to be ;") {
+			t.Errorf("input %q - wrong error. got=%q", input, errors[0])
+		}
+	}
+
+	// without the option semicolons stay optional
+	p := New(lexer.New("let x = 5 let y = 6"))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3,]", "[1, 2, 3]"},
+		{"[1,]", "[1]"},
+		{"add(1, 2,)", "add(1, 2)"},
+		{"fn(a, b,) { a }", "fn(a, b) {\n    a\n}"},
+		{`{"a": 1, "b": 2,}`, "{a:1, b:2}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input), WithTrailingCommas())
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	rejected := []string{
+		"[1, 2, 3,]",
+		"add(1, 2,)",
+		"fn(a, b,) { a }",
+		"[1,,]",
+	}
+
+	for _, input := range rejected {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("input %q - expected errors without WithTrailingCommas", input)
+		}
+	}
+
+	p := New(lexer.New("[1,,]"), WithTrailingCommas())
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected a doubled trailing comma to be rejected")
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := "let = 1; let = 2; let = 3; let = 4; let = 5;"
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+	all := len(p.Errors())
+
+	if all <= 2 {
+		t.Fatalf("expected more than 2 errors without a limit, got=%d", all)
+	}
+
+	p = New(lexer.New(input), WithMaxErrors(2))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 2 {
+		t.Errorf("expected the parser to stop at 2 errors, got=%d (%v)", len(errors), errors)
+	}
+
+	p = New(lexer.New("let f = fn() { let = 1; let = 2; let = 3 }"), WithMaxErrors(1))
+	p.ParseProgram()
+	if len(p.Errors()) != 1 {
+		t.Errorf("expected the parser to stop at 1 error inside a block, got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+}
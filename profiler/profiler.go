@@ -0,0 +1,115 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"waiig/evaluator"
+	"waiig/object"
+)
+
+// anonymousNameLength is how many runes of an anonymous function's source are kept to name it
+const anonymousNameLength = 40
+
+// Profiler counts how many times each function is called
+type Profiler struct {
+	calls map[string]int
+
+	// the interpreter reporting its calls to the Profiler, nil when it isn't started
+	in *evaluator.Interpreter
+}
+
+// Entry is how many times the function called Name was called
+type Entry struct {
+	Name  string
+	Calls int
+}
+
+func New() *Profiler {
+	return &Profiler{calls: map[string]int{}}
+}
+
+// Start has in report every function call to p until Stop is called. An interpreter which hasn't been created yet can
+// report to p with evaluator.WithCallHook(p.Record) instead
+func (p *Profiler) Start(in *evaluator.Interpreter) {
+	p.in = in
+	evaluator.WithCallHook(p.Record)(in)
+}
+
+// Stop detaches p from the interpreter it was started with, its counts are kept
+func (p *Profiler) Stop() {
+	if p.in == nil {
+		return
+	}
+
+	evaluator.WithCallHook(nil)(p.in)
+	p.in = nil
+}
+
+// Record counts a call to fn
+func (p *Profiler) Record(fn *object.Function) {
+	p.calls[functionName(fn)]++
+}
+
+// Calls returns how many times each function was called, keyed by function name
+func (p *Profiler) Calls() map[string]int {
+	return p.calls
+}
+
+// Entries returns the call counts, most called first and then by name
+func (p *Profiler) Entries() []Entry {
+	entries := []Entry{}
+	for name, calls := range p.calls {
+		entries = append(entries, Entry{Name: name, Calls: calls})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Calls != entries[j].Calls {
+			return entries[i].Calls > entries[j].Calls
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries
+}
+
+// Report writes a table of the call counts to out, most called first
+func (p *Profiler) Report(out io.Writer) {
+	entries := p.Entries()
+
+	width := len("calls")
+	for _, entry := range entries {
+		width = max(width, len(strconv.Itoa(entry.Calls)))
+	}
+
+	fmt.Fprintf(out, "%*s  %s\n", width, "calls", "function")
+	for _, entry := range entries {
+		fmt.Fprintf(out, "%*d  %s\n", width, entry.Calls, entry.Name)
+	}
+}
+
+// functionName is the name of the let fn was bound to, anonymous functions are named after where their body starts, or
+// the start of their source when the position is unknown
+func functionName(fn *object.Function) string {
+	if fn.Name != "" {
+		return fn.Name
+	}
+
+	if pos := fn.Body.Token.Pos; pos.Line != 0 {
+		return fmt.Sprintf("fn at %d:%d", pos.Line, pos.Column)
+	}
+
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, p.String())
+	}
+
+	source := []rune("fn(" + strings.Join(params, ", ") + ") " + strings.Join(strings.Fields(fn.Body.String()), " "))
+	if len(source) > anonymousNameLength {
+		return string(source[:anonymousNameLength]) + "..."
+	}
+
+	return string(source)
+}
@@ -0,0 +1,100 @@
+package profiler
+
+import (
+	"bytes"
+	"testing"
+	"waiig/evaluator"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+	"waiig/token"
+)
+
+func TestProfilerCountsCalls(t *testing.T) {
+	input := `
+		let foo = fn(x) { x + 1 };
+		let bar = fn(x) { foo(foo(x)) };
+		let i = 0;
+		while (i < 5) { bar(i); i++ };
+		fn(x) { x }(1);
+	`
+
+	in := evaluator.New()
+	p := New()
+	p.Start(in)
+	testEval(t, in, input)
+	// only the interpreter p was started with reports its calls
+	testEval(t, evaluator.New(), "let foo = fn() { 1 }; foo()")
+	p.Stop()
+
+	expected := map[string]int{
+		"foo":       10,
+		"bar":       5,
+		"fn at 6:9": 1,
+	}
+
+	calls := p.Calls()
+	if len(calls) != len(expected) {
+		t.Errorf("wrong number of functions. expected=%d, got=%d (%v)", len(expected), len(calls), calls)
+	}
+
+	for name, count := range expected {
+		if calls[name] != count {
+			t.Errorf("wrong call count for %q. expected=%d, got=%d", name, count, calls[name])
+		}
+	}
+
+	// calls after Stop aren't counted
+	testEval(t, in, "let foo = fn() { 1 }; foo()")
+	if p.Calls()["foo"] != 10 {
+		t.Errorf("calls were counted after Stop. got=%d", p.Calls()["foo"])
+	}
+}
+
+func TestProfilerReport(t *testing.T) {
+	in := evaluator.New()
+	p := New()
+	p.Start(in)
+	testEval(t, in, `
+		let a = fn() { 1 };
+		let b = fn() { a() };
+		let i = 0;
+		while (i < 12) { b(); i++ };
+		let c = fn() { 1 };
+		c();
+	`)
+	p.Stop()
+
+	var out bytes.Buffer
+	p.Report(&out)
+
+	expected := "calls  function\n" +
+		"   12  a\n" +
+		"   12  b\n" +
+		"    1  c\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong report. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestAnonymousFunctionNamesWithoutPosition(t *testing.T) {
+	fn := testEval(t, evaluator.New(), `fn(first, second) { "ééééé" + first + second }`).(*object.Function)
+	fn.Body.Token.Pos = token.Position{}
+
+	expected := "fn(first, second) { ((ééééé + first) + s..."
+	if name := functionName(fn); name != expected {
+		t.Errorf("wrong name. expected=%q, got=%q", expected, name)
+	}
+}
+
+func testEval(t *testing.T, in *evaluator.Interpreter, input string) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("input %q has parser errors: %v", input, p.Errors())
+	}
+
+	return in.Eval(program, object.NewEnvironment())
+}
@@ -0,0 +1,89 @@
+package repl
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// HISTORY_SIZE is how many lines the history keeps, the oldest ones are dropped past it
+const HISTORY_SIZE = 10000
+
+// History is the lines entered in the REPL, oldest first, kept in a file with one line per entry so it carries over
+// to the next session
+type History struct {
+	// the REPL appends and saves from the same goroutine, the lock lets other users of a History share it between
+	// goroutines
+	mu    sync.Mutex
+	path  string
+	lines []string
+}
+
+// Load reads the history from path, which is also where Save writes it to. A missing file is an empty history
+func (h *History) Load(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.path = path
+	h.lines = nil
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.append(line)
+		}
+	}
+
+	return nil
+}
+
+// Append adds line as the newest entry, dropping the oldest one once there are more than HISTORY_SIZE
+func (h *History) Append(line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.append(line)
+}
+
+func (h *History) append(line string) {
+	h.lines = append(h.lines, line)
+
+	if len(h.lines) > HISTORY_SIZE {
+		h.lines = h.lines[len(h.lines)-HISTORY_SIZE:]
+	}
+}
+
+// Save writes the history to the file it was loaded from
+func (h *History) Save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.path == "" {
+		return errors.New("history was never loaded from a file")
+	}
+
+	var b strings.Builder
+	for _, line := range h.lines {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	return os.WriteFile(h.path, []byte(b.String()), 0o600)
+}
+
+// Lines returns the entries, oldest first
+func (h *History) Lines() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]string{}, h.lines...)
+}
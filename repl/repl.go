@@ -2,66 +2,542 @@ package repl
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 	"waiig/evaluator"
+	"waiig/inspector"
 	"waiig/lexer"
+	"waiig/lineedit"
 	"waiig/object"
 	"waiig/parser"
+	"waiig/serializer"
+	"waiig/std"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+const TIME_COMMAND = ":time "
+
+// SAVE_COMMAND writes the functions defined in the session, with everything they close over, to a file which
+// RESTORE_COMMAND reads back into another session
+const (
+	SAVE_COMMAND    = ":save "
+	RESTORE_COMMAND = ":restore "
+)
+
+// EVAL_TIMEOUT is how long a line can take to evaluate before it's cancelled, so a runaway loop doesn't hang the REPL
+const EVAL_TIMEOUT = 30 * time.Second
+
+// Results nested deeper than PRETTY_PRINT_DEPTH or with more than PRETTY_PRINT_SIZE elements are pretty printed
+const (
+	PRETTY_PRINT_DEPTH = 2
+	PRETTY_PRINT_SIZE  = 10
+)
+
+// RC_FILE is the user's configuration, evaluated from the home directory before the standard library, RC_PATH_ENV
+// points to another file instead
+const (
+	RC_FILE     = ".waiigrc"
+	RC_PATH_ENV = "WAIIG_RC"
+)
+
+// HISTORY_FILE keeps the lines entered in previous sessions, in the home directory, HISTORY_PATH_ENV points to
+// another file instead and setting it to an empty string turns the history off
+const (
+	HISTORY_FILE     = ".waiig_history"
+	HISTORY_PATH_ENV = "WAIIG_HISTORY"
+)
+
+// STD_PATH_ENV is the environment variable which overrides the standard library files that get loaded
+const STD_PATH_ENV = "WAIIG_STD"
+
+// ANSI escape codes used to color the output
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+// ErrInterrupted is returned by Start when the REPL is stopped by an interrupt, e.g. Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// Start runs the REPL, coloring its output when out is a terminal, unless the NO_COLOR environment variable is set.
+// When in is a terminal lines are read with a line editor, where Tab completes the identifier before the cursor and
+// up and down go through the history. It returns nil once in is exhausted and ErrInterrupted when interrupted, leaving
+// it to the caller to exit. opts configure the interpreter the session runs in
+func Start(in io.Reader, out io.Writer, opts ...evaluator.Option) error {
+	return StartWithColor(in, out, shouldColor(out), opts...)
+}
+
+// StartWithColor runs the REPL, color sets whether results and errors are colored rather than detecting it
+func StartWithColor(in io.Reader, out io.Writer, color bool, opts ...evaluator.Option) error {
 	env := object.NewEnvironment()
+	// a single interpreter for the session, closures from earlier lines run in it too
+	interp := evaluator.New(opts...)
+
+	history := loadHistory(out)
+	if history != nil {
+		defer saveHistory(out, history)
+	}
+
+	// an interrupt cancels the line being evaluated and stops the REPL, which returns rather than exits so that the
+	// history is still saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	loadRC(out, interp, env)
+	loadStd(out, interp, env)
 
-	parseStd(env)
+	readLine := scanLines(in)
+	var editor *lineedit.Editor
+	if f, ok := in.(*os.File); ok && lineedit.IsTerminal(f) {
+		editor = newEditor(f, env, history)
+		defer editor.Close()
+		readLine = editor.ReadLine
+	}
+
+	// lines are read on their own so that waiting for one doesn't keep an interrupt from being noticed, the next one
+	// is only asked for once the last one is handled so the prompt doesn't show up in the middle of its output
+	lines := make(chan string)
+	handled := make(chan struct{})
+	go func() {
+		defer close(lines)
+
+		for {
+			line, err := readLine(PROMPT)
+			if err != nil {
+				return
+			}
+
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case <-handled:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
 	for {
-		fmt.Print(PROMPT)
-		scanned := scanner.Scan()
+		select {
+		case <-ctx.Done():
+			return ErrInterrupted
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+
+			if handleLine(ctx, out, line, interp, env, color) && strings.TrimSpace(line) != "" {
+				if history != nil {
+					history.Append(line)
+				}
+				if editor != nil {
+					editor.AddHistory(line)
+				}
+			}
+
+			select {
+			case handled <- struct{}{}:
+			case <-ctx.Done():
+				return ErrInterrupted
+			}
+		}
+	}
+}
+
+// scanLines reads the lines of in as they are, for when it isn't a terminal, e.g. when input is piped in
+func scanLines(in io.Reader) func(prompt string) (string, error) {
+	scanner := bufio.NewScanner(in)
+
+	return func(prompt string) (string, error) {
+		fmt.Print(prompt)
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+
+		return scanner.Text(), nil
+	}
+}
+
+// newEditor returns a line editor reading from the terminal in, which completes identifiers bound in env and starts off
+// with the lines in history
+func newEditor(in *os.File, env *object.Environment, history *History) *lineedit.Editor {
+	editor := lineedit.New(in, os.Stdout)
+	editor.Complete = func(line string) (string, []string) {
+		return CompleteLine(line, env)
+	}
+
+	if history != nil {
+		for _, line := range history.Lines() {
+			editor.AddHistory(line)
+		}
+	}
+
+	return editor
+}
+
+// loadHistory loads the history from HISTORY_PATH_ENV if it's set, otherwise from HISTORY_FILE in the home directory,
+// it's nil when the history is turned off or can't be loaded
+func loadHistory(out io.Writer) *History {
+	path, ok := os.LookupEnv(HISTORY_PATH_ENV)
+	if !ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, HISTORY_FILE)
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	history := &History{}
+	if err := history.Load(path); err != nil {
+		fmt.Fprintf(out, "warning: not keeping history: %s\n", err)
+		return nil
+	}
+
+	return history
+}
+
+func saveHistory(out io.Writer, history *History) {
+	if err := history.Save(); err != nil {
+		fmt.Fprintf(out, "warning: could not save history: %s\n", err)
+	}
+}
+
+// ExitError is returned by RunFile when the program called `exit`, Code is the status it exited with
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// RunFile evaluates the program at path after loading the standard library, rather than reading lines from the user,
+// in an interpreter configured by opts
+func RunFile(out io.Writer, path string, opts ...evaluator.Option) error {
+	env := object.NewEnvironment()
+	interp := evaluator.New(opts...)
+
+	loadStd(out, interp, env)
+
+	return parseFile(path, interp, env)
+}
+
+// handleLine runs a line entered in the REPL, it reports whether the line ran without errors. Evaluating the line stops
+// once ctx is done
+func handleLine(ctx context.Context, out io.Writer, line string, interp *evaluator.Interpreter, env *object.Environment, color bool) bool {
+	// `:time <input>` evaluates input as usual and then prints how long parsing and evaluating it took
+	if input, ok := strings.CutPrefix(line, TIME_COMMAND); ok {
+		start := time.Now()
+		succeeded := evalLine(ctx, out, input, interp, env, color)
+		fmt.Fprintf(out, "took %s\n", time.Since(start))
+		return succeeded
+	}
+
+	if path, ok := strings.CutPrefix(line, SAVE_COMMAND); ok {
+		if err := saveSession(out, strings.TrimSpace(path), env); err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+			return false
+		}
+		return true
+	}
+
+	if path, ok := strings.CutPrefix(line, RESTORE_COMMAND); ok {
+		if err := restoreSession(out, strings.TrimSpace(path), env); err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+			return false
+		}
+		return true
+	}
+
+	return evalLine(ctx, out, line, interp, env, color)
+}
+
+func evalLine(ctx context.Context, out io.Writer, line string, interp *evaluator.Interpreter, env *object.Environment, color bool) bool {
+	l := lexer.New(line)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors(), color)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, EVAL_TIMEOUT)
+	defer cancel()
 
-		if !scanned {
+	evaluated := interp.EvalContext(ctx, program, env)
+
+	// exit only stops the line it's on, the session keeps going
+	if _, ok := evaluated.(*object.Exit); ok {
+		return true
+	}
+
+	if evaluated != nil {
+		io.WriteString(out, formatObject(evaluated, color))
+		io.WriteString(out, "\n")
+	}
+
+	err, failed := evaluated.(*object.Error)
+	failed = failed && !err.Value
+
+	return !failed
+}
+
+// saveSession writes every function bound in env to path, bindings which can't be saved are skipped with a warning
+func saveSession(out io.Writer, path string, env *object.Environment) error {
+	fns := map[string]*object.Function{}
+	for name, value := range env.Bindings() {
+		if fn, ok := value.(*object.Function); ok {
+			fns[name] = fn
+		}
+	}
+
+	data, skipped, err := serializer.MarshalClosures(fns)
+	if err != nil {
+		return err
+	}
+
+	for _, binding := range skipped {
+		fmt.Fprintf(out, "warning: skipping %s\n", binding)
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// restoreSession binds the functions saved to path by saveSession in env, replacing existing bindings of the same name
+func restoreSession(out io.Writer, path string, env *object.Environment) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fns, err := serializer.UnmarshalClosures(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	names := []string{}
+	for name, fn := range fns {
+		env.Set(name, fn)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(out, "restored %s\n", strings.Join(names, ", "))
+
+	return nil
+}
+
+// loadRC evaluates the user's configuration into env, RC_PATH_ENV if it's set, otherwise RC_FILE in the home
+// directory when there's one. Errors are only warned about
+func loadRC(out io.Writer, interp *evaluator.Interpreter, env *object.Environment) {
+	path, ok := os.LookupEnv(RC_PATH_ENV)
+	if !ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
+		path = filepath.Join(home, RC_FILE)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+	}
 
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
+	if err := parseFile(path, interp, env); err != nil {
+		fmt.Fprintf(out, "warning: skipping %s: %s\n", RC_FILE, err)
+	}
+}
+
+// loadStd evaluates the standard library into env, by default the one embedded in the binary, STD_PATH_ENV can list
+// other files to load instead, separated like PATH is. Files which can't be loaded are skipped with a warning. Names
+// env already binds, like the rc file's, are kept rather than replaced by the std ones, std is evaluated in an
+// environment of its own so its functions keep using each other either way
+func loadStd(out io.Writer, interp *evaluator.Interpreter, env *object.Environment) {
+	stdEnv := object.NewEnclosedEnvironment(env)
+	evalStd(out, interp, stdEnv)
+
+	for name, value := range stdEnv.Bindings() {
+		env.SetIfAbsent(name, value)
+	}
+}
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
+func evalStd(out io.Writer, interp *evaluator.Interpreter, env *object.Environment) {
+	if paths, ok := os.LookupEnv(STD_PATH_ENV); ok {
+		for _, path := range filepath.SplitList(paths) {
+			if err := parseFile(path, interp, env); err != nil {
+				fmt.Fprintf(out, "warning: skipping std file: %s\n", err)
+			}
 		}
+		return
+	}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+	names, _ := fs.Glob(std.Files, "*.monkey")
+	for _, name := range names {
+		data, err := std.Files.ReadFile(name)
+		if err == nil {
+			err = parseSource(name, string(data), interp, env)
+		}
+
+		if err != nil {
+			fmt.Fprintf(out, "warning: skipping std file: %s\n", err)
 		}
 	}
 }
 
-func parseStd(env *object.Environment) {
-	data, err := os.ReadFile("std/std.monkey")
+// parseFile evaluates the file at path into env, failing if it can't be read, parsed or evaluated
+func parseFile(path string, interp *evaluator.Interpreter, env *object.Environment) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	input := string(data)
+	return parseSource(path, string(data), interp, env)
+}
 
+// parseSource evaluates input into env, name is only used in errors
+func parseSource(name string, input string, interp *evaluator.Interpreter, env *object.Environment) error {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	evaluator.Eval(program, env)
+
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("%s has parser errors:\n\t%s", name, strings.Join(p.Errors(), "\n\t"))
+	}
+
+	evaluated := interp.Eval(program, env)
+	if exit, ok := evaluated.(*object.Exit); ok {
+		return &ExitError{Code: int(exit.Code)}
+	}
+	if isError(evaluated) {
+		return fmt.Errorf("%s failed: %s", name, evaluated.Inspect())
+	}
+
+	return nil
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+func isError(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && !err.Value
+}
+
+// Complete returns the sorted builtins and variables bound in env which start with prefix, it's meant to back tab
+// completion, so the match is case-sensitive and an empty prefix matches everything
+func Complete(prefix string, env *object.Environment) []string {
+	seen := map[string]bool{}
+	candidates := []string{}
+
+	for _, name := range append(evaluator.BuiltinNames(), env.Names()...) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+
+	sort.Strings(candidates)
+
+	return candidates
+}
+
+// CompleteLine completes the identifier the cursor is at the end of in line, returning the candidates for it along
+// with the partial identifier they'd replace
+func CompleteLine(line string, env *object.Environment) (string, []string) {
+	start := len(line)
+	for start > 0 && isIdentifierChar(line[start-1]) {
+		start--
+	}
+
+	// identifiers can't start with a digit, so in `x1 + 12` there's nothing to complete
+	for start < len(line) && '0' <= line[start] && line[start] <= '9' {
+		start++
+	}
+
+	prefix := line[start:]
+
+	return prefix, Complete(prefix, env)
+}
+
+// isIdentifierChar matches the lexer, which allows letters, underscores and, after the first character, digits in
+// identifiers
+func isIdentifierChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || '0' <= ch && ch <= '9'
+}
+
+func printParserErrors(out io.Writer, errors []string, color bool) {
 	for _, msg := range errors {
+		if color {
+			msg = colorRed + msg + colorReset
+		}
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+// formatObject is obj's Inspect, when colored strings are also quoted so they can be told apart from other values.
+// Values too large to read on one line are pretty printed instead
+func formatObject(obj object.Object, color bool) string {
+	if inspector.Depth(obj) > PRETTY_PRINT_DEPTH || inspector.Size(obj) > PRETTY_PRINT_SIZE {
+		return inspector.PrettyPrintString(obj)
+	}
+
+	if !color {
+		return obj.Inspect()
+	}
+
+	switch obj.Type() {
+	case object.ERROR_OBJ:
+		return colorRed + obj.Inspect() + colorReset
+	case object.STRING_OBJ:
+		return colorGreen + `"` + obj.Inspect() + `"` + colorReset
+	case object.INTEGER_OBJ:
+		return colorCyan + obj.Inspect() + colorReset
+	case object.BOOLEAN_OBJ, object.NULL_OBJ:
+		return colorYellow + obj.Inspect() + colorReset
+	default:
+		return obj.Inspect()
+	}
+}
+
+// shouldColor reports whether out is a terminal, piped or redirected output isn't colored, nor is anything when
+// NO_COLOR is set
+func shouldColor(out io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,638 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"waiig/evaluator"
+	"waiig/object"
+)
+
+func TestMain(m *testing.M) {
+	// the tests starting the REPL would otherwise write to the user's history
+	os.Setenv(HISTORY_PATH_ENV, "")
+
+	os.Exit(m.Run())
+}
+
+func TestFormatObjectWithoutColor(t *testing.T) {
+	tests := []object.Object{
+		&object.Integer{Value: 5},
+		&object.String{Value: "hi"},
+		&object.Boolean{Value: true},
+		&object.Null{},
+		&object.Error{Message: "boom"},
+		&object.Array{Elements: []object.Object{&object.String{Value: "a"}}},
+	}
+
+	for _, obj := range tests {
+		actual := formatObject(obj, false)
+
+		if actual != obj.Inspect() {
+			t.Errorf("uncolored output should be Inspect. expected=%q, got=%q", obj.Inspect(), actual)
+		}
+		if strings.Contains(actual, "\x1b[") {
+			t.Errorf("uncolored output contains ANSI codes. got=%q", actual)
+		}
+	}
+}
+
+func TestFormatObjectWithColor(t *testing.T) {
+	tests := []struct {
+		obj      object.Object
+		expected string
+	}{
+		{&object.Integer{Value: 5}, colorCyan + "5" + colorReset},
+		{&object.String{Value: "hi"}, colorGreen + `"hi"` + colorReset},
+		{&object.Null{}, colorYellow + "null" + colorReset},
+		{&object.Error{Message: "boom"}, colorRed + "ERROR: boom" + colorReset},
+	}
+
+	for _, tt := range tests {
+		actual := formatObject(tt.obj, true)
+
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestFormatObjectPrettyPrintsLargeValues(t *testing.T) {
+	env := object.NewEnvironment()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3]", "[1, 2, 3]"},
+		{"[[1, 2], [3, 4]]", "[[1, 2], [3, 4]]"},
+		{"[[[1]]]", "[[[1]]]"},
+		{"1:12", "1:12"},
+		{`[[[1]], 2, 3, 4]`, "[\n  [[1]],\n  2,\n  3,\n  4\n]"},
+		{`{"a": [[1]]}`, "{\n  a: [[1]]\n}"},
+		{"[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]", "[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		evalLine(context.Background(), &out, tt.input, evaluator.New(), env, false)
+
+		if out.String() != tt.expected+"\n" {
+			t.Errorf("input %q - expected=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestPrintParserErrorsWithoutColor(t *testing.T) {
+	var out bytes.Buffer
+
+	printParserErrors(&out, []string{"first", "second"}, false)
+
+	if out.String() != "\tfirst\n\tsecond\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestShouldColor(t *testing.T) {
+	if shouldColor(&bytes.Buffer{}) {
+		t.Errorf("output which isn't a terminal should not be colored")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("length", &object.Integer{Value: 1})
+	env.Set("Lenient", &object.Integer{Value: 2})
+	inner := object.NewEnclosedEnvironment(env)
+	inner.Set("lever", &object.Integer{Value: 3})
+	// shadows the builtin, it should still only be offered once
+	inner.Set("len", &object.Integer{Value: 4})
+
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"le", []string{"len", "length", "lever"}},
+		{"Le", []string{"Lenient"}},
+		{"lev", []string{"lever"}},
+		{"push", []string{"push", "push_stack"}},
+		{"nothing", []string{}},
+	}
+
+	for _, tt := range tests {
+		actual := Complete(tt.prefix, inner)
+
+		if strings.Join(actual, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("prefix %q - expected=%v, got=%v", tt.prefix, tt.expected, actual)
+		}
+	}
+
+	if all := Complete("", inner); len(all) < len(evaluator.BuiltinNames()) {
+		t.Errorf("empty prefix should match every builtin. got=%v", all)
+	}
+}
+
+func TestCompleteLine(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("total", &object.Integer{Value: 1})
+
+	prefix, candidates := CompleteLine("let x = to", env)
+	if prefix != "to" {
+		t.Errorf("wrong prefix. expected=%q, got=%q", "to", prefix)
+	}
+	if strings.Join(candidates, ",") != "total" {
+		t.Errorf("wrong candidates. got=%v", candidates)
+	}
+
+	prefix, _ = CompleteLine("len(", env)
+	if prefix != "" {
+		t.Errorf("wrong prefix after a paren. expected empty, got=%q", prefix)
+	}
+
+	prefix, candidates = CompleteLine("base64E", env)
+	if prefix != "base64E" || strings.Join(candidates, ",") != "base64Encode" {
+		t.Errorf("wrong completion of an identifier with digits. got prefix=%q, candidates=%v", prefix, candidates)
+	}
+
+	prefix, _ = CompleteLine("x + 12", env)
+	if prefix != "" {
+		t.Errorf("wrong prefix after a number. expected empty, got=%q", prefix)
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedOutput string
+	}{
+		{":time 1 + 2", "3\n"},
+		{":time let x = 5", ""},
+		{":time 1 + true", "ERROR: line 1, col 3: type mismatch: INTEGER + BOOLEAN\n"},
+		{":time let = 5", "\texpected next token to be IDENT, got = instead\n\tno prefix parse function for = found\n"},
+	}
+
+	durationLine := regexp.MustCompile(`^took \d+(\.\d+)?(ns|µs|ms|s)\n$`)
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		handleLine(context.Background(), &out, tt.input, evaluator.New(), object.NewEnvironment(), false)
+
+		output := out.String()
+		if !strings.HasPrefix(output, tt.expectedOutput) {
+			t.Errorf("input %q - expected output to start with %q, got=%q", tt.input, tt.expectedOutput, output)
+			continue
+		}
+
+		if duration := strings.TrimPrefix(output, tt.expectedOutput); !durationLine.MatchString(duration) {
+			t.Errorf("input %q - expected a duration after the result, got=%q", tt.input, duration)
+		}
+	}
+}
+
+func TestLinesWithoutTimeCommandAreNotTimed(t *testing.T) {
+	var out bytes.Buffer
+	handleLine(context.Background(), &out, "1 + 2", evaluator.New(), object.NewEnvironment(), false)
+
+	if out.String() != "3\n" {
+		t.Errorf("wrong output. expected=%q, got=%q", "3\n", out.String())
+	}
+}
+
+func TestStartWithMissingStdFile(t *testing.T) {
+	t.Setenv(STD_PATH_ENV, filepath.Join(t.TempDir(), "missing.monkey"))
+
+	var out bytes.Buffer
+	StartWithColor(strings.NewReader("1 + 2\n"), &out, false)
+
+	output := out.String()
+	if !strings.HasPrefix(output, "warning: skipping std file: ") {
+		t.Errorf("expected a warning about the missing std file, got=%q", output)
+	}
+	if !strings.HasSuffix(output, "\n3\n") {
+		t.Errorf("expected the REPL to keep going after the warning, got=%q", output)
+	}
+}
+
+func TestStartWithMultipleStdFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.monkey")
+	second := filepath.Join(dir, "second.monkey")
+	broken := filepath.Join(dir, "broken.monkey")
+
+	if err := os.WriteFile(first, []byte("let double = fn(x) { x * 2 };"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("let quadruple = fn(x) { double(double(x)) };"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(broken, []byte("let = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(STD_PATH_ENV, strings.Join([]string{first, broken, second}, string(filepath.ListSeparator)))
+
+	var out bytes.Buffer
+	StartWithColor(strings.NewReader("quadruple(3)\n"), &out, false)
+
+	output := out.String()
+	if !strings.HasPrefix(output, "warning: skipping std file: "+broken+" has parser errors:\n") {
+		t.Errorf("expected a warning about the broken std file, got=%q", output)
+	}
+	if !strings.HasSuffix(output, "\n12\n") {
+		t.Errorf("expected the std files to be loaded in order, got=%q", output)
+	}
+}
+
+func TestStartWithEmbeddedStd(t *testing.T) {
+	unsetenv(t, STD_PATH_ENV)
+
+	var out bytes.Buffer
+	StartWithColor(strings.NewReader("first(rest([1, 2, 3]))\n"), &out, false)
+
+	if out.String() != "2\n" {
+		t.Errorf("expected the embedded std to be loaded, got=%q", out.String())
+	}
+}
+
+func TestEmbeddedStdDoesNotShadowBuiltins(t *testing.T) {
+	unsetenv(t, STD_PATH_ENV)
+
+	var out bytes.Buffer
+	StartWithColor(strings.NewReader("sum([1, \"two\"])\n"), &out, false)
+
+	expected := "ERROR: line 1, col 4: element 1 of `sum` must be INTEGER, got STRING\n"
+	if out.String() != expected {
+		t.Errorf("expected the sum builtin to be called. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartLoadsRCFromHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	unsetenv(t, RC_PATH_ENV)
+
+	rc := "let greet = fn(name) { \"hi \" + name };"
+	if err := os.WriteFile(filepath.Join(home, RC_FILE), []byte(rc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	StartWithColor(strings.NewReader("greet(\"monkey\")\n"), &out, false)
+
+	if out.String() != "hi monkey\n" {
+		t.Errorf("expected the rc file to be loaded, got=%q", out.String())
+	}
+}
+
+func TestRCBindingsShadowStd(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	unsetenv(t, RC_PATH_ENV)
+	unsetenv(t, STD_PATH_ENV)
+
+	rc := "let first = fn(arr) { \"mine\" };"
+	if err := os.WriteFile(filepath.Join(home, RC_FILE), []byte(rc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	StartWithColor(strings.NewReader("first([1, 2])\nmap([1, 2], fn(x) { x * 2 })\n"), &out, false)
+
+	// the rc's first isn't replaced by std's, and std's map keeps using its own first
+	if out.String() != "mine\n[2, 4]\n" {
+		t.Errorf("wrong output. expected=%q, got=%q", "mine\n[2, 4]\n", out.String())
+	}
+}
+
+func TestStartWithoutRC(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	unsetenv(t, RC_PATH_ENV)
+
+	var out bytes.Buffer
+	StartWithColor(strings.NewReader("1\n"), &out, false)
+
+	if out.String() != "1\n" {
+		t.Errorf("a missing rc file in the home directory should be ignored, got=%q", out.String())
+	}
+}
+
+func TestStartWithBrokenRC(t *testing.T) {
+	dir := t.TempDir()
+
+	broken := filepath.Join(dir, "broken")
+	failing := filepath.Join(dir, "failing")
+	missing := filepath.Join(dir, "missing")
+
+	if err := os.WriteFile(broken, []byte("let = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(failing, []byte("let x = 1 + true;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{broken, "warning: skipping .waiigrc: " + broken + " has parser errors:\n"},
+		{failing, "warning: skipping .waiigrc: " + failing + " failed: ERROR: line 1, col 11: type mismatch: INTEGER + BOOLEAN\n"},
+		{missing, "warning: skipping .waiigrc: open " + missing + ": no such file or directory\n"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(RC_PATH_ENV, tt.path)
+
+		var out bytes.Buffer
+		StartWithColor(strings.NewReader("1 + 2\n"), &out, false)
+
+		if !strings.HasPrefix(out.String(), tt.expected) {
+			t.Errorf("rc %s - expected a warning starting with %q, got=%q", tt.path, tt.expected, out.String())
+		}
+		if !strings.HasSuffix(out.String(), "\n3\n") {
+			t.Errorf("rc %s - expected the REPL to keep going after the warning, got=%q", tt.path, out.String())
+		}
+	}
+}
+
+// unsetenv unsets key for the rest of the test
+func unsetenv(t *testing.T, key string) {
+	t.Helper()
+
+	if value, ok := os.LookupEnv(key); ok {
+		os.Unsetenv(key)
+		t.Cleanup(func() { os.Setenv(key, value) })
+	}
+}
+
+func TestExitOnlyStopsTheLine(t *testing.T) {
+	env := object.NewEnvironment()
+	interp := evaluator.New()
+
+	var out bytes.Buffer
+	handleLine(context.Background(), &out, "let x = 1; exit(2); x = 5", interp, env, false)
+	handleLine(context.Background(), &out, "x", interp, env, false)
+
+	if out.String() != "1\n" {
+		t.Errorf("expected exit to stop the line without printing, got=%q", out.String())
+	}
+}
+
+func TestRunFileExit(t *testing.T) {
+	unsetenv(t, STD_PATH_ENV)
+
+	path := filepath.Join(t.TempDir(), "program.monkey")
+	if err := os.WriteFile(path, []byte("let i = 0;\nwhile (true) { if (i == 3) { exit(i) }; i++ };\n1 + true"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := RunFile(&out, path)
+
+	exit, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("expected an ExitError, got=%T (%v)", err, err)
+	}
+	if exit.Code != 3 {
+		t.Errorf("wrong exit code. expected=3, got=%d", exit.Code)
+	}
+}
+
+func TestSaveAndRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	env := object.NewEnvironment()
+	interp := evaluator.New()
+	var out bytes.Buffer
+	handleLine(context.Background(), &out, "let makeAdder = fn(x) { fn(y) { x + y } }; let addTwo = makeAdder(2); let n = 5;", interp, env, false)
+	handleLine(context.Background(), &out, ":save "+path, interp, env, false)
+
+	if out.String() != "" {
+		t.Fatalf("expected save to print nothing, got=%q", out.String())
+	}
+
+	fresh := object.NewEnvironment()
+	handleLine(context.Background(), &out, ":restore "+path, interp, fresh, false)
+	handleLine(context.Background(), &out, "addTwo(3)", interp, fresh, false)
+	handleLine(context.Background(), &out, "makeAdder(10)(1)", interp, fresh, false)
+
+	expected := "restored addTwo, makeAdder\n5\n11\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+
+	// only functions are saved, n is left behind
+	if _, ok := fresh.Get("n"); ok {
+		t.Errorf("expected n not to be restored")
+	}
+}
+
+func TestSaveSkipsUnserializableBindings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	env := object.NewEnvironment()
+	interp := evaluator.New()
+	var out bytes.Buffer
+	handleLine(context.Background(), &out, `let table = {1: "one"}; let twice = fn(x) { x * 2 };`, interp, env, false)
+	handleLine(context.Background(), &out, ":save "+path, interp, env, false)
+
+	expected := "warning: skipping table: hash keys must be STRING to be serialized, got INTEGER\n"
+	if out.String() != expected {
+		t.Fatalf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	handleLine(context.Background(), &out, ":restore "+path, interp, object.NewEnvironment(), false)
+	if out.String() != "restored twice\n" {
+		t.Errorf("expected twice to be restored, got=%q", out.String())
+	}
+}
+
+func TestRestoreMissingFile(t *testing.T) {
+	var out bytes.Buffer
+	handleLine(context.Background(), &out, ":restore "+filepath.Join(t.TempDir(), "missing.json"), evaluator.New(), object.NewEnvironment(), false)
+
+	if !strings.HasPrefix(out.String(), "error: ") {
+		t.Errorf("expected an error, got=%q", out.String())
+	}
+}
+
+func TestHistoryLoadAppendSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("let x = 1\nx + 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	history := &History{}
+	if err := history.Load(path); err != nil {
+		t.Fatalf("unexpected load error: %s", err)
+	}
+
+	history.Append("x * 2")
+
+	expected := []string{"let x = 1", "x + 1", "x * 2"}
+	if !reflect.DeepEqual(history.Lines(), expected) {
+		t.Errorf("wrong lines. expected=%q, got=%q", expected, history.Lines())
+	}
+
+	if err := history.Save(); err != nil {
+		t.Fatalf("unexpected save error: %s", err)
+	}
+
+	reloaded := &History{}
+	if err := reloaded.Load(path); err != nil {
+		t.Fatalf("unexpected load error: %s", err)
+	}
+
+	if !reflect.DeepEqual(reloaded.Lines(), expected) {
+		t.Errorf("wrong lines after reloading. expected=%q, got=%q", expected, reloaded.Lines())
+	}
+}
+
+func TestHistoryMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	history := &History{}
+	if err := history.Load(path); err != nil {
+		t.Fatalf("a missing file should be an empty history, got=%s", err)
+	}
+
+	if len(history.Lines()) != 0 {
+		t.Errorf("expected no lines, got=%q", history.Lines())
+	}
+
+	history.Append("1")
+	if err := history.Save(); err != nil {
+		t.Fatalf("unexpected save error: %s", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "1\n" {
+		t.Errorf("wrong file contents. got=%q", data)
+	}
+
+	if err := (&History{}).Save(); err == nil {
+		t.Errorf("expected an error saving a history which was never loaded")
+	}
+}
+
+func TestHistoryRollover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	history := &History{}
+	if err := history.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < HISTORY_SIZE+5; i++ {
+		history.Append(strconv.Itoa(i))
+	}
+
+	lines := history.Lines()
+	if len(lines) != HISTORY_SIZE {
+		t.Fatalf("wrong number of lines. expected=%d, got=%d", HISTORY_SIZE, len(lines))
+	}
+	if lines[0] != "5" || lines[len(lines)-1] != strconv.Itoa(HISTORY_SIZE+4) {
+		t.Errorf("expected the oldest lines to be dropped, got first=%q last=%q", lines[0], lines[len(lines)-1])
+	}
+
+	if err := history.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := &History{}
+	if err := reloaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded.Lines(), lines) {
+		t.Errorf("expected the saved history to match")
+	}
+}
+
+func TestStartKeepsHistory(t *testing.T) {
+	unsetenv(t, STD_PATH_ENV)
+
+	path := filepath.Join(t.TempDir(), "history")
+	t.Setenv(HISTORY_PATH_ENV, path)
+
+	var out bytes.Buffer
+	StartWithColor(strings.NewReader("let x = 1\n\n1 + true\nlet = 2\nx + 1\n"), &out, false)
+
+	history := &History{}
+	if err := history.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// lines which failed aren't kept
+	expected := []string{"let x = 1", "x + 1"}
+	if !reflect.DeepEqual(history.Lines(), expected) {
+		t.Errorf("wrong history. expected=%q, got=%q", expected, history.Lines())
+	}
+
+	StartWithColor(strings.NewReader("2\n"), &out, false)
+
+	if err := history.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = append(expected, "2")
+	if !reflect.DeepEqual(history.Lines(), expected) {
+		t.Errorf("expected the next session to add to the history. expected=%q, got=%q", expected, history.Lines())
+	}
+}
+
+func TestStartReturnsOnInterrupt(t *testing.T) {
+	unsetenv(t, STD_PATH_ENV)
+
+	path := filepath.Join(t.TempDir(), "history")
+	t.Setenv(HISTORY_PATH_ENV, path)
+
+	in, input := io.Pipe()
+	output, out := io.Pipe()
+	defer input.Close()
+
+	done := make(chan error)
+	go func() {
+		done <- StartWithColor(in, out, false)
+	}()
+
+	// once the result is printed the line was handled, and the interrupt is being listened for
+	go io.WriteString(input, "1 + 1\n")
+	result := make([]byte, 2)
+	if _, err := io.ReadFull(output, result); err != nil || string(result) != "2\n" {
+		t.Fatalf("wrong result. got=%q (%v)", result, err)
+	}
+	go io.Copy(io.Discard, output)
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skipf("can't interrupt the test process: %s", err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrInterrupted) {
+			t.Errorf("expected ErrInterrupted, got=%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the REPL didn't stop after the interrupt")
+	}
+
+	history := &History{}
+	if err := history.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(history.Lines(), []string{"1 + 1"}) {
+		t.Errorf("expected the history to be saved, got=%q", history.Lines())
+	}
+}
@@ -0,0 +1,239 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"waiig/ast"
+	"waiig/token"
+)
+
+// Nodes are written as their exported fields plus the name of their type, e.g.
+// `{"__node":"Identifier","Token":{...},"Value":"x"}`, they're read back by setting the same fields through reflection
+// so every node type has to be listed here
+var nodeTypes = map[string]reflect.Type{}
+
+func init() {
+	nodes := []ast.Node{
+		&ast.Program{},
+		&ast.LetStatement{},
+		&ast.ImportStatement{},
+		&ast.ReturnStatement{},
+		&ast.BreakStatement{},
+		&ast.ContinueStatement{},
+		&ast.ExpressionStatement{},
+		&ast.BlockStatement{},
+		&ast.Identifier{},
+		&ast.IntegerLiteral{},
+		&ast.Boolean{},
+		&ast.Null{},
+		&ast.StringLiteral{},
+		&ast.PrefixExpression{},
+		&ast.PostfixExpression{},
+		&ast.InfixExpression{},
+		&ast.IfExpression{},
+		&ast.WhileExpression{},
+		&ast.DoWhileExpression{},
+		&ast.LoopExpression{},
+		&ast.ForInExpression{},
+		&ast.FunctionLiteral{},
+		&ast.CallExpression{},
+		&ast.ArrayLiteral{},
+		&ast.IndexExpression{},
+		&ast.RangeExpression{},
+		&ast.HashLiteral{},
+		&ast.AssignExpression{},
+		&ast.PipeExpression{},
+		&ast.MethodCallExpression{},
+		&ast.DotExpression{},
+		&ast.CoalesceExpression{},
+		&ast.ComparisonChain{},
+	}
+
+	for _, node := range nodes {
+		t := reflect.TypeOf(node).Elem()
+		nodeTypes[t.Name()] = t
+	}
+}
+
+const nodeTypeField = "__node"
+
+var (
+	nodeInterface = reflect.TypeOf((*ast.Node)(nil)).Elem()
+	tokenType     = reflect.TypeOf(token.Token{})
+)
+
+// marshalAST serializes v, a node or any of the values found in nodes, e.g. a function's []*ast.Identifier parameters
+func marshalAST(v interface{}) (json.RawMessage, error) {
+	enc, err := encodeAST(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(enc)
+}
+
+// unmarshalAST reads back a value serialized by marshalAST into target, which must be a pointer to its type
+func unmarshalAST(data json.RawMessage, target interface{}) error {
+	ptr := reflect.ValueOf(target)
+
+	value, err := decodeAST(data, ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	ptr.Elem().Set(value)
+
+	return nil
+}
+
+func encodeAST(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return encodeAST(v.Elem())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if !v.Type().Implements(nodeInterface) {
+			return nil, fmt.Errorf("cannot serialize %s", v.Type())
+		}
+
+		fields, err := encodeFields(v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		fields[nodeTypeField] = v.Elem().Type().Name()
+		return fields, nil
+	case reflect.Struct:
+		if v.Type() == tokenType {
+			return v.Interface(), nil
+		}
+		return encodeFields(v)
+	case reflect.Slice:
+		elements := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			element, err := encodeAST(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return elements, nil
+	default:
+		return v.Interface(), nil
+	}
+}
+
+func encodeFields(v reflect.Value) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	for i := 0; i < v.NumField(); i++ {
+		field, err := encodeAST(v.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		fields[v.Type().Field(i).Name] = field
+	}
+
+	return fields, nil
+}
+
+func decodeAST(data json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	isNull := len(data) == 0 || bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+
+	switch t.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if isNull {
+			return reflect.Zero(t), nil
+		}
+
+		node, err := decodeNode(data)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if !node.Type().AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("cannot deserialize %s as %s", node.Type(), t)
+		}
+		return node, nil
+	case reflect.Struct:
+		if t == tokenType {
+			break
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return reflect.Value{}, err
+		}
+		return decodeFields(fields, t)
+	case reflect.Slice:
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return reflect.Value{}, err
+		}
+
+		slice := reflect.MakeSlice(t, 0, len(elements))
+		for _, element := range elements {
+			value, err := decodeAST(element, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice = reflect.Append(slice, value)
+		}
+		return slice, nil
+	}
+
+	value := reflect.New(t)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return value.Elem(), nil
+}
+
+func decodeNode(data json.RawMessage) (reflect.Value, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return reflect.Value{}, err
+	}
+
+	var name string
+	if err := json.Unmarshal(fields[nodeTypeField], &name); err != nil {
+		return reflect.Value{}, err
+	}
+
+	t, ok := nodeTypes[name]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("cannot deserialize unknown node %q", name)
+	}
+
+	value, err := decodeFields(fields, t)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	node := reflect.New(t)
+	node.Elem().Set(value)
+
+	return node, nil
+}
+
+func decodeFields(fields map[string]json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	value := reflect.New(t).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		data, ok := fields[t.Field(i).Name]
+		if !ok {
+			continue
+		}
+
+		field, err := decodeAST(data, t.Field(i).Type)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value.Field(i).Set(field)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,266 @@
+package serializer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"waiig/object"
+)
+
+// A closure snapshot holds every function and environment reachable from the functions it was taken of, each one
+// once, so functions sharing an environment still share it once read back and recursive functions can refer to
+// themselves. Functions are referred to as `{"__type":"FUNCTION","value":INDEX}` and environments by their index,
+// Bindings are the functions the snapshot was taken of, by name
+type closureSnapshot struct {
+	Environments []encodedEnvironment `json:"environments"`
+	Functions    []encodedFunction    `json:"functions"`
+	Bindings     map[string]int       `json:"bindings"`
+}
+
+type encodedEnvironment struct {
+	// Outer is the index of the enclosing environment, -1 for an outermost one
+	Outer int                `json:"outer"`
+	Store map[string]encoded `json:"store"`
+}
+
+type decodedEnvironment struct {
+	Outer int                `json:"outer"`
+	Store map[string]decoded `json:"store"`
+}
+
+type encodedFunction struct {
+	Name       string          `json:"name"`
+	Parameters json.RawMessage `json:"parameters"`
+	Body       json.RawMessage `json:"body"`
+	Env        int             `json:"env"`
+}
+
+// MarshalClosure serializes fn along with everything it closes over, bindings which can't be serialized, like builtins
+// and modules, are left out
+func MarshalClosure(fn *object.Function) ([]byte, error) {
+	data, _, err := MarshalClosures(map[string]*object.Function{fn.Name: fn})
+	return data, err
+}
+
+// UnmarshalClosure reads back a function serialized by MarshalClosure
+func UnmarshalClosure(data []byte) (*object.Function, error) {
+	fns, err := UnmarshalClosures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fns) != 1 {
+		return nil, fmt.Errorf("expected 1 function, got %d", len(fns))
+	}
+
+	var fn *object.Function
+	for _, fn = range fns {
+	}
+
+	return fn, nil
+}
+
+// MarshalClosures is MarshalClosure for several functions at once, keyed by the names they're bound to. skipped
+// describes the bindings left out because their values can't be serialized, like a hash with INTEGER keys, builtins
+// and modules are left out without being mentioned
+func MarshalClosures(fns map[string]*object.Function) (data []byte, skipped []string, err error) {
+	s := &snapshotter{
+		snapshot:     closureSnapshot{Bindings: map[string]int{}},
+		environments: map[*object.Environment]int{},
+		functions:    map[*object.Function]int{},
+	}
+
+	names := []string{}
+	for name := range fns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		index, err := s.function(fns[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		s.snapshot.Bindings[name] = index
+	}
+
+	data, err = json.Marshal(s.snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, s.skipped, nil
+}
+
+// UnmarshalClosures reads back the functions serialized by MarshalClosures, keyed by the names they were bound to
+func UnmarshalClosures(data []byte) (map[string]*object.Function, error) {
+	var snapshot struct {
+		Environments []decodedEnvironment `json:"environments"`
+		Functions    []encodedFunction    `json:"functions"`
+		Bindings     map[string]int       `json:"bindings"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+
+	// environments only ever refer to outer environments added before them
+	environments := []*object.Environment{}
+	for i, env := range snapshot.Environments {
+		switch {
+		case env.Outer < 0:
+			environments = append(environments, object.NewEnvironment())
+		case env.Outer < i:
+			environments = append(environments, object.NewEnclosedEnvironment(environments[env.Outer]))
+		default:
+			return nil, fmt.Errorf("environment %d refers to unknown outer environment %d", i, env.Outer)
+		}
+	}
+
+	functions := []*object.Function{}
+	for i, enc := range snapshot.Functions {
+		if enc.Env < 0 || enc.Env >= len(environments) {
+			return nil, fmt.Errorf("function %d refers to unknown environment %d", i, enc.Env)
+		}
+
+		fn := &object.Function{Name: enc.Name, Env: environments[enc.Env]}
+		if err := unmarshalAST(enc.Parameters, &fn.Parameters); err != nil {
+			return nil, err
+		}
+		if err := unmarshalAST(enc.Body, &fn.Body); err != nil {
+			return nil, err
+		}
+
+		functions = append(functions, fn)
+	}
+
+	decodeFn := func(dec decoded) (object.Object, error) {
+		var index int
+		if err := json.Unmarshal(dec.Value, &index); err != nil {
+			return nil, err
+		}
+		if index < 0 || index >= len(functions) {
+			return nil, fmt.Errorf("unknown function %d", index)
+		}
+		return functions[index], nil
+	}
+
+	// the functions exist by now so the environments can be filled in, even with functions which close over them
+	for i, env := range snapshot.Environments {
+		for name, dec := range env.Store {
+			value, err := decode(dec, decodeFn)
+			if err != nil {
+				return nil, err
+			}
+			environments[i].Set(name, value)
+		}
+	}
+
+	fns := map[string]*object.Function{}
+	for name, index := range snapshot.Bindings {
+		if index < 0 || index >= len(functions) {
+			return nil, fmt.Errorf("%s refers to unknown function %d", name, index)
+		}
+		fns[name] = functions[index]
+	}
+
+	return fns, nil
+}
+
+type snapshotter struct {
+	snapshot     closureSnapshot
+	environments map[*object.Environment]int
+	functions    map[*object.Function]int
+	skipped      []string
+}
+
+func (s *snapshotter) function(fn *object.Function) (int, error) {
+	if index, ok := s.functions[fn]; ok {
+		return index, nil
+	}
+
+	// it's added before anything it closes over so that referring back to it finds it
+	index := len(s.snapshot.Functions)
+	s.functions[fn] = index
+	s.snapshot.Functions = append(s.snapshot.Functions, encodedFunction{Name: fn.Name})
+
+	params, err := marshalAST(fn.Parameters)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := marshalAST(fn.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	env, err := s.environment(fn.Env)
+	if err != nil {
+		return 0, err
+	}
+
+	s.snapshot.Functions[index].Parameters = params
+	s.snapshot.Functions[index].Body = body
+	s.snapshot.Functions[index].Env = env
+
+	return index, nil
+}
+
+func (s *snapshotter) environment(env *object.Environment) (int, error) {
+	if index, ok := s.environments[env]; ok {
+		return index, nil
+	}
+
+	outer := -1
+	if env.Outer() != nil {
+		var err error
+		if outer, err = s.environment(env.Outer()); err != nil {
+			return 0, err
+		}
+	}
+
+	// the outer environment can hold a function closing over this one, in which case that already added it
+	if index, ok := s.environments[env]; ok {
+		return index, nil
+	}
+
+	index := len(s.snapshot.Environments)
+	s.environments[env] = index
+	s.snapshot.Environments = append(s.snapshot.Environments, encodedEnvironment{Outer: outer})
+
+	store := map[string]encoded{}
+	bindings := env.Bindings()
+	names := []string{}
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := bindings[name]
+		switch value.(type) {
+		case *object.Builtin, *object.Module:
+			continue
+		}
+
+		// one binding that can't be serialized doesn't keep the functions which don't use it from being saved
+		enc, err := encode(value, s.encodeFunction)
+		if err != nil {
+			s.skipped = append(s.skipped, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		store[name] = enc
+	}
+
+	s.snapshot.Environments[index].Store = store
+
+	return index, nil
+}
+
+func (s *snapshotter) encodeFunction(fn *object.Function) (encoded, error) {
+	index, err := s.function(fn)
+	if err != nil {
+		return encoded{}, err
+	}
+
+	return encoded{Type: fn.Type(), Value: index}, nil
+}
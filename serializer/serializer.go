@@ -0,0 +1,186 @@
+package serializer
+
+import (
+	"encoding/json"
+	"fmt"
+	"waiig/evaluator"
+	"waiig/object"
+)
+
+// Every value is written as `{"__type": TYPE, "value": VALUE}` so it can be read back as the same type, e.g.
+// `{"__type":"INTEGER","value":42}`, null has no value, `{"__type":"NULL"}`
+type encoded struct {
+	Type  object.ObjectType `json:"__type"`
+	Value interface{}       `json:"value,omitempty"`
+}
+
+type decoded struct {
+	Type  object.ObjectType `json:"__type"`
+	Value json.RawMessage   `json:"value"`
+}
+
+type encodedRange struct {
+	From        int64 `json:"from"`
+	ToExclusive int64 `json:"to"`
+}
+
+// Marshal serializes obj as JSON, functions, builtins and hashes with non string keys can't be serialized
+func Marshal(obj object.Object) ([]byte, error) {
+	enc, err := encode(obj, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(enc)
+}
+
+// MarshalString is Marshal returning a string
+func MarshalString(obj object.Object) (string, error) {
+	data, err := Marshal(obj)
+	return string(data), err
+}
+
+// Unmarshal reads back a value serialized by Marshal, nulls and booleans are the evaluator's shared instances so they
+// can be compared like any other
+func Unmarshal(data []byte) (object.Object, error) {
+	var dec decoded
+	if err := json.Unmarshal(data, &dec); err != nil {
+		return nil, err
+	}
+
+	return decode(dec, nil)
+}
+
+// UnmarshalString is Unmarshal taking a string
+func UnmarshalString(data string) (object.Object, error) {
+	return Unmarshal([]byte(data))
+}
+
+// encodeFunction serializes functions found while encoding a value, without one they can't be serialized
+type encodeFunction func(fn *object.Function) (encoded, error)
+
+// decodeFunction reads back the functions serialized by an encodeFunction
+type decodeFunction func(dec decoded) (object.Object, error)
+
+func encode(obj object.Object, encodeFn encodeFunction) (encoded, error) {
+	switch obj := obj.(type) {
+	case nil:
+		// what a statement without a value, like a let, evaluates to
+		return encoded{}, fmt.Errorf("cannot serialize a missing value")
+	case *object.Function:
+		if encodeFn == nil {
+			return encoded{}, fmt.Errorf("cannot serialize %s", obj.Type())
+		}
+		return encodeFn(obj)
+	case *object.Integer:
+		return encoded{Type: obj.Type(), Value: obj.Value}, nil
+	case *object.String:
+		return encoded{Type: obj.Type(), Value: obj.Value}, nil
+	case *object.Boolean:
+		return encoded{Type: obj.Type(), Value: obj.Value}, nil
+	case *object.Null:
+		return encoded{Type: obj.Type()}, nil
+	case *object.Range:
+		return encoded{Type: obj.Type(), Value: encodedRange{From: obj.From, ToExclusive: obj.ToExclusive}}, nil
+	case *object.Array:
+		elements := []encoded{}
+		for _, element := range obj.Elements {
+			enc, err := encode(element, encodeFn)
+			if err != nil {
+				return encoded{}, err
+			}
+			elements = append(elements, enc)
+		}
+		return encoded{Type: obj.Type(), Value: elements}, nil
+	case *object.Hash:
+		pairs := map[string]encoded{}
+		for _, pair := range obj.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return encoded{}, fmt.Errorf("hash keys must be STRING to be serialized, got %s", pair.Key.Type())
+			}
+
+			enc, err := encode(pair.Value, encodeFn)
+			if err != nil {
+				return encoded{}, err
+			}
+			pairs[key.Value] = enc
+		}
+		return encoded{Type: obj.Type(), Value: pairs}, nil
+	default:
+		return encoded{}, fmt.Errorf("cannot serialize %s", obj.Type())
+	}
+}
+
+func decode(dec decoded, decodeFn decodeFunction) (object.Object, error) {
+	switch dec.Type {
+	case object.FUNCTION_OBJ:
+		if decodeFn == nil {
+			return nil, fmt.Errorf("cannot deserialize unknown type %q", dec.Type)
+		}
+		return decodeFn(dec)
+	case object.INTEGER_OBJ:
+		var value int64
+		if err := json.Unmarshal(dec.Value, &value); err != nil {
+			return nil, err
+		}
+		return &object.Integer{Value: value}, nil
+	case object.STRING_OBJ:
+		var value string
+		if err := json.Unmarshal(dec.Value, &value); err != nil {
+			return nil, err
+		}
+		return &object.String{Value: value}, nil
+	case object.BOOLEAN_OBJ:
+		var value bool
+		if err := json.Unmarshal(dec.Value, &value); err != nil {
+			return nil, err
+		}
+		if value {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case object.NULL_OBJ:
+		return evaluator.NULL, nil
+	case object.RANGE_OBJ:
+		var value encodedRange
+		if err := json.Unmarshal(dec.Value, &value); err != nil {
+			return nil, err
+		}
+		return &object.Range{From: value.From, ToExclusive: value.ToExclusive}, nil
+	case object.ARRAY_OBJ:
+		var values []decoded
+		if err := json.Unmarshal(dec.Value, &values); err != nil {
+			return nil, err
+		}
+
+		elements := []object.Object{}
+		for _, value := range values {
+			element, err := decode(value, decodeFn)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return &object.Array{Elements: elements}, nil
+	case object.HASH_OBJ:
+		var values map[string]decoded
+		if err := json.Unmarshal(dec.Value, &values); err != nil {
+			return nil, err
+		}
+
+		pairs := map[object.HashKey]object.HashPair{}
+		for k, v := range values {
+			value, err := decode(v, decodeFn)
+			if err != nil {
+				return nil, err
+			}
+
+			key := &object.String{Value: k}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	default:
+		return nil, fmt.Errorf("cannot deserialize unknown type %q", dec.Type)
+	}
+}
@@ -0,0 +1,355 @@
+package serializer
+
+import (
+	"reflect"
+	"testing"
+	"waiig/evaluator"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"42", `{"__type":"INTEGER","value":42}`},
+		{"0", `{"__type":"INTEGER","value":0}`},
+		{`"hi"`, `{"__type":"STRING","value":"hi"}`},
+		{"false", `{"__type":"BOOLEAN","value":false}`},
+		{"null", `{"__type":"NULL"}`},
+		{"1:3", `{"__type":"RANGE","value":{"from":1,"to":3}}`},
+		{"[1, null]", `{"__type":"ARRAY","value":[{"__type":"INTEGER","value":1},{"__type":"NULL"}]}`},
+		{"[]", `{"__type":"ARRAY","value":[]}`},
+		{`{"b": true, "a": "x"}`, `{"__type":"HASH","value":{"a":{"__type":"STRING","value":"x"},"b":{"__type":"BOOLEAN","value":true}}}`},
+	}
+
+	for _, tt := range tests {
+		actual, err := MarshalString(testEval(t, tt.input))
+		if err != nil {
+			t.Errorf("input %q - unexpected error: %s", tt.input, err)
+			continue
+		}
+
+		if actual != tt.expected {
+			t.Errorf("input %q - expected=%s, got=%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"42",
+		"-7",
+		`"hello, 世界"`,
+		"true",
+		"false",
+		"null",
+		"2:5",
+		"[1, \"two\", [3, [true]], null]",
+		`{"name": "monkey", "tags": [1, "a", false, null, {"nested": [2:4]}], "empty": {}}`,
+	}
+
+	for _, input := range tests {
+		original := testEval(t, input)
+
+		data, err := Marshal(original)
+		if err != nil {
+			t.Errorf("input %q - unexpected marshal error: %s", input, err)
+			continue
+		}
+
+		decoded, err := Unmarshal(data)
+		if err != nil {
+			t.Errorf("input %q - unexpected unmarshal error: %s", input, err)
+			continue
+		}
+
+		if decoded.Type() != original.Type() {
+			t.Errorf("input %q - wrong type. expected=%s, got=%s", input, original.Type(), decoded.Type())
+		}
+
+		// hashes don't inspect in a stable order, marshalling again does since keys are sorted
+		again, err := Marshal(decoded)
+		if err != nil {
+			t.Errorf("input %q - unexpected marshal error: %s", input, err)
+			continue
+		}
+
+		if string(again) != string(data) {
+			t.Errorf("input %q - round trip changed the value. expected=%s, got=%s", input, data, again)
+		}
+	}
+}
+
+func TestUnmarshalUsesSharedSingletons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected object.Object
+	}{
+		{`{"__type":"BOOLEAN","value":true}`, evaluator.TRUE},
+		{`{"__type":"BOOLEAN","value":false}`, evaluator.FALSE},
+		{`{"__type":"NULL"}`, evaluator.NULL},
+	}
+
+	for _, tt := range tests {
+		actual, err := UnmarshalString(tt.input)
+		if err != nil {
+			t.Errorf("input %s - unexpected error: %s", tt.input, err)
+			continue
+		}
+
+		if actual != tt.expected {
+			t.Errorf("input %s - expected the shared %s instance, got=%p", tt.input, tt.expected.Inspect(), actual)
+		}
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(x) { x }", "cannot serialize FUNCTION"},
+		{"len", "cannot serialize BUILTIN"},
+		{"[1, fn() { 1 }]", "cannot serialize FUNCTION"},
+		{`{1: "one"}`, "hash keys must be STRING to be serialized, got INTEGER"},
+		{`{"a": {true: 1}}`, "hash keys must be STRING to be serialized, got BOOLEAN"},
+		{"let x = 1", "cannot serialize a missing value"},
+	}
+
+	for _, tt := range tests {
+		_, err := Marshal(testEval(t, tt.input))
+		if err == nil {
+			t.Errorf("input %q - expected error, got none", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("input %q - wrong error. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"__type":"FUNCTION","value":"fn"}`, `cannot deserialize unknown type "FUNCTION"`},
+		{`{"__type":"ARRAY","value":[{"__type":"NOPE"}]}`, `cannot deserialize unknown type "NOPE"`},
+		{`{"__type":"INTEGER","value":"42"}`, "json: cannot unmarshal string into Go value of type int64"},
+	}
+
+	for _, tt := range tests {
+		_, err := UnmarshalString(tt.input)
+		if err == nil {
+			t.Errorf("input %s - expected error, got none", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("input %s - wrong error. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+
+	if _, err := UnmarshalString("not json"); err == nil {
+		t.Errorf("expected error for invalid json, got none")
+	}
+}
+
+func TestClosureRoundTrip(t *testing.T) {
+	tests := []struct {
+		setup    string
+		function string
+		call     string
+		expected int64
+	}{
+		{"let add = fn(a, b) { a + b };", "add", "f(2, 3)", 5},
+		{"let makeAdder = fn(x) { fn(y) { x + y } }; let addTwo = makeAdder(2);", "addTwo", "f(5)", 7},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };", "fact", "f(5)", 120},
+		{"let double = fn(x) { x * 2 }; let data = {\"xs\": [1, 2, 3]}; let g = fn(i) { double(data[\"xs\"][i]) };", "g", "f(2)", 6},
+		{"let x = 10; let outer = fn() { let y = 1; fn() { x + y } }; let inner = outer();", "inner", "f()", 11},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		testEvalIn(t, tt.setup, env)
+
+		fn, ok := testEvalIn(t, tt.function, env).(*object.Function)
+		if !ok {
+			t.Fatalf("setup %q - %s is not a function", tt.setup, tt.function)
+		}
+
+		data, err := MarshalClosure(fn)
+		if err != nil {
+			t.Errorf("setup %q - unexpected marshal error: %s", tt.setup, err)
+			continue
+		}
+
+		restored, err := UnmarshalClosure(data)
+		if err != nil {
+			t.Errorf("setup %q - unexpected unmarshal error: %s", tt.setup, err)
+			continue
+		}
+
+		fresh := object.NewEnvironment()
+		fresh.Set("f", restored)
+
+		result, ok := testEvalIn(t, tt.call, fresh).(*object.Integer)
+		if !ok {
+			t.Errorf("setup %q - restored function didn't return an integer", tt.setup)
+			continue
+		}
+
+		if result.Value != tt.expected {
+			t.Errorf("setup %q - wrong result. expected=%d, got=%d", tt.setup, tt.expected, result.Value)
+		}
+	}
+}
+
+func TestClosuresKeepSharedEnvironments(t *testing.T) {
+	env := object.NewEnvironment()
+	testEvalIn(t, `
+		let makeCounter = fn() { let n = 0; [fn() { n = n + 1 }, fn() { n }] };
+		let counter = makeCounter();
+		let increment = counter[0];
+		let current = counter[1];
+		increment();
+	`, env)
+
+	increment, _ := env.Get("increment")
+	current, _ := env.Get("current")
+
+	data, _, err := MarshalClosures(map[string]*object.Function{
+		"increment": increment.(*object.Function),
+		"current":   current.(*object.Function),
+	})
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %s", err)
+	}
+
+	fns, err := UnmarshalClosures(data)
+	if err != nil {
+		t.Fatalf("unexpected unmarshal error: %s", err)
+	}
+
+	fresh := object.NewEnvironment()
+	for name, fn := range fns {
+		fresh.Set(name, fn)
+	}
+
+	result := testEvalIn(t, "increment(); increment(); current()", fresh)
+	if integer, ok := result.(*object.Integer); !ok || integer.Value != 3 {
+		t.Errorf("expected the restored functions to share their counter, got=%s", result.Inspect())
+	}
+}
+
+func TestClosuresSkipUnserializableBindings(t *testing.T) {
+	env := object.NewEnvironment()
+	testEvalIn(t, `
+		let table = {1: "one"};
+		let n = 2;
+		let double = fn() { n * 2 };
+	`, env)
+
+	double, _ := env.Get("double")
+
+	data, skipped, err := MarshalClosures(map[string]*object.Function{"double": double.(*object.Function)})
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %s", err)
+	}
+
+	expected := []string{"table: hash keys must be STRING to be serialized, got INTEGER"}
+	if !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("wrong skipped bindings. expected=%q, got=%q", expected, skipped)
+	}
+
+	fns, err := UnmarshalClosures(data)
+	if err != nil {
+		t.Fatalf("unexpected unmarshal error: %s", err)
+	}
+
+	fresh := object.NewEnvironment()
+	fresh.Set("double", fns["double"])
+	if result := testEvalIn(t, "double()", fresh); result.Inspect() != "4" {
+		t.Errorf("expected the restored function to work, got=%s", result.Inspect())
+	}
+}
+
+func TestClosureBodyRoundTrip(t *testing.T) {
+	input := `fn(xs, h) {
+		let total = 0;
+		let i = 0;
+		while (i < len(xs)) {
+			if (!(xs[i] == null) == (0 < xs[i] < 10)) { total = total + xs[i] } else { i++; continue };
+			i++;
+		};
+		do { total-- } while (false);
+		loop { break };
+		let r = 1:3;
+		let s = h?.name ?? "none";
+		let m = h.tags.len();
+		let p = total |> fn(x) { -x };
+		return [r, s, m, p, {"a": true, 1: "b"}, "done"];
+	}`
+
+	fn := testEval(t, input).(*object.Function)
+
+	data, err := MarshalClosure(fn)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %s", err)
+	}
+
+	restored, err := UnmarshalClosure(data)
+	if err != nil {
+		t.Fatalf("unexpected unmarshal error: %s", err)
+	}
+
+	if restored.Body.String() != fn.Body.String() {
+		t.Errorf("body changed. expected=%q, got=%q", fn.Body.String(), restored.Body.String())
+	}
+
+	if len(restored.Parameters) != 2 || restored.Parameters[1].Value != "h" {
+		t.Errorf("parameters changed. got=%v", restored.Parameters)
+	}
+}
+
+func TestClosureLeavesOutBuiltins(t *testing.T) {
+	env := object.NewEnvironment()
+	testEvalIn(t, "let size = len; let n = 2; let f = fn() { n };", env)
+
+	f, _ := env.Get("f")
+	data, err := MarshalClosure(f.(*object.Function))
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %s", err)
+	}
+
+	restored, err := UnmarshalClosure(data)
+	if err != nil {
+		t.Fatalf("unexpected unmarshal error: %s", err)
+	}
+
+	if _, ok := restored.Env.Get("size"); ok {
+		t.Errorf("expected the builtin binding to be left out")
+	}
+	if _, ok := restored.Env.Get("n"); !ok {
+		t.Errorf("expected the integer binding to be kept")
+	}
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	return testEvalIn(t, input, object.NewEnvironment())
+}
+
+func testEvalIn(t *testing.T, input string, env *object.Environment) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("input %q has parser errors: %v", input, p.Errors())
+	}
+
+	return evaluator.Eval(program, env)
+}
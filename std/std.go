@@ -0,0 +1,8 @@
+package std
+
+import "embed"
+
+// Files holds the standard library sources, embedded so the interpreter doesn't depend on being run from the repo
+//
+//go:embed *.monkey
+var Files embed.FS
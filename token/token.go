@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
@@ -23,10 +25,21 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	INCREMENT = "++"
+	DECREMENT = "--"
+
+	PIPE     = "|>"
+	COALESCE = "??"
+
+	FWDARROW = ">>"
+	BWDARROW = "<<"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
+	OPT_DOT   = "?."
 
 	LPAREN = "("
 	RPAREN = ")"
@@ -40,9 +53,19 @@ const (
 	LET      = "LET"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
+	NULL     = "NULL"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	DO       = "DO"
+	LOOP     = "LOOP"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
 )
 
 type TokenType string
@@ -50,18 +73,37 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is where a token starts in the source, the zero Position means it's unknown
+type Position struct {
+	Line   int
+	Column int
+}
 
-	// TODO Add debug info such as file names, line number and line char index
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, col %d", p.Line, p.Column)
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"null":     NULL,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"do":       DO,
+	"loop":     LOOP,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+	"export":   EXPORT,
 }
 
 func LookUpIdent(ident string) TokenType {
@@ -0,0 +1,558 @@
+package typecheck
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"waiig/ast"
+	"waiig/evaluator"
+	"waiig/object"
+	"waiig/token"
+)
+
+// unknown is the type of anything that can't be told without running the program, like a function's result or a
+// parameter, operations on it are never reported
+const unknown object.ObjectType = ""
+
+// annotations are the type names lets and parameters can be annotated with, `any` is the same as no annotation
+var annotations = map[string]object.ObjectType{
+	"int":    object.INTEGER_OBJ,
+	"string": object.STRING_OBJ,
+	"bool":   object.BOOLEAN_OBJ,
+	"array":  object.ARRAY_OBJ,
+	"hash":   object.HASH_OBJ,
+	"range":  object.RANGE_OBJ,
+	"fn":     object.FUNCTION_OBJ,
+	"any":    unknown,
+}
+
+// Error is a type error found in a program, Pos is where the evaluator would report it
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) String() string {
+	if e.Pos.Line == 0 {
+		return e.Message
+	}
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Check infers the types of the expressions in program without evaluating it and reports the operations which fail
+// whenever they run, with the messages and positions the evaluator gives for them, like adding a boolean to an
+// integer, indexing an integer or calling a string. It only reports what it's sure of: a variable which is ever
+// assigned or bound by more than one let, anywhere in the program, has an unknown type, and so do parameters, the
+// results of calls and of the branching expressions, so a program Check accepts can still fail at runtime. Annotated
+// variables and parameters have the type they're annotated with instead, and values of any other known type assigned
+// or passed to them are reported
+func Check(program *ast.Program) []Error {
+	c := &checker{varying: varyingNames(program)}
+
+	c.push()
+	for _, stmt := range program.Statements {
+		c.statement(stmt)
+	}
+	c.pop()
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		a, b := c.errors[i].Pos, c.errors[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return c.errors
+}
+
+// binding is what's known of a variable, fn is set when it's bound to a function literal so calls can be checked
+// against its parameters, and annotation when typ is what it's declared with rather than what was inferred
+type binding struct {
+	typ        object.ObjectType
+	fn         *ast.FunctionLiteral
+	annotation *ast.Identifier
+}
+
+type checker struct {
+	// scopes mirror the evaluator's environments like the linter's, the program has one and every function call and
+	// for loop iteration gets its own enclosed one
+	scopes  []map[string]binding
+	varying map[string]bool
+	errors  []Error
+}
+
+func (c *checker) push() {
+	c.scopes = append(c.scopes, map[string]binding{})
+}
+
+func (c *checker) pop() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *checker) declare(name string, b binding) {
+	if c.varying[name] && b.annotation == nil {
+		b = binding{typ: unknown}
+	}
+	c.scopes[len(c.scopes)-1][name] = b
+}
+
+func (c *checker) lookup(name string) (binding, bool) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if b, ok := c.scopes[i][name]; ok {
+			return b, true
+		}
+	}
+	return binding{}, false
+}
+
+func (c *checker) errorf(pos token.Position, format string, a ...interface{}) {
+	c.errors = append(c.errors, Error{Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+func (c *checker) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		typ := c.expression(stmt.Value)
+		fn, _ := stmt.Value.(*ast.FunctionLiteral)
+		if stmt.Name.Annotation != nil {
+			declared := c.annotation(stmt.Name.Annotation)
+			if !assignable(typ, declared) {
+				c.errorf(stmt.Name.Pos(), "cannot use %s as %s in let %s", typ, stmt.Name.Annotation.Value, stmt.Name.Value)
+			}
+			c.declare(stmt.Name.Value, binding{typ: declared, fn: fn, annotation: stmt.Name.Annotation})
+		} else {
+			c.declare(stmt.Name.Value, binding{typ: typ, fn: fn})
+		}
+	case *ast.ImportStatement:
+		name := strings.TrimSuffix(filepath.Base(stmt.Path.Value), filepath.Ext(stmt.Path.Value))
+		c.declare(name, binding{typ: object.MODULE_OBJ})
+	case *ast.ReturnStatement:
+		c.expression(stmt.ReturnValue)
+	case *ast.BreakStatement:
+		if stmt.Value != nil {
+			c.expression(stmt.Value)
+		}
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		c.block(stmt)
+	}
+}
+
+// block checks the statements of a block, which runs in the scope around it
+func (c *checker) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		c.statement(stmt)
+	}
+}
+
+// expression checks exp and returns its type, an expression which would fail is unknown so one mistake is only
+// reported once rather than by everything it's part of
+func (c *checker) expression(exp ast.Expression) object.ObjectType {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return object.INTEGER_OBJ
+	case *ast.StringLiteral:
+		return object.STRING_OBJ
+	case *ast.Boolean:
+		return object.BOOLEAN_OBJ
+	case *ast.Null:
+		return object.NULL_OBJ
+	case *ast.Identifier:
+		return c.identifier(exp).typ
+	case *ast.ArrayLiteral:
+		for _, element := range exp.Elements {
+			c.expression(element)
+		}
+		return object.ARRAY_OBJ
+	case *ast.HashLiteral:
+		for _, pair := range exp.Pairs {
+			key := c.expression(pair.Key)
+			c.expression(pair.Value)
+			if key != unknown && !hashable(key) {
+				c.errorf(exp.Pos(), "unusable as hash key: %s", key)
+			}
+		}
+		return object.HASH_OBJ
+	case *ast.FunctionLiteral:
+		c.push()
+		for _, param := range exp.Parameters {
+			if param.Annotation != nil {
+				c.declare(param.Value, binding{typ: c.annotation(param.Annotation), annotation: param.Annotation})
+			} else {
+				c.declare(param.Value, binding{typ: unknown})
+			}
+		}
+		c.block(exp.Body)
+		c.pop()
+		return object.FUNCTION_OBJ
+	case *ast.PrefixExpression:
+		right := c.expression(exp.Right)
+		switch exp.Operator {
+		case "!":
+			return object.BOOLEAN_OBJ
+		case "-":
+			if right != unknown && right != object.INTEGER_OBJ {
+				c.errorf(exp.Pos(), "unknown operator: -%s", right)
+				return unknown
+			}
+			return object.INTEGER_OBJ
+		}
+		return unknown
+	case *ast.PostfixExpression:
+		c.identifier(exp.Target)
+		return unknown
+	case *ast.InfixExpression:
+		left := c.expression(exp.Left)
+		right := c.expression(exp.Right)
+		return c.infix(exp.Pos(), exp.Operator, left, right)
+	case *ast.ComparisonChain:
+		types := []object.ObjectType{}
+		for _, operand := range exp.Operands {
+			types = append(types, c.expression(operand))
+		}
+		// the chain stops at the first comparison which is false, so only the first one is sure to run
+		c.infix(exp.Pos(), exp.Operators[0], types[0], types[1])
+		return object.BOOLEAN_OBJ
+	case *ast.RangeExpression:
+		left := c.expression(exp.Left)
+		right := c.expression(exp.Right)
+		if left != unknown && right != unknown && (left != object.INTEGER_OBJ || right != object.INTEGER_OBJ) {
+			c.errorf(exp.Pos(), "unknown operator: %s : %s", left, right)
+			return unknown
+		}
+		return object.RANGE_OBJ
+	case *ast.IndexExpression:
+		return c.index(exp)
+	case *ast.CallExpression:
+		c.call(exp)
+		return unknown
+	case *ast.DotExpression:
+		left := c.expression(exp.Left)
+		switch left {
+		case unknown, object.HASH_OBJ, object.MODULE_OBJ:
+		case object.NULL_OBJ:
+			if !exp.Optional {
+				c.errorf(exp.Pos(), "unknown operator: dot access of %s", left)
+			}
+		default:
+			c.errorf(exp.Pos(), "unknown operator: dot access of %s", left)
+		}
+		return unknown
+	case *ast.MethodCallExpression:
+		c.expression(exp.Receiver)
+		for _, arg := range exp.Arguments {
+			c.expression(arg)
+		}
+		return unknown
+	case *ast.PipeExpression:
+		c.expression(exp.Left)
+		c.expression(exp.Right)
+		return unknown
+	case *ast.CoalesceExpression:
+		left := c.expression(exp.Left)
+		right := c.expression(exp.Right)
+		switch left {
+		case unknown:
+			return unknown
+		case object.NULL_OBJ:
+			return right
+		default:
+			return left
+		}
+	case *ast.AssignExpression:
+		c.assign(exp)
+		return unknown
+	case *ast.IfExpression:
+		c.expression(exp.Condition)
+		c.block(exp.Consequence)
+		if exp.Alternative != nil {
+			c.block(exp.Alternative)
+		}
+		return unknown
+	case *ast.WhileExpression:
+		c.expression(exp.Condition)
+		c.block(exp.Body)
+		return unknown
+	case *ast.DoWhileExpression:
+		c.block(exp.Body)
+		c.expression(exp.Condition)
+		return unknown
+	case *ast.LoopExpression:
+		c.block(exp.Body)
+		return unknown
+	case *ast.ForInExpression:
+		c.forIn(exp)
+		return unknown
+	case *ast.BlockStatement:
+		c.block(exp)
+		return unknown
+	}
+
+	return unknown
+}
+
+// identifier is what's known of the variable ident names, names which aren't bound yet are unknown rather than
+// reported since a function can use a binding declared after it
+func (c *checker) identifier(ident *ast.Identifier) binding {
+	if b, ok := c.lookup(ident.Value); ok {
+		return b
+	}
+	if isBuiltin(ident.Value) {
+		return binding{typ: object.BUILTIN_OBJ}
+	}
+	return binding{typ: unknown}
+}
+
+// infix mirrors the evaluator's evalInfixExpression for operands of known types
+func (c *checker) infix(pos token.Position, operator string, left, right object.ObjectType) object.ObjectType {
+	comparison := operator == "==" || operator == "!=" || operator == "<" || operator == ">"
+	composition := operator == ">>" || operator == "<<"
+
+	switch {
+	case composition && (left == unknown || right == unknown):
+		return unknown
+	case composition && callable(left) && callable(right):
+		return object.BUILTIN_OBJ
+	case composition && left != right:
+		c.errorf(pos, "type mismatch: %s %s %s", left, operator, right)
+		return unknown
+	case composition:
+		c.errorf(pos, "unknown operator: %s %s %s", left, operator, right)
+		return unknown
+	case operator == "+" && (left == object.STRING_OBJ || right == object.STRING_OBJ):
+		return object.STRING_OBJ
+	case left == unknown || right == unknown:
+		if comparison {
+			return object.BOOLEAN_OBJ
+		}
+		return unknown
+	case left == object.INTEGER_OBJ && right == object.INTEGER_OBJ:
+		if comparison {
+			return object.BOOLEAN_OBJ
+		}
+		return object.INTEGER_OBJ
+	case left == object.STRING_OBJ && right == object.STRING_OBJ && (operator == "==" || operator == "!="):
+		return object.BOOLEAN_OBJ
+	case operator == "*" && ((left == object.STRING_OBJ && right == object.INTEGER_OBJ) ||
+		(left == object.INTEGER_OBJ && right == object.STRING_OBJ)):
+		return object.STRING_OBJ
+	case left == object.STRING_OBJ && right == object.STRING_OBJ:
+		c.errorf(pos, "unknown operator: %s %s %s", left, operator, right)
+	case operator == "==" || operator == "!=":
+		return object.BOOLEAN_OBJ
+	case left != right:
+		c.errorf(pos, "type mismatch: %s %s %s", left, operator, right)
+	default:
+		c.errorf(pos, "unknown operator: %s %s %s", left, operator, right)
+	}
+
+	return unknown
+}
+
+// index mirrors the evaluator's evalIndexExpression
+func (c *checker) index(exp *ast.IndexExpression) object.ObjectType {
+	left := c.expression(exp.Left)
+	index := c.expression(exp.Index)
+
+	switch left {
+	case unknown:
+		return unknown
+	case object.ARRAY_OBJ, object.STRING_OBJ:
+		switch index {
+		case unknown:
+			if left == object.STRING_OBJ {
+				return object.STRING_OBJ
+			}
+			return unknown
+		case object.INTEGER_OBJ:
+			if left == object.STRING_OBJ {
+				return object.STRING_OBJ
+			}
+			return unknown
+		case object.RANGE_OBJ:
+			return left
+		default:
+			c.errorf(exp.Pos(), "unknown index type: %s", index)
+			return unknown
+		}
+	case object.HASH_OBJ:
+		if index != unknown && !hashable(index) {
+			c.errorf(exp.Pos(), "unusable as hash key: %s", index)
+		}
+		return unknown
+	default:
+		c.errorf(exp.Pos(), "unknown operator: index of %s", left)
+		return unknown
+	}
+}
+
+// call mirrors the evaluator's applyFunction, calls to a variable bound to a function literal are checked against
+// its parameters and their annotations, extra arguments are ignored like they are at runtime
+func (c *checker) call(exp *ast.CallExpression) {
+	fn := c.expression(exp.Function)
+	args := []object.ObjectType{}
+	for _, arg := range exp.Arguments {
+		args = append(args, c.expression(arg))
+	}
+
+	switch fn {
+	case unknown, object.BUILTIN_OBJ:
+	case object.FUNCTION_OBJ:
+		literal, _ := exp.Function.(*ast.FunctionLiteral)
+		if ident, ok := exp.Function.(*ast.Identifier); ok {
+			literal = c.identifier(ident).fn
+		}
+		if literal == nil {
+			return
+		}
+		if len(args) < len(literal.Parameters) {
+			c.errorf(exp.Pos(), "wrong number of arguments. got=%d, want=%d", len(args), len(literal.Parameters))
+			return
+		}
+		for i, param := range literal.Parameters {
+			if param.Annotation == nil {
+				continue
+			}
+			if declared, ok := annotations[param.Annotation.Value]; ok && !assignable(args[i], declared) {
+				c.errorf(exp.Pos(), "cannot use %s as %s for parameter %s", args[i], param.Annotation.Value, param.Value)
+			}
+		}
+	default:
+		c.errorf(exp.Pos(), "not a function: %s", fn)
+	}
+}
+
+// assign checks the value against the annotation of the variable it's assigned to and, for `xs[i] = value`, that xs
+// can be assigned into like evalIndexAssignment does. Unannotated assigned variables are unknown everywhere so there's
+// nothing to record for them
+func (c *checker) assign(exp *ast.AssignExpression) {
+	value := c.expression(exp.Value)
+
+	if ident, ok := exp.Target.(*ast.Identifier); ok {
+		if b := c.identifier(ident); b.annotation != nil && !assignable(value, b.typ) {
+			c.errorf(exp.Pos(), "cannot use %s as %s in assignment to %s", value, b.annotation.Value, ident.Value)
+		}
+		return
+	}
+
+	target, ok := exp.Target.(*ast.IndexExpression)
+	if !ok {
+		c.expression(exp.Target)
+		return
+	}
+
+	left := c.expression(target.Left)
+	index := c.expression(target.Index)
+
+	switch left {
+	case object.ARRAY_OBJ:
+		if index != unknown && index != object.INTEGER_OBJ {
+			c.errorf(target.Pos(), "unknown index type: %s", index)
+		}
+	case object.HASH_OBJ:
+		if index != unknown && !hashable(index) {
+			c.errorf(target.Pos(), "unusable as hash key: %s", index)
+		}
+	}
+}
+
+// forIn mirrors the evaluator's evalForInExpression, the loop variables are bound in a scope of their own
+func (c *checker) forIn(exp *ast.ForInExpression) {
+	iterable := c.expression(exp.Iterable)
+
+	value := unknown
+	switch iterable {
+	case object.STRING_OBJ:
+		value = object.STRING_OBJ
+	case object.RANGE_OBJ:
+		value = object.INTEGER_OBJ
+	case unknown, object.ARRAY_OBJ:
+	default:
+		c.errorf(exp.Pos(), "cannot iterate over %s", iterable)
+	}
+
+	c.push()
+	if exp.IndexVar != nil {
+		c.declare(exp.IndexVar.Value, binding{typ: object.INTEGER_OBJ})
+	}
+	c.declare(exp.ValueVar.Value, binding{typ: value})
+	c.block(exp.Body)
+	c.pop()
+}
+
+// annotation is the type annotation names, unknown names are reported and treated like `any`
+func (c *checker) annotation(annotation *ast.Identifier) object.ObjectType {
+	typ, ok := annotations[annotation.Value]
+	if !ok {
+		c.errorf(annotation.Pos(), "unknown type: %s", annotation.Value)
+		return unknown
+	}
+	return typ
+}
+
+// assignable is whether a value of type typ can be stored somewhere declared as declared, values of unknown type
+// can't be told apart so they always are
+func assignable(typ, declared object.ObjectType) bool {
+	return typ == unknown || declared == unknown || typ == declared
+}
+
+func callable(typ object.ObjectType) bool {
+	return typ == object.FUNCTION_OBJ || typ == object.BUILTIN_OBJ
+}
+
+// hashable mirrors which objects implement object.Hashable
+func hashable(typ object.ObjectType) bool {
+	switch typ {
+	case object.INTEGER_OBJ, object.BOOLEAN_OBJ, object.STRING_OBJ, object.NULL_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBuiltin(name string) bool {
+	for _, builtin := range evaluator.BuiltinNames() {
+		if builtin == name {
+			return true
+		}
+	}
+	return false
+}
+
+// varyingNames are the names whose type can change while the program runs, the ones which are ever assigned,
+// incremented or bound by more than one let, whichever scope that's in
+func varyingNames(program *ast.Program) map[string]bool {
+	lets := map[string]int{}
+	varying := map[string]bool{}
+
+	ast.Walk(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			lets[node.Name.Value]++
+		case *ast.AssignExpression:
+			if ident, ok := node.Target.(*ast.Identifier); ok {
+				varying[ident.Value] = true
+			}
+		case *ast.PostfixExpression:
+			varying[node.Target.Value] = true
+		case *ast.ForInExpression:
+			// the loop variables change every iteration, and their type too when iterating an array
+			if node.IndexVar != nil {
+				lets[node.IndexVar.Value]++
+			}
+			lets[node.ValueVar.Value]++
+		}
+		return true
+	})
+
+	for name, count := range lets {
+		if count > 1 {
+			varying[name] = true
+		}
+	}
+
+	return varying
+}
@@ -0,0 +1,94 @@
+package typecheck
+
+import (
+	"testing"
+	"waiig/ast"
+	"waiig/lexer"
+	"waiig/parser"
+)
+
+func TestCheckReportsTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`1 + true`, []string{"line 1, col 3: type mismatch: INTEGER + BOOLEAN"}},
+		{`let s = "a"; s - 1`, []string{"line 1, col 16: type mismatch: STRING - INTEGER"}},
+		{`"a" < "b"`, []string{"line 1, col 5: unknown operator: STRING < STRING"}},
+		{`true + false`, []string{"line 1, col 6: unknown operator: BOOLEAN + BOOLEAN"}},
+		{`-"a"`, []string{"line 1, col 1: unknown operator: -STRING"}},
+		{`let n = 5; n[0]`, []string{"line 1, col 13: unknown operator: index of INTEGER"}},
+		{`[1, 2]["a"]`, []string{"line 1, col 7: unknown index type: STRING"}},
+		{`{"a": 1}[[1]]`, []string{"line 1, col 9: unusable as hash key: ARRAY"}},
+		{`{[1]: 2}`, []string{"line 1, col 1: unusable as hash key: ARRAY"}},
+		{`let f = "f"; f(1)`, []string{"line 1, col 15: not a function: STRING"}},
+		{`let add = fn(a, b) { a + b }; add(1)`, []string{"line 1, col 34: wrong number of arguments. got=1, want=2"}},
+		{`for x in 5 { x }`, []string{"line 1, col 1: cannot iterate over INTEGER"}},
+		{`"a":3`, []string{"line 1, col 4: unknown operator: STRING : INTEGER"}},
+		{`let f = fn(x) { x + (1 - "a") }`, []string{"line 1, col 24: type mismatch: INTEGER - STRING"}},
+		// the failed subtraction is reported once, not again by the addition it's part of
+		{`(1 - "a") + true`, []string{"line 1, col 4: type mismatch: INTEGER - STRING"}},
+		{`let x: int = "a"`, []string{"line 1, col 5: cannot use STRING as int in let x"}},
+		{`let x: int = 1; x = "a"`, []string{"line 1, col 19: cannot use STRING as int in assignment to x"}},
+		{`let f = fn(s: string) { s - 1 }`, []string{"line 1, col 27: type mismatch: STRING - INTEGER"}},
+		{`let f = fn(n: int, s: string) { n }; f(1, 2)`, []string{"line 1, col 39: cannot use INTEGER as string for parameter s"}},
+		{`let x: number = 1`, []string{"line 1, col 8: unknown type: number"}},
+		{`let f = fn(x) { x }; f >> 1`, []string{"line 1, col 24: type mismatch: FUNCTION >> INTEGER"}},
+	}
+
+	for _, tt := range tests {
+		errors := Check(parse(t, tt.input))
+
+		actual := []string{}
+		for _, err := range errors {
+			actual = append(actual, err.String())
+		}
+
+		if len(actual) != len(tt.expected) {
+			t.Errorf("input %q - wrong errors. expected=%q, got=%q", tt.input, tt.expected, actual)
+			continue
+		}
+		for i := range tt.expected {
+			if actual[i] != tt.expected[i] {
+				t.Errorf("input %q - wrong error. expected=%q, got=%q", tt.input, tt.expected[i], actual[i])
+			}
+		}
+	}
+}
+
+func TestCheckCleanProgram(t *testing.T) {
+	input := `
+let greet = fn(name) { "hello " + name };
+let n = 1 + 2 * 3;
+let label = "n: " + n;
+let xs = [1, 2, 3];
+let h = {"a": 1, true: 2, null: 3};
+let total = 0;
+for i, x in xs { total = total + x * i };
+for c in "abc" { puts(c * 2) };
+total = "now a string";
+puts(greet("world"), label, xs[0:2], h["a"], h.a, total - 1, len(xs), -n, "ab"[0] == "a");
+let later = fn() { undefinedYet - 1 };
+let count: int = 0;
+count = count + 1;
+let twice = fn(f: fn, x: any) { f(f(x)) };
+puts(twice(fn(n) { n * 2 }, count) - 1);
+`
+
+	if errors := Check(parse(t, input)); len(errors) != 0 {
+		t.Errorf("expected no errors, got=%v", errors)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("input %q has parser errors: %v", input, p.Errors())
+	}
+
+	return program
+}